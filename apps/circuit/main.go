@@ -9,17 +9,35 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/markkurossi/mpc/circuit"
 )
 
 func main() {
 	render := flag.Bool("r", false, "Render circuit")
+	metrics := flag.Bool("m", false,
+		"print circuit depth, fan-out, and wire lifetime metrics")
+	opt := flag.Bool("opt", false,
+		"optimize circuit: circuit -opt in.circ out.circ")
 	flag.Parse()
 
+	if *opt {
+		if len(flag.Args()) != 2 {
+			log.Fatal("usage: circuit -opt in.circ out.circ")
+		}
+		err := optimize(flag.Args()[0], flag.Args()[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	for _, file := range flag.Args() {
 		c, err := circuit.Parse(file)
 		if err != nil {
@@ -30,6 +48,11 @@ func main() {
 			c.Render()
 			continue
 		}
+		if *metrics {
+			fmt.Printf("%s:\t%s\n", file, c)
+			c.Metrics().Print(os.Stdout)
+			continue
+		}
 
 		fmt.Printf("digraph circuit\n{\n")
 		fmt.Printf("  overlap=scale;\n")
@@ -69,3 +92,37 @@ func main() {
 		fmt.Printf("}\n")
 	}
 }
+
+func optimize(in, out string) error {
+	c, err := circuit.Parse(in)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s:\t%s\n", in, c)
+
+	opt, err := c.Optimize()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s:\t%s\n", out, opt)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if strings.HasSuffix(out, ".mpclc") {
+		err = opt.Marshal(w)
+	} else {
+		opt.MarshalBristol(w)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
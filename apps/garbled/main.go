@@ -17,20 +17,23 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strings"
 	"unicode"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/p2p"
 )
 
 var (
-	port    = ":8080"
-	verbose = false
-	debug   = false
+	port     = ":8080"
+	verbose  = false
+	debug    = false
+	warnings = utils.AllWarnings()
 )
 
 type input []string
@@ -50,6 +53,9 @@ var inputFlag input
 
 func init() {
 	flag.Var(&inputFlag, "i", "comma-separated list of circuit inputs")
+	flag.Var(&warnings, "W",
+		"comma-separated list of warnings: unused, imports, shadow, truncate,\n"+
+			"compare, all, none; prefix no- disables a warning")
 }
 
 func main() {
@@ -58,11 +64,30 @@ func main() {
 	compile := flag.Bool("circ", false, "compile MPCL to circuit")
 	circFormat := flag.String("format", "mpclc",
 		"circuit format: mpclc, bristol")
-	ssa := flag.Bool("ssa", false, "compile MPCL to SSA assembly")
+	fSSA := flag.Bool("ssa", false, "compile MPCL to SSA assembly")
 	dot := flag.Bool("dot", false, "create Graphviz DOT output")
-	optimize := flag.Int("O", 1, "optimization level")
+	prof := flag.Bool("prof", false,
+		"create source-level gate profile and pprof output")
+	optimize := flag.Int("O", 1,
+		"optimization level: 0 none, 1 SSA and gate optimizations,\n"+
+			"2 also common subexpression elimination")
+	lowMem := flag.Bool("lowmem", false,
+		"renumber circuit wires to minimize garbler and evaluator memory")
+	lowDepth := flag.Bool("lowdepth", false,
+		"create depth-optimized circuits for round-sensitive protocols")
 	fVerbose := flag.Bool("v", false, "verbose output")
 	fDebug := flag.Bool("d", false, "debug output")
+	diagJSON := flag.Bool("diag-json", false,
+		"output compiler diagnostics as JSON")
+	run := flag.Bool("run", false,
+		"run MPCL program in plaintext with the SSA interpreter")
+	trace := flag.Bool("trace", false, "trace SSA interpreter execution")
+	pkgPath := flag.String("pkgpath", "",
+		"MPCL package search path directories")
+	rules := flag.String("rules", "",
+		"comma-separated list of SSA peephole rule files")
+	verifyRules := flag.Bool("verify-rules", false,
+		"verify the soundness of the SSA peephole rules")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
 	bmr := flag.Int("bmr", -1, "semi-honest secure BMR protocol player number")
 	flag.Parse()
@@ -86,14 +111,22 @@ func main() {
 	}
 
 	params := &utils.Params{
-		Verbose: *fVerbose,
+		Verbose:         *fVerbose,
+		DiagnosticsJSON: *diagJSON,
+		Warnings:        warnings,
+		CircLowDepth:    *lowDepth,
 	}
+	if len(*pkgPath) > 0 {
+		params.PkgPath = filepath.SplitList(*pkgPath)
+	}
+	if len(*rules) > 0 {
+		params.PeepholeRules = strings.Split(*rules, ",")
+	}
+	params.VerifyPeepholeRules = *verifyRules
 	defer params.Close()
 
-	if *optimize > 0 {
-		params.OptPruneGates = true
-	}
-	if *ssa && !*compile {
+	params.SetOptLevel(*optimize)
+	if *fSSA && !*compile {
 		params.NoCircCompile = true
 	}
 
@@ -110,11 +143,42 @@ func main() {
 		return
 	}
 
+	if *verifyRules && len(flag.Args()) == 0 {
+		loaded, err := ssa.LoadRules(params)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Verified %d peephole rules\n", len(loaded))
+		return
+	}
+
 	if len(flag.Args()) == 0 {
 		fmt.Printf("No input files\n")
 		os.Exit(1)
 	}
 
+	if flag.Args()[0] == "test" {
+		ok, err := testMode(params, flag.Args()[1:])
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *run {
+		err = runMode(params, inputFlag, flag.Args(), *trace)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	for _, arg := range flag.Args() {
 		if strings.HasSuffix(arg, ".circ") ||
 			strings.HasSuffix(arg, ".bristol") ||
@@ -125,7 +189,7 @@ func main() {
 				return
 			}
 		} else if strings.HasSuffix(arg, ".mpcl") {
-			if *ssa {
+			if *fSSA {
 				params.SSAOut, err = makeOutput(arg, "ssa")
 				if err != nil {
 					fmt.Printf("Failed to create SSA file: %s\n", err)
@@ -155,9 +219,23 @@ func main() {
 					}
 				}
 			}
+			if *prof {
+				params.ProfOut, err = makeOutput(arg, "prof")
+				if err != nil {
+					fmt.Printf("Failed to create profile file: %s\n", err)
+					return
+				}
+				params.PprofOut, err = makeOutput(arg, "pprof")
+				if err != nil {
+					fmt.Printf("Failed to create pprof file: %s\n", err)
+					return
+				}
+			}
 			circ, _, err = compiler.NewCompiler(params).CompileFile(arg)
 			if err != nil {
-				fmt.Printf("%s\n", err)
+				if !params.DiagnosticsJSON {
+					fmt.Printf("%s\n", err)
+				}
 				return
 			}
 		} else {
@@ -168,9 +246,10 @@ func main() {
 
 	if verbose && circ != nil {
 		fmt.Printf("Circuit: %v\n", circ)
+		fmt.Printf("Metrics: %v\n", circ.Metrics())
 	}
 
-	if *ssa || *compile || *stream {
+	if *fSSA || *compile || *stream || *prof {
 		return
 	}
 
@@ -226,6 +305,21 @@ func main() {
 		i2t = "- "
 	}
 
+	if *lowMem {
+		// The garbler and evaluator must both renumber the
+		// circuit. The protocol handshake compares the circuit
+		// digests and rejects mismatching circuits.
+		numWires := circ.NumWires
+		circ, err = circ.Renumber()
+		if err != nil {
+			fmt.Printf("Failed to renumber circuit: %s\n", err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("Renumbered: %v (%d wires before)\n", circ, numWires)
+		}
+	}
+
 	fmt.Printf(" %sIn1: %s\n", i1t, circ.Inputs[0])
 	fmt.Printf(" %sIn2: %s\n", i2t, circ.Inputs[1])
 	fmt.Printf(" - Out: %s\n", circ.Outputs)
@@ -297,6 +391,52 @@ func garblerMode(circ *circuit.Circuit, input *big.Int) error {
 	return nil
 }
 
+// runMode runs the MPCL program with the SSA interpreter. The input
+// values are given for all program inputs, and for each field of
+// compound inputs.
+func runMode(params *utils.Params, inputFlag, args []string,
+	trace bool) error {
+
+	if len(args) != 1 || !strings.HasSuffix(args[0], ".mpcl") {
+		return fmt.Errorf("run mode takes one MPCL file")
+	}
+	program, _, err := compiler.NewCompiler(params).CompileSSAFile(args[0])
+	if err != nil {
+		return err
+	}
+	var ios circuit.IO
+	for _, io := range program.Inputs {
+		if len(io.Compound) > 0 {
+			ios = append(ios, io.Compound...)
+		} else {
+			ios = append(ios, io)
+		}
+	}
+	if len(inputFlag) != len(ios) {
+		return fmt.Errorf("invalid inputs: got %d, expected %d: %s",
+			len(inputFlag), len(ios), ios)
+	}
+	var inputs []*big.Int
+	for idx, io := range ios {
+		input, err := io.Parse(inputFlag[idx : idx+1])
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input)
+	}
+
+	var traceOut io.Writer
+	if trace {
+		traceOut = os.Stdout
+	}
+	results, err := program.Run(inputs, traceOut)
+	if err != nil {
+		return err
+	}
+	printResult(results, program.Outputs)
+	return nil
+}
+
 func printResult(results []*big.Int, outputs circuit.IO) {
 	for idx, result := range results {
 		if outputs == nil {
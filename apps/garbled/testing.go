@@ -0,0 +1,82 @@
+//
+// testing.go
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// testMode runs the MPCL unit tests of the argument package
+// directories. The directory suffix "/..." selects the directory and
+// all its subdirectories. The function returns false if any of the
+// tests failed.
+func testMode(params *utils.Params, args []string) (bool, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var dirs []string
+	for _, arg := range args {
+		if arg != "..." && !strings.HasSuffix(arg, "/...") {
+			dirs = append(dirs, arg)
+			continue
+		}
+		root := strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+		if len(root) == 0 {
+			root = "."
+		}
+		err := filepath.Walk(root, func(p string, info os.FileInfo,
+			err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				dirs = append(dirs, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	success := true
+	for _, dir := range dirs {
+		start := time.Now()
+		results, err := compiler.NewCompiler(params).RunTests(dir)
+		if err != nil {
+			return false, err
+		}
+		if len(results) == 0 {
+			continue
+		}
+		pass := true
+		for _, r := range results {
+			if verbose || !r.Pass {
+				fmt.Println(r)
+			}
+			if !r.Pass {
+				pass = false
+			}
+		}
+		if pass {
+			fmt.Printf("ok  \t%s\t%.3fs\n", dir, time.Since(start).Seconds())
+		} else {
+			fmt.Printf("FAIL\t%s\t%.3fs\n", dir, time.Since(start).Seconds())
+			success = false
+		}
+	}
+	return success, nil
+}
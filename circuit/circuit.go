@@ -9,6 +9,8 @@ package circuit
 import (
 	"fmt"
 	"math/big"
+	"math/rand"
+	"strings"
 )
 
 // Operation specifies gate function.
@@ -67,12 +69,7 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 				fmt.Errorf("invalid amount of arguments, got %d, expected 1",
 					len(inputs))
 		}
-		i := new(big.Int)
-		_, ok := i.SetString(inputs[0], 0)
-		if !ok {
-			return nil, fmt.Errorf("invalid input: %s", inputs[0])
-		}
-		return i, nil
+		return io.parseValue(inputs[0])
 	}
 	if len(inputs) != len(io.Compound) {
 		return nil,
@@ -84,11 +81,9 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 	var offset int
 
 	for idx, arg := range io.Compound {
-		i := new(big.Int)
-		// XXX Type checks
-		_, ok := i.SetString(inputs[idx], 0)
-		if !ok {
-			return nil, fmt.Errorf("invalid input: %s", inputs[idx])
+		i, err := arg.parseValue(inputs[idx])
+		if err != nil {
+			return nil, err
 		}
 		i.Lsh(i, uint(offset))
 		result.Or(result, i)
@@ -98,6 +93,31 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 	return result, nil
 }
 
+// parseValue parses the input value of a single argument. The string
+// arguments are parsed as text where the first character is in the
+// least significant byte.
+func (io IOArg) parseValue(input string) (*big.Int, error) {
+	i := new(big.Int)
+	if strings.HasPrefix(io.Type, "string") {
+		data := []byte(input)
+		if len(data)*8 > io.Size {
+			return nil, fmt.Errorf("input too long for %s: %s",
+				io.Type, input)
+		}
+		for idx := len(data) - 1; idx >= 0; idx-- {
+			i.Lsh(i, 8)
+			i.Or(i, big.NewInt(int64(data[idx])))
+		}
+		return i, nil
+	}
+	// XXX Type checks
+	_, ok := i.SetString(input, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid input: %s", input)
+	}
+	return i, nil
+}
+
 // IO specifies circuit input and output arguments.
 type IO []IOArg
 
@@ -142,6 +162,23 @@ func (io IO) Split(in *big.Int) []*big.Int {
 	return result
 }
 
+// Random creates random values for the I/O arguments from the random
+// source rnd. Each value is zero with the probability 1/8 so that the
+// random values cover also the zero arguments.
+func (io IO) Random(rnd *rand.Rand) []*big.Int {
+	var result []*big.Int
+	for _, arg := range io {
+		v := new(big.Int)
+		if rnd.Intn(8) != 0 {
+			for i := 0; i < arg.Size; i++ {
+				v.SetBit(v, i, uint(rnd.Intn(2)))
+			}
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
 // Circuit specifies a boolean circuit.
 type Circuit struct {
 	NumGates int
@@ -9,6 +9,7 @@
 package circuit
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"fmt"
 	"math/big"
@@ -29,10 +30,33 @@ func Evaluator(conn *p2p.Conn, circ *Circuit, inputs *big.Int, verbose bool) (
 
 	garbled := make([][]ot.Label, circ.NumGates)
 
-	// Receive program info.
+	// Receive program info and verify that the garbler has the
+	// same circuit.
 	if verbose {
 		fmt.Printf(" - Waiting for circuit info...\n")
 	}
+	digest, err := circ.Digest()
+	if err != nil {
+		return nil, err
+	}
+	peerDigest, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	match := bytes.Equal(digest, peerDigest)
+	var ok byte
+	if match {
+		ok = 1
+	}
+	if err := conn.SendByte(ok); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, fmt.Errorf("circuit mismatch: garbler circuit differs")
+	}
 	key, err := conn.ReceiveData()
 	if err != nil {
 		return nil, err
@@ -48,12 +48,32 @@ func Garbler(conn *p2p.Conn, circ *Circuit, inputs *big.Int, verbose bool) (
 	[]*big.Int, error) {
 
 	timing := NewTiming()
+
+	// Verify that the evaluator has the same circuit.
+	digest, err := circ.Digest()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SendData(digest); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	ok, err := conn.ReceiveByte()
+	if err != nil {
+		return nil, err
+	}
+	if ok == 0 {
+		return nil, fmt.Errorf("circuit mismatch: evaluator circuit differs")
+	}
+
 	if verbose {
 		fmt.Printf(" - Garbling...\n")
 	}
 
 	var key [32]byte
-	_, err := rand.Read(key[:])
+	_, err = rand.Read(key[:])
 	if err != nil {
 		return nil, err
 	}
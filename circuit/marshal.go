@@ -7,6 +7,7 @@
 package circuit
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -71,6 +72,17 @@ func (c *Circuit) Marshal(out io.Writer) error {
 	return nil
 }
 
+// Digest computes the SHA-256 digest of the circuit's MPCL circuit
+// format encoding. The garbler and evaluator use the digest to verify
+// that they run the protocol with identical circuits.
+func (c *Circuit) Digest() ([]byte, error) {
+	h := sha256.New()
+	if err := c.Marshal(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
 func marshalIOArg(out io.Writer, arg IOArg) error {
 	if err := marshalString(out, arg.Name); err != nil {
 		return err
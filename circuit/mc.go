@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"sync"
+)
+
+// affine specifies an affine function of 3 variables. The bits 0-2
+// select the variables and the bit 3 is the constant term.
+type affine uint8
+
+func (a affine) table() uint8 {
+	var t uint8
+	if a&8 != 0 {
+		t = 0xff
+	}
+	for i := 0; i < 3; i++ {
+		if a&(1<<i) != 0 {
+			t ^= leafTables[i]
+		}
+	}
+	return t
+}
+
+func (a affine) build(g *xag, leaves [3]lit) lit {
+	r := litFalse
+	if a&8 != 0 {
+		r = litTrue
+	}
+	for i := 0; i < 3; i++ {
+		if a&(1<<i) != 0 {
+			r = g.xor(r, leaves[i])
+		}
+	}
+	return r
+}
+
+// mcImpl implements a 3-input boolean function with the minimum number
+// of AND gates. The function is computed as:
+//
+//	g1 = a AND b
+//	g2 = (c XOR alpha*g1) AND (d XOR beta*g1)
+//	f  = e XOR gamma*g1 XOR g2
+//
+// where a, b, c, d, and e are affine functions of the inputs, and the
+// number of AND gates ands specifies which terms are used.
+type mcImpl struct {
+	ands               int
+	a, b, c, d, e      affine
+	alpha, beta, gamma bool
+}
+
+func (impl *mcImpl) build(g *xag, leaves [3]lit) lit {
+	f := impl.e.build(g, leaves)
+	if impl.ands == 0 {
+		return f
+	}
+	g1 := g.and(impl.a.build(g, leaves), impl.b.build(g, leaves))
+	if impl.ands == 1 {
+		return g.xor(f, g1)
+	}
+	c := impl.c.build(g, leaves)
+	if impl.alpha {
+		c = g.xor(c, g1)
+	}
+	d := impl.d.build(g, leaves)
+	if impl.beta {
+		d = g.xor(d, g1)
+	}
+	if impl.gamma {
+		f = g.xor(f, g1)
+	}
+	return g.xor(f, g.and(c, d))
+}
+
+var (
+	mcOnce  sync.Once
+	mcImpls [256]mcImpl
+)
+
+// mcTable returns the minimum multiplicative complexity
+// implementations of all 3-input boolean functions, indexed by their
+// truth tables. All 3-input functions can be implemented with at most
+// two AND gates.
+func mcTable() *[256]mcImpl {
+	mcOnce.Do(func() {
+		var seen [256]bool
+		set := func(t uint8, impl mcImpl) {
+			if !seen[t] {
+				seen[t] = true
+				mcImpls[t] = impl
+			}
+		}
+		for e := affine(0); e < 16; e++ {
+			set(e.table(), mcImpl{
+				e: e,
+			})
+		}
+		for a := affine(0); a < 16; a++ {
+			for b := a; b < 16; b++ {
+				g1 := a.table() & b.table()
+				for e := affine(0); e < 16; e++ {
+					set(g1^e.table(), mcImpl{
+						ands: 1,
+						a:    a,
+						b:    b,
+						e:    e,
+					})
+				}
+			}
+		}
+		for a := affine(0); a < 16; a++ {
+			for b := a; b < 16; b++ {
+				g1 := a.table() & b.table()
+				for c := affine(0); c < 16; c++ {
+					for d := affine(0); d < 16; d++ {
+						for flags := 0; flags < 8; flags++ {
+							alpha := flags&1 != 0
+							beta := flags&2 != 0
+							gamma := flags&4 != 0
+							ct := c.table()
+							if alpha {
+								ct ^= g1
+							}
+							dt := d.table()
+							if beta {
+								dt ^= g1
+							}
+							g2 := ct & dt
+							if gamma {
+								g2 ^= g1
+							}
+							for e := affine(0); e < 16; e++ {
+								set(g2^e.table(), mcImpl{
+									ands:  2,
+									a:     a,
+									b:     b,
+									c:     c,
+									d:     d,
+									e:     e,
+									alpha: alpha,
+									beta:  beta,
+									gamma: gamma,
+								})
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+	return &mcImpls
+}
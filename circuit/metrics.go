@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/markkurossi/tabulate"
+)
+
+// Metrics contains the structural metrics of a circuit.
+type Metrics struct {
+	// ANDDepth is the multiplicative depth of the circuit: the
+	// maximum number of non-linear AND and OR gates on any path from
+	// the inputs to the outputs.
+	ANDDepth int
+	// Depth is the length of the critical path of the circuit: the
+	// maximum number of gates on any path from the inputs to the
+	// outputs.
+	Depth int
+	// Layers contains the gate counts of the AND layers. The layer i
+	// holds the AND and OR gates at the multiplicative depth i and the
+	// free gates computed from their outputs. The layer 0 holds the
+	// free gates computed from the inputs.
+	Layers []map[Operation]int
+	// MaxFanOut is the maximum number of gate inputs reading a wire.
+	MaxFanOut int
+	// AvgFanOut is the average number of gate inputs reading a wire,
+	// computed over the wires read by at least one gate.
+	AvgFanOut float64
+	// PeakLive is the maximum number of wires that are live at the
+	// same time when the gates are evaluated in order. A wire is live
+	// from the gate computing it until the last gate reading it. The
+	// input wires are live from the start of the evaluation until
+	// their last use and the output wires until the end.
+	PeakLive int
+}
+
+func (m *Metrics) String() string {
+	return fmt.Sprintf("AND-depth=%d depth=%d fan-out=%d/%.2f live=%d",
+		m.ANDDepth, m.Depth, m.MaxFanOut, m.AvgFanOut, m.PeakLive)
+}
+
+// Print prints the metrics and the gate counts of the AND layers.
+func (m *Metrics) Print(o io.Writer) {
+	fmt.Fprintf(o, "AND-depth:\t%d\n", m.ANDDepth)
+	fmt.Fprintf(o, "Depth:\t\t%d\n", m.Depth)
+	fmt.Fprintf(o, "Fan-out:\tmax=%d, avg=%.2f\n", m.MaxFanOut, m.AvgFanOut)
+	fmt.Fprintf(o, "Peak live:\t%d wires\n", m.PeakLive)
+
+	tab := tabulate.New(tabulate.Unicode)
+	tab.Header("Layer").SetAlign(tabulate.MR)
+	for op := XOR; op <= INV; op++ {
+		tab.Header(op.String()).SetAlign(tabulate.MR)
+	}
+	for i, layer := range m.Layers {
+		row := tab.Row()
+		row.Column(fmt.Sprintf("%d", i))
+		for op := XOR; op <= INV; op++ {
+			row.Column(fmt.Sprintf("%d", layer[op]))
+		}
+	}
+	tab.Print(o)
+}
+
+// Metrics computes the structural metrics of the circuit.
+func (c *Circuit) Metrics() *Metrics {
+	m := new(Metrics)
+
+	andDepth := make([]int, c.NumWires)
+	depth := make([]int, c.NumWires)
+	fanOut := make([]int, c.NumWires)
+	lastUse := make([]int, c.NumWires)
+
+	for i := range lastUse {
+		lastUse[i] = -1
+	}
+
+	for i, gate := range c.Gates {
+		var ad, d int
+		for _, in := range gate.Inputs() {
+			if andDepth[in] > ad {
+				ad = andDepth[in]
+			}
+			if depth[in] > d {
+				d = depth[in]
+			}
+			fanOut[in]++
+			lastUse[in] = i
+		}
+		if gate.Op == AND || gate.Op == OR {
+			ad++
+		}
+		d++
+		andDepth[gate.Output] = ad
+		depth[gate.Output] = d
+
+		if ad > m.ANDDepth {
+			m.ANDDepth = ad
+		}
+		if d > m.Depth {
+			m.Depth = d
+		}
+		for len(m.Layers) <= ad {
+			m.Layers = append(m.Layers, make(map[Operation]int))
+		}
+		m.Layers[ad][gate.Op]++
+	}
+
+	var read, inputs int
+	for _, count := range fanOut {
+		if count > m.MaxFanOut {
+			m.MaxFanOut = count
+		}
+		if count > 0 {
+			read++
+			inputs += count
+		}
+	}
+	if read > 0 {
+		m.AvgFanOut = float64(inputs) / float64(read)
+	}
+
+	// The number of wires becoming live and dead at each gate. The
+	// input wires are live from the start and the output wires
+	// until the end.
+	births := make([]int, len(c.Gates)+1)
+	deaths := make([]int, len(c.Gates)+1)
+	outputs := c.NumWires - c.Outputs.Size()
+	births[0] = c.Inputs.Size()
+	for i := 0; i < c.Inputs.Size(); i++ {
+		if i >= outputs {
+			continue
+		}
+		if lastUse[i] < 0 {
+			deaths[0]++
+		} else {
+			deaths[lastUse[i]+1]++
+		}
+	}
+	for i, gate := range c.Gates {
+		births[i+1]++
+		if gate.Output.ID() >= outputs {
+			continue
+		}
+		if lastUse[gate.Output] > i {
+			deaths[lastUse[gate.Output]+1]++
+		} else {
+			deaths[i+1]++
+		}
+	}
+
+	var live int
+	for i := range births {
+		live += births[i]
+		if live > m.PeakLive {
+			m.PeakLive = live
+		}
+		live -= deaths[i]
+	}
+
+	return m
+}
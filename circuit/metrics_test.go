@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var metricsTests = []struct {
+	circ    string
+	metrics Metrics
+}{
+	{
+		// Majority of three with AND and OR gates.
+		circ: `5 8
+3 1 1 1
+1 1
+
+2 1 0 1 3 AND
+2 1 0 2 4 AND
+2 1 1 2 5 AND
+2 1 3 4 6 OR
+2 1 6 5 7 OR
+`,
+		metrics: Metrics{
+			ANDDepth: 3,
+			Depth:    3,
+			Layers: []map[Operation]int{
+				{},
+				{AND: 3},
+				{OR: 1},
+				{OR: 1},
+			},
+			MaxFanOut: 2,
+			AvgFanOut: 10.0 / 7.0,
+			PeakLive:  5,
+		},
+	},
+	{
+		// NOT (a XOR b) AND a
+		circ: `3 5
+2 1 1
+1 1
+
+2 1 0 1 2 XOR
+1 1 2 3 INV
+2 1 3 0 4 AND
+`,
+		metrics: Metrics{
+			ANDDepth: 1,
+			Depth:    3,
+			Layers: []map[Operation]int{
+				{XOR: 1, INV: 1},
+				{AND: 1},
+			},
+			MaxFanOut: 2,
+			AvgFanOut: 5.0 / 4.0,
+			PeakLive:  3,
+		},
+	},
+}
+
+func TestMetrics(t *testing.T) {
+	for idx, test := range metricsTests {
+		circ, err := ParseBristol(bytes.NewReader([]byte(test.circ)))
+		if err != nil {
+			t.Fatalf("test %d: ParseBristol: %s", idx, err)
+		}
+		m := circ.Metrics()
+		if !reflect.DeepEqual(*m, test.metrics) {
+			t.Errorf("test %d: got %v %v, expected %v %v", idx,
+				m, m.Layers, &test.metrics, test.metrics.Layers)
+		}
+	}
+}
@@ -0,0 +1,703 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+)
+
+const (
+	// Maximum number of cuts per node.
+	maxCuts = 16
+	// Maximum number of rewrite rounds.
+	maxRounds = 8
+	// Number of random test vectors for equivalence verification.
+	verifyVectors = 64
+)
+
+// Optimize rewrites the circuit to minimize the number of its non-free
+// gates. With the free-XOR garbling, the XOR and XNOR gates are free
+// and only the AND, OR, and INV gates cost bandwidth and computation.
+//
+// The optimizer converts the circuit into a graph of AND and XOR
+// nodes with inverted edges: OR is rewritten as a AND b XOR a XOR b,
+// XNOR as inverted XOR, and INV as an inverted edge. The nodes are
+// then rewritten with cut-based multiplicative complexity rewriting:
+// the function of each 3-input cut of a node is replaced with its
+// implementation using the minimum number of AND gates, if that
+// saves AND gates. Finally, the inversions are implemented with XNOR
+// gates. The optimized circuit has the same inputs and outputs as the
+// original circuit and their equivalence is verified with Compute on
+// random input vectors.
+func (c *Circuit) Optimize() (*Circuit, error) {
+	g, err := newXAG(c)
+	if err != nil {
+		return nil, err
+	}
+	for round := 0; round < maxRounds; round++ {
+		n := g.rewrite()
+		if n.numAnds() >= g.numAnds() {
+			break
+		}
+		g = n
+	}
+	result, err := g.circuit(c.Inputs, c.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	if result.Cost() > c.Cost() {
+		result = c
+	}
+	err = c.Equivalent(result, verifyVectors)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Equivalent tests if the circuits c and o compute the same function.
+// The circuits are evaluated with Compute on the number of random
+// input vectors. The function returns an error describing the first
+// mismatch, or nil if the circuits agree on all vectors.
+func (c *Circuit) Equivalent(o *Circuit, vectors int) error {
+	if c.Inputs.String() != o.Inputs.String() ||
+		c.Inputs.Size() != o.Inputs.Size() {
+		return fmt.Errorf("inputs differ: %s, %s", c.Inputs, o.Inputs)
+	}
+	if c.Outputs.String() != o.Outputs.String() ||
+		c.Outputs.Size() != o.Outputs.Size() {
+		return fmt.Errorf("outputs differ: %s, %s", c.Outputs, o.Outputs)
+	}
+
+	var args IO
+	for _, io := range c.Inputs {
+		if len(io.Compound) > 0 {
+			args = append(args, io.Compound...)
+		} else {
+			args = append(args, io)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(int64(c.NumGates)))
+	for i := 0; i < vectors; i++ {
+		var inputs []*big.Int
+		for _, arg := range args {
+			v := new(big.Int)
+			for bit := 0; bit < arg.Size; bit++ {
+				// The first vectors are all zeroes and all ones.
+				var b uint
+				switch i {
+				case 0:
+				case 1:
+					b = 1
+				default:
+					b = uint(rnd.Intn(2))
+				}
+				v.SetBit(v, bit, b)
+			}
+			inputs = append(inputs, v)
+		}
+		r1, err := c.Compute(inputs)
+		if err != nil {
+			return err
+		}
+		r2, err := o.Compute(inputs)
+		if err != nil {
+			return err
+		}
+		for idx := range r1 {
+			if r1[idx].Cmp(r2[idx]) != 0 {
+				return fmt.Errorf("output %d differs for inputs %v: %x != %x",
+					idx, inputs, r1[idx], r2[idx])
+			}
+		}
+	}
+	return nil
+}
+
+// lit is a reference to an XAG node. The lowest bit of the literal
+// specifies if the reference is inverted.
+type lit uint32
+
+func makeLit(node int, inverted bool) lit {
+	l := lit(node << 1)
+	if inverted {
+		l |= 1
+	}
+	return l
+}
+
+func (l lit) node() int {
+	return int(l >> 1)
+}
+
+func (l lit) inverted() bool {
+	return l&1 != 0
+}
+
+const (
+	litFalse lit = 0
+	litTrue  lit = 1
+)
+
+type xagNode struct {
+	op   Operation
+	a, b lit
+}
+
+// xag implements an XOR-AND graph. The node 0 is the constant zero,
+// nodes 1...numInputs are the circuit inputs, and the rest of the nodes
+// are AND and XOR nodes in topological order.
+type xag struct {
+	numInputs int
+	nodes     []xagNode
+	outputs   []lit
+	hash      map[xagNode]lit
+}
+
+func newEmptyXAG(numInputs int) *xag {
+	g := &xag{
+		numInputs: numInputs,
+		nodes:     make([]xagNode, numInputs+1),
+		hash:      make(map[xagNode]lit),
+	}
+	return g
+}
+
+func newXAG(c *Circuit) (*xag, error) {
+	numInputs := c.Inputs.Size()
+	if numInputs == 0 {
+		return nil, fmt.Errorf("no inputs defined")
+	}
+	g := newEmptyXAG(numInputs)
+
+	wires := make([]lit, c.NumWires)
+	defined := make([]bool, c.NumWires)
+	for i := 0; i < numInputs; i++ {
+		wires[i] = makeLit(i+1, false)
+		defined[i] = true
+	}
+	input := func(w Wire) (lit, error) {
+		if int(w) >= c.NumWires || !defined[w] {
+			return 0, fmt.Errorf("wire %d used before it is defined", w)
+		}
+		return wires[w], nil
+	}
+
+	for _, gate := range c.Gates {
+		a, err := input(gate.Input0)
+		if err != nil {
+			return nil, err
+		}
+		var b lit
+		if gate.Op != INV {
+			b, err = input(gate.Input1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var r lit
+		switch gate.Op {
+		case XOR:
+			r = g.xor(a, b)
+		case XNOR:
+			r = g.xor(a, b) ^ 1
+		case AND:
+			r = g.and(a, b)
+		case OR:
+			r = g.xor(g.xor(a, b), g.and(a, b))
+		case INV:
+			r = a ^ 1
+		default:
+			return nil, fmt.Errorf("invalid gate %s", gate.Op)
+		}
+		if int(gate.Output) >= c.NumWires {
+			return nil, fmt.Errorf("invalid output wire %d", gate.Output)
+		}
+		wires[gate.Output] = r
+		defined[gate.Output] = true
+	}
+	for w := c.NumWires - c.Outputs.Size(); w < c.NumWires; w++ {
+		if w < 0 || !defined[w] {
+			return nil, fmt.Errorf("output wire %d not defined", w)
+		}
+		g.outputs = append(g.outputs, wires[w])
+	}
+	return g, nil
+}
+
+func (g *xag) isGate(node int) bool {
+	return node > g.numInputs
+}
+
+func (g *xag) add(n xagNode) lit {
+	l, ok := g.hash[n]
+	if !ok {
+		l = makeLit(len(g.nodes), false)
+		g.nodes = append(g.nodes, n)
+		g.hash[n] = l
+	}
+	return l
+}
+
+func (g *xag) and(a, b lit) lit {
+	if a > b {
+		a, b = b, a
+	}
+	switch {
+	case a == litFalse:
+		return litFalse
+	case a == litTrue:
+		return b
+	case a == b:
+		return a
+	case a == b^1:
+		return litFalse
+	}
+	return g.add(xagNode{
+		op: AND,
+		a:  a,
+		b:  b,
+	})
+}
+
+func (g *xag) xor(a, b lit) lit {
+	inv := (a ^ b) & 1
+	a &^= 1
+	b &^= 1
+	if a > b {
+		a, b = b, a
+	}
+	switch {
+	case a == litFalse:
+		return b ^ inv
+	case a == b:
+		return litFalse ^ inv
+	}
+	return g.add(xagNode{
+		op: XOR,
+		a:  a,
+		b:  b,
+	}) ^ inv
+}
+
+// reachable returns the nodes reachable from the graph outputs.
+func (g *xag) reachable() []bool {
+	live := make([]bool, len(g.nodes))
+	for _, o := range g.outputs {
+		live[o.node()] = true
+	}
+	for i := len(g.nodes) - 1; i > g.numInputs; i-- {
+		if live[i] {
+			live[g.nodes[i].a.node()] = true
+			live[g.nodes[i].b.node()] = true
+		}
+	}
+	return live
+}
+
+func (g *xag) numAnds() int {
+	var count int
+	for i, live := range g.reachable() {
+		if live && g.isGate(i) && g.nodes[i].op == AND {
+			count++
+		}
+	}
+	return count
+}
+
+type cut struct {
+	size   int
+	leaves [3]int
+}
+
+func (c cut) index(node int) int {
+	for i := 0; i < c.size; i++ {
+		if c.leaves[i] == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// merge merges the cuts a and b. The function returns false if the
+// merged cut has more than 3 leaves.
+func mergeCuts(a, b cut) (cut, bool) {
+	var r cut
+	i, j := 0, 0
+	for i < a.size || j < b.size {
+		var v int
+		switch {
+		case j >= b.size || (i < a.size && a.leaves[i] < b.leaves[j]):
+			v = a.leaves[i]
+			i++
+		case i >= a.size || b.leaves[j] < a.leaves[i]:
+			v = b.leaves[j]
+			j++
+		default:
+			v = a.leaves[i]
+			i++
+			j++
+		}
+		if r.size >= len(r.leaves) {
+			return r, false
+		}
+		r.leaves[r.size] = v
+		r.size++
+	}
+	return r, true
+}
+
+// cuts enumerates the cuts of the node n with at most 3 leaves.
+func (g *xag) cuts(n int, all [][]cut) []cut {
+	trivial := cut{
+		size:   1,
+		leaves: [3]int{n},
+	}
+	if n == 0 {
+		return []cut{{}}
+	}
+	if !g.isGate(n) {
+		return []cut{trivial}
+	}
+	node := g.nodes[n]
+	result := []cut{trivial}
+	for _, ca := range all[node.a.node()] {
+		for _, cb := range all[node.b.node()] {
+			c, ok := mergeCuts(ca, cb)
+			if !ok {
+				continue
+			}
+			var dup bool
+			for _, o := range result {
+				if o == c {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				result = append(result, c)
+				if len(result) >= maxCuts {
+					return result
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Truth tables of the cut leaves.
+var leafTables = [3]uint8{0xaa, 0xcc, 0xf0}
+
+// truthTable computes the function of the node n over the cut's
+// leaves.
+func (g *xag) truthTable(n int, c cut, memo map[int]uint8) uint8 {
+	if i := c.index(n); i >= 0 {
+		return leafTables[i]
+	}
+	if n == 0 {
+		return 0
+	}
+	if t, ok := memo[n]; ok {
+		return t
+	}
+	node := g.nodes[n]
+	a := g.truthTable(node.a.node(), c, memo)
+	if node.a.inverted() {
+		a = ^a
+	}
+	b := g.truthTable(node.b.node(), c, memo)
+	if node.b.inverted() {
+		b = ^b
+	}
+	var t uint8
+	if node.op == AND {
+		t = a & b
+	} else {
+		t = a ^ b
+	}
+	memo[n] = t
+	return t
+}
+
+// deref removes the reference of the node n to its children and
+// returns the number of AND nodes that are freed up to the cut
+// leaves.
+func (g *xag) deref(n int, c cut, refs []int) int {
+	var count int
+	node := g.nodes[n]
+	if node.op == AND {
+		count++
+	}
+	for _, child := range []int{node.a.node(), node.b.node()} {
+		if !g.isGate(child) || c.index(child) >= 0 {
+			continue
+		}
+		refs[child]--
+		if refs[child] == 0 {
+			count += g.deref(child, c, refs)
+		}
+	}
+	return count
+}
+
+// reref restores the references removed by deref.
+func (g *xag) reref(n int, c cut, refs []int) {
+	node := g.nodes[n]
+	for _, child := range []int{node.a.node(), node.b.node()} {
+		if !g.isGate(child) || c.index(child) >= 0 {
+			continue
+		}
+		if refs[child] == 0 {
+			g.reref(child, c, refs)
+		}
+		refs[child]++
+	}
+}
+
+// rewrite rewrites the nodes of the graph with their minimum
+// multiplicative complexity implementations. The function returns
+// the rewritten graph.
+func (g *xag) rewrite() *xag {
+	live := g.reachable()
+
+	refs := make([]int, len(g.nodes))
+	for i := g.numInputs + 1; i < len(g.nodes); i++ {
+		if live[i] {
+			refs[g.nodes[i].a.node()]++
+			refs[g.nodes[i].b.node()]++
+		}
+	}
+	for _, o := range g.outputs {
+		refs[o.node()]++
+	}
+
+	n := newEmptyXAG(g.numInputs)
+	mapping := make([]lit, len(g.nodes))
+	for i := 1; i <= g.numInputs; i++ {
+		mapping[i] = makeLit(i, false)
+	}
+	m := func(l lit) lit {
+		return mapping[l.node()] ^ (l & 1)
+	}
+
+	cuts := make([][]cut, len(g.nodes))
+	table := mcTable()
+
+	for i := 0; i < len(g.nodes); i++ {
+		if !live[i] {
+			continue
+		}
+		cuts[i] = g.cuts(i, cuts)
+		if !g.isGate(i) {
+			continue
+		}
+		node := g.nodes[i]
+
+		var best *mcImpl
+		var bestCut cut
+		var bestGain int
+		for _, c := range cuts[i][1:] {
+			t := g.truthTable(i, c, make(map[int]uint8))
+			impl := &table[t]
+			freed := g.deref(i, c, refs)
+			g.reref(i, c, refs)
+			gain := freed - impl.ands
+			if gain > bestGain {
+				best = impl
+				bestCut = c
+				bestGain = gain
+			}
+		}
+		if best == nil {
+			if node.op == AND {
+				mapping[i] = n.and(m(node.a), m(node.b))
+			} else {
+				mapping[i] = n.xor(m(node.a), m(node.b))
+			}
+			continue
+		}
+		var leaves [3]lit
+		for j := 0; j < bestCut.size; j++ {
+			leaves[j] = mapping[bestCut.leaves[j]]
+		}
+		mapping[i] = best.build(n, leaves)
+	}
+	for _, o := range g.outputs {
+		n.outputs = append(n.outputs, m(o))
+	}
+	return n
+}
+
+// circuit creates a circuit from the graph. The inverted edges are
+// implemented with XNOR gates.
+func (g *xag) circuit(inputs, outputs IO) (*Circuit, error) {
+	live := g.reachable()
+	numOutputs := outputs.Size()
+	if numOutputs != len(g.outputs) {
+		return nil, fmt.Errorf("invalid outputs")
+	}
+
+	// Gate nodes writing directly to output wires.
+	outputNode := make(map[int]int)
+	var needZero bool
+	for idx, o := range g.outputs {
+		_, ok := outputNode[o.node()]
+		if g.isGate(o.node()) && !o.inverted() && !ok {
+			outputNode[o.node()] = idx
+		} else {
+			needZero = true
+		}
+	}
+
+	// Count internal wires.
+	numWires := g.numInputs
+	inverted := make(map[int]bool)
+	for i := g.numInputs + 1; i < len(g.nodes); i++ {
+		if !live[i] {
+			continue
+		}
+		if _, ok := outputNode[i]; !ok {
+			numWires++
+		}
+		node := g.nodes[i]
+		if node.op == AND {
+			for _, l := range []lit{node.a, node.b} {
+				if l.inverted() {
+					inverted[l.node()] = true
+				}
+			}
+		}
+	}
+	if len(inverted) > 0 {
+		needZero = true
+	}
+	numWires += len(inverted)
+	if needZero {
+		numWires++
+	}
+	outputBase := numWires
+	numWires += numOutputs
+
+	wires := make([]Wire, len(g.nodes))
+	for i := 1; i <= g.numInputs; i++ {
+		wires[i] = Wire(i - 1)
+	}
+	next := Wire(g.numInputs)
+	alloc := func() Wire {
+		w := next
+		next++
+		return w
+	}
+
+	var gates []Gate
+	var zero Wire
+	if needZero {
+		zero = alloc()
+		gates = append(gates, Gate{
+			Input0: 0,
+			Input1: 0,
+			Output: zero,
+			Op:     XOR,
+		})
+	}
+	inverters := make(map[int]Wire)
+	input := func(l lit) Wire {
+		w := wires[l.node()]
+		if !l.inverted() {
+			return w
+		}
+		inv, ok := inverters[l.node()]
+		if !ok {
+			inv = alloc()
+			inverters[l.node()] = inv
+			gates = append(gates, Gate{
+				Input0: w,
+				Input1: zero,
+				Output: inv,
+				Op:     XNOR,
+			})
+		}
+		return inv
+	}
+
+	for i := g.numInputs + 1; i < len(g.nodes); i++ {
+		if !live[i] {
+			continue
+		}
+		node := g.nodes[i]
+		var o Wire
+		idx, ok := outputNode[i]
+		if ok {
+			o = Wire(outputBase + idx)
+		} else {
+			o = alloc()
+		}
+		wires[i] = o
+
+		if node.op == AND {
+			a := input(node.a)
+			b := input(node.b)
+			gates = append(gates, Gate{
+				Input0: a,
+				Input1: b,
+				Output: o,
+				Op:     AND,
+			})
+		} else {
+			op := XOR
+			if node.a.inverted() != node.b.inverted() {
+				op = XNOR
+			}
+			gates = append(gates, Gate{
+				Input0: wires[node.a.node()],
+				Input1: wires[node.b.node()],
+				Output: o,
+				Op:     op,
+			})
+		}
+	}
+	for idx, o := range g.outputs {
+		if n, ok := outputNode[o.node()]; ok && n == idx {
+			continue
+		}
+		w := zero
+		if o.node() != 0 {
+			w = wires[o.node()]
+		}
+		op := XOR
+		if o.inverted() {
+			op = XNOR
+		}
+		gates = append(gates, Gate{
+			Input0: w,
+			Input1: zero,
+			Output: Wire(outputBase + idx),
+			Op:     op,
+		})
+	}
+	if int(next) != outputBase {
+		return nil, fmt.Errorf("invalid number of wires: %d != %d",
+			next, outputBase)
+	}
+
+	stats := make(map[Operation]int)
+	for _, gate := range gates {
+		stats[gate.Op]++
+	}
+
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: numWires,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		Gates:    gates,
+		Stats:    stats,
+	}, nil
+}
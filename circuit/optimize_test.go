@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+var optimizeTests = []struct {
+	circ string
+	and  int
+	inv  int
+}{
+	{
+		// Majority of three with AND and OR gates.
+		circ: `5 8
+3 1 1 1
+1 1
+
+2 1 0 1 3 AND
+2 1 0 2 4 AND
+2 1 1 2 5 AND
+2 1 3 4 6 OR
+2 1 6 5 7 OR
+`,
+		and: 1,
+	},
+	{
+		// a AND NOT b, XNOR c
+		circ: `3 6
+3 1 1 1
+1 1
+
+1 1 1 3 INV
+2 1 0 3 4 AND
+2 1 4 2 5 XNOR
+`,
+		and: 1,
+	},
+	{
+		// Multiplexer with an inverted selector.
+		circ: `6 8
+3 1 1 1
+1 1
+
+1 1 0 3 INV
+2 1 0 1 4 AND
+2 1 3 2 5 AND
+2 1 4 5 6 OR
+1 1 6 7 INV
+1 1 7 7 INV
+`,
+		and: 1,
+	},
+}
+
+func TestOptimize(t *testing.T) {
+	for idx, test := range optimizeTests {
+		c, err := ParseBristol(bytes.NewReader([]byte(test.circ)))
+		if err != nil {
+			t.Fatalf("test %d: parse failed: %s", idx, err)
+		}
+		opt, err := c.Optimize()
+		if err != nil {
+			t.Fatalf("test %d: Optimize failed: %s", idx, err)
+		}
+		if opt.Stats[AND] != test.and || opt.Stats[OR] != 0 ||
+			opt.Stats[INV] != test.inv {
+			t.Errorf("test %d: unexpected circuit: %s", idx, opt)
+		}
+		if opt.Inputs.String() != c.Inputs.String() ||
+			opt.Outputs.String() != c.Outputs.String() {
+			t.Errorf("test %d: inputs or outputs changed", idx)
+		}
+
+		size := c.Inputs.Size()
+		for in := int64(0); in < 1<<size; in++ {
+			var inputs []*big.Int
+			for bit := 0; bit < size; bit++ {
+				inputs = append(inputs, big.NewInt((in>>bit)&1))
+			}
+			r1, err := c.Compute(inputs)
+			if err != nil {
+				t.Fatalf("test %d: Compute failed: %s", idx, err)
+			}
+			r2, err := opt.Compute(inputs)
+			if err != nil {
+				t.Fatalf("test %d: Compute failed: %s", idx, err)
+			}
+			if r1[0].Cmp(r2[0]) != 0 {
+				t.Errorf("test %d: input %b: got %v, expected %v",
+					idx, in, r2[0], r1[0])
+			}
+		}
+	}
+}
+
+func TestMCTable(t *testing.T) {
+	table := mcTable()
+	for f := 0; f < 256; f++ {
+		impl := &table[f]
+		if impl.ands > 2 {
+			t.Errorf("function %02x: %d AND gates", f, impl.ands)
+		}
+		g := newEmptyXAG(3)
+		l := impl.build(g, [3]lit{
+			makeLit(1, false),
+			makeLit(2, false),
+			makeLit(3, false),
+		})
+		c := cut{
+			size:   3,
+			leaves: [3]int{1, 2, 3},
+		}
+		tt := g.truthTable(l.node(), c, make(map[int]uint8))
+		if l.inverted() {
+			tt = ^tt
+		}
+		if int(tt) != f {
+			t.Errorf("function %02x: implementation computes %02x", f, tt)
+		}
+		g.outputs = []lit{l}
+		if g.numAnds() > impl.ands {
+			t.Errorf("function %02x: %d AND nodes, expected %d",
+				f, g.numAnds(), impl.ands)
+		}
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	and, err := ParseBristol(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	or := *and
+	or.Gates = []Gate{and.Gates[0]}
+	or.Gates[0].Op = OR
+	if err := and.Equivalent(&or, 8); err == nil {
+		t.Errorf("AND and OR are equivalent")
+	}
+	if err := and.Equivalent(and, 8); err != nil {
+		t.Errorf("AND is not equivalent with itself: %s", err)
+	}
+}
@@ -40,10 +40,16 @@ func Parse(file string) (*Circuit, error) {
 	}
 	defer f.Close()
 
+	return ParseReader(file, f)
+}
+
+// ParseReader parses the circuit from the input. The circuit format
+// is selected by the extension of the file name.
+func ParseReader(file string, in io.Reader) (*Circuit, error) {
 	if strings.HasSuffix(file, ".circ") || strings.HasSuffix(file, ".bristol") {
-		return ParseBristol(f)
+		return ParseBristol(in)
 	} else if strings.HasSuffix(file, ".mpclc") {
-		return ParseMPCLC(f)
+		return ParseMPCLC(in)
 	}
 	return nil, fmt.Errorf("unsupported circuit format")
 }
@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+)
+
+// Renumber reorders the gates of the circuit and reassigns its wire
+// IDs so that the IDs of the dead wires are reused by the following
+// gates. The input and output wires keep their IDs at the beginning
+// and at the end of the wire ID space, and the gates which do not
+// contribute to the outputs are removed. The number of wires of the
+// renumbered circuit is proportional to the number of live wires
+// instead of the number of gates so the memory needed by Eval,
+// Garble, and Compute shrinks accordingly. Since the wire IDs are
+// reused, the renumbered circuit can only be processed in the gate
+// order; for example, the BMR protocol needs the original
+// circuit. The gates are ordered in the original order or in the
+// depth-first order from the outputs, whichever needs fewer wires.
+func (c *Circuit) Renumber() (*Circuit, error) {
+	r, err := newRenumber(c)
+	if err != nil {
+		return nil, err
+	}
+
+	order := r.depthFirstOrder()
+	var orig []int
+	for g := range c.Gates {
+		if r.reachable[g] {
+			orig = append(orig, g)
+		}
+	}
+	slots, numSlots := r.allocWires(order)
+	origSlots, origNumSlots := r.allocWires(orig)
+	if origNumSlots <= numSlots {
+		order = orig
+		slots = origSlots
+		numSlots = origNumSlots
+	}
+
+	numInputs := c.Inputs.Size()
+	id := func(v int) Wire {
+		if v < numInputs {
+			return Wire(v)
+		}
+		if out, ok := r.outputs[v]; ok {
+			return Wire(numInputs + numSlots + out)
+		}
+		return Wire(numInputs + slots[v])
+	}
+
+	gates := make([]Gate, len(order))
+	stats := make(map[Operation]int)
+	for i, g := range order {
+		args := r.args[g]
+		gates[i] = Gate{
+			Input0: id(args[0]),
+			Output: id(numInputs + g),
+			Op:     c.Gates[g].Op,
+		}
+		if len(args) > 1 {
+			gates[i].Input1 = id(args[1])
+		}
+		stats[gates[i].Op]++
+	}
+
+	return &Circuit{
+		NumGates: len(gates),
+		NumWires: numInputs + numSlots + c.Outputs.Size(),
+		Inputs:   c.Inputs,
+		Outputs:  c.Outputs,
+		Gates:    gates,
+		Stats:    stats,
+	}, nil
+}
+
+// renumber holds the values of a circuit being renumbered. The values
+// 0...numInputs-1 are the input wires and the value numInputs+g is the
+// output of the gate g. The values are independent of the wire IDs so
+// the circuit can assign a wire many times.
+type renumber struct {
+	c         *Circuit
+	numInputs int
+	args      [][]int
+	depth     []int
+	outputs   map[int]int
+	outValues []int
+	reachable []bool
+}
+
+func newRenumber(c *Circuit) (*renumber, error) {
+	numInputs := c.Inputs.Size()
+	r := &renumber{
+		c:         c,
+		numInputs: numInputs,
+		args:      make([][]int, len(c.Gates)),
+		depth:     make([]int, numInputs+len(c.Gates)),
+		outputs:   make(map[int]int),
+	}
+
+	// The current values of the wires.
+	current := make([]int, c.NumWires)
+	for w := range current {
+		if w < numInputs {
+			current[w] = w
+		} else {
+			current[w] = -1
+		}
+	}
+	for g, gate := range c.Gates {
+		var d int
+		for _, in := range gate.Inputs() {
+			if int(in) >= c.NumWires || current[in] < 0 {
+				return nil, fmt.Errorf("wire %d used before it is defined",
+					in)
+			}
+			v := current[in]
+			r.args[g] = append(r.args[g], v)
+			if r.depth[v] > d {
+				d = r.depth[v]
+			}
+		}
+		if int(gate.Output) < numInputs || int(gate.Output) >= c.NumWires {
+			return nil, fmt.Errorf("invalid output wire %d", gate.Output)
+		}
+		current[gate.Output] = numInputs + g
+		r.depth[numInputs+g] = d + 1
+	}
+
+	outputs := c.NumWires - c.Outputs.Size()
+	for w := outputs; w < c.NumWires; w++ {
+		v := current[w]
+		if v < numInputs {
+			return nil, fmt.Errorf("output wire %d not defined", w)
+		}
+		r.outputs[v] = w - outputs
+		r.outValues = append(r.outValues, v)
+	}
+	return r, nil
+}
+
+// depthFirstOrder orders the gates computing the outputs in the
+// depth-first order from the outputs. The deeper input of a gate is
+// computed first so that its subtree's wires are dead when the other
+// input is computed. The function also marks the gates contributing
+// to the outputs reachable.
+func (r *renumber) depthFirstOrder() []int {
+	type frame struct {
+		gate int
+		args []int
+	}
+
+	r.reachable = make([]bool, len(r.c.Gates))
+	var order []int
+	var stack []frame
+
+	push := func(v int) {
+		g := v - r.numInputs
+		if g < 0 || r.reachable[g] {
+			return
+		}
+		r.reachable[g] = true
+		args := append([]int(nil), r.args[g]...)
+		if len(args) == 2 && r.depth[args[1]] > r.depth[args[0]] {
+			args[0], args[1] = args[1], args[0]
+		}
+		stack = append(stack, frame{
+			gate: g,
+			args: args,
+		})
+	}
+
+	for _, v := range r.outValues {
+		push(v)
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if len(top.args) > 0 {
+				v := top.args[0]
+				top.args = top.args[1:]
+				push(v)
+				continue
+			}
+			order = append(order, top.gate)
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return order
+}
+
+// allocWires assigns the intermediate values of the gates to wire
+// slots in the gate order. The slot of a value is released after the
+// gate reading it last and the output of a gate can reuse the slots
+// of the gate's inputs. The function returns the slots of the values
+// and the number of slots used.
+func (r *renumber) allocWires(order []int) ([]int, int) {
+	intermediate := func(v int) bool {
+		if v < r.numInputs {
+			return false
+		}
+		_, ok := r.outputs[v]
+		return !ok
+	}
+
+	lastUse := make([]int, len(r.depth))
+	for pos, g := range order {
+		for _, v := range r.args[g] {
+			lastUse[v] = pos
+		}
+	}
+
+	slots := make([]int, len(r.depth))
+	var free []int
+	var numSlots int
+
+	for pos, g := range order {
+		args := r.args[g]
+		for idx, v := range args {
+			if idx == 1 && v == args[0] {
+				continue
+			}
+			if intermediate(v) && lastUse[v] == pos {
+				free = append(free, slots[v])
+			}
+		}
+		v := r.numInputs + g
+		if !intermediate(v) {
+			continue
+		}
+		if len(free) > 0 {
+			slots[v] = free[len(free)-1]
+			free = free[:len(free)-1]
+		} else {
+			slots[v] = numSlots
+			numSlots++
+		}
+	}
+	return slots, numSlots
+}
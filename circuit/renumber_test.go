@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// parityCircuit creates a circuit computing the parity of a AND b
+// for the n-bit arguments a and b. The circuit computes all ANDs
+// before the XORs so all AND outputs are live at the same time.
+func parityCircuit(n int) *Circuit {
+	c := &Circuit{
+		NumWires: 4*n - 1,
+		Inputs: IO{
+			IOArg{Name: "a", Type: "uint", Size: n},
+			IOArg{Name: "b", Type: "uint", Size: n},
+		},
+		Outputs: IO{
+			IOArg{Type: "bool", Size: 1},
+		},
+		Stats: make(map[Operation]int),
+	}
+	for i := 0; i < n; i++ {
+		c.Gates = append(c.Gates, Gate{
+			Input0: Wire(i),
+			Input1: Wire(n + i),
+			Output: Wire(2*n + i),
+			Op:     AND,
+		})
+	}
+	acc := Wire(2 * n)
+	for i := 1; i < n; i++ {
+		out := Wire(3*n + i - 1)
+		c.Gates = append(c.Gates, Gate{
+			Input0: acc,
+			Input1: Wire(2*n + i),
+			Output: out,
+			Op:     XOR,
+		})
+		acc = out
+	}
+	c.NumGates = len(c.Gates)
+	c.Stats[AND] = n
+	c.Stats[XOR] = n - 1
+	return c
+}
+
+func TestRenumber(t *testing.T) {
+	var circuits []*Circuit
+	for _, test := range optimizeTests {
+		c, err := ParseBristol(bytes.NewReader([]byte(test.circ)))
+		if err != nil {
+			t.Fatalf("parse failed: %s", err)
+		}
+		circuits = append(circuits, c)
+	}
+	circuits = append(circuits, parityCircuit(64))
+
+	for idx, c := range circuits {
+		r, err := c.Renumber()
+		if err != nil {
+			t.Fatalf("test %d: Renumber failed: %s", idx, err)
+		}
+		if err := c.Equivalent(r, 100); err != nil {
+			t.Errorf("test %d: %s", idx, err)
+		}
+		if r.NumWires > c.NumWires {
+			t.Errorf("test %d: wires increased from %d to %d",
+				idx, c.NumWires, r.NumWires)
+		}
+	}
+
+	// The depth-first order computes each AND just before the XOR
+	// reading it.
+	r, err := parityCircuit(64).Renumber()
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+	if r.NumWires > 128+2+1 {
+		t.Errorf("parity circuit: got %d wires, expected %d",
+			r.NumWires, 128+2+1)
+	}
+
+	// The renumbered circuit reuses wires and it can be renumbered
+	// again.
+	r2, err := r.Renumber()
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+	if err := r.Equivalent(r2, 100); err != nil {
+		t.Errorf("renumbered twice: %s", err)
+	}
+	if r2.NumWires != r.NumWires {
+		t.Errorf("renumbered twice: got %d wires, expected %d",
+			r2.NumWires, r.NumWires)
+	}
+}
+
+func TestRenumberErrors(t *testing.T) {
+	for idx, gates := range [][]Gate{
+		// Input wire 5 not defined.
+		{
+			{Input0: 0, Input1: 5, Output: 3, Op: AND},
+		},
+		// Output wire 3 not defined.
+		{
+			{Input0: 0, Input1: 1, Output: 2, Op: AND},
+		},
+		// Input wire 1 assigned.
+		{
+			{Input0: 0, Input1: 1, Output: 1, Op: AND},
+			{Input0: 0, Input1: 1, Output: 3, Op: AND},
+		},
+	} {
+		c := &Circuit{
+			NumGates: len(gates),
+			NumWires: 4,
+			Inputs: IO{
+				IOArg{Type: "bool", Size: 1},
+				IOArg{Type: "bool", Size: 1},
+			},
+			Outputs: IO{
+				IOArg{Type: "bool", Size: 1},
+			},
+			Gates: gates,
+		}
+		if _, err := c.Renumber(); err == nil {
+			t.Errorf("test %d: Renumber succeeded", idx)
+		}
+	}
+}
+
+func TestRenumberEval(t *testing.T) {
+	const n = 32
+
+	c, err := parityCircuit(n).Renumber()
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+	key := make([]byte, 16)
+	garbled, err := c.Garble(key)
+	if err != nil {
+		t.Fatalf("Garble failed: %s", err)
+	}
+
+	rand.Seed(42)
+	for i := 0; i < 10; i++ {
+		a := rand.Uint32()
+		b := rand.Uint32()
+		input := uint64(a) | uint64(b)<<n
+
+		wires := make([]ot.Label, c.NumWires)
+		for w := 0; w < 2*n; w++ {
+			if input&(1<<w) != 0 {
+				wires[w] = garbled.Wires[w].L1
+			} else {
+				wires[w] = garbled.Wires[w].L0
+			}
+		}
+		if err := c.Eval(key, wires, garbled.Gates); err != nil {
+			t.Fatalf("Eval failed: %s", err)
+		}
+		out := c.NumWires - 1
+		var result uint
+		switch wires[out] {
+		case garbled.Wires[out].L0:
+		case garbled.Wires[out].L1:
+			result = 1
+		default:
+			t.Fatalf("invalid output label")
+		}
+		expected := uint(new(big.Int).SetUint64(uint64(a & b)).Bit(0))
+		for bit := 1; bit < n; bit++ {
+			expected ^= uint((a & b) >> bit & 1)
+		}
+		if result != expected {
+			t.Errorf("parity(%x&%x): got %d, expected %d",
+				a, b, result, expected)
+		}
+	}
+}
+
+func TestRenumberMismatch(t *testing.T) {
+	const n = 8
+
+	c := parityCircuit(n)
+	renumbered, err := c.Renumber()
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+
+	gc, ec := net.Pipe()
+	gErr := make(chan error)
+	go func() {
+		conn := p2p.NewConn(gc)
+		_, err := Garbler(conn, c, big.NewInt(1), false)
+		conn.Close()
+		gErr <- err
+	}()
+
+	conn := p2p.NewConn(ec)
+	_, err = Evaluator(conn, renumbered, big.NewInt(1), false)
+	conn.Close()
+	if err == nil || !strings.Contains(err.Error(), "circuit mismatch") {
+		t.Errorf("Evaluator: got error %v, expected circuit mismatch", err)
+	}
+	err = <-gErr
+	if err == nil || !strings.Contains(err.Error(), "circuit mismatch") {
+		t.Errorf("Garbler: got error %v, expected circuit mismatch", err)
+	}
+}
@@ -30,8 +30,15 @@ var (
 	_ AST = &Call{}
 	_ AST = &Return{}
 	_ AST = &For{}
+	_ AST = &Switch{}
+	_ AST = &Break{}
+	_ AST = &Continue{}
 	_ AST = &Binary{}
 	_ AST = &Slice{}
+	_ AST = &Index{}
+	_ AST = &Conversion{}
+	_ AST = &Selector{}
+	_ AST = &CompositeLit{}
 	_ AST = &VariableRef{}
 	_ AST = &Constant{}
 )
@@ -85,7 +92,21 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	}
 	switch ti.Type {
 	case TypeName:
-		// XXX package
+		if len(ti.Name.Package) > 0 {
+			pkg, ok := ctx.importedPackage(ti.Name.Package)
+			if !ok {
+				return result, fmt.Errorf("package '%s' not found",
+					ti.Name.Package)
+			}
+			b, ok := pkg.Bindings.Get(ti.Name.Name)
+			if ok {
+				val, ok := b.Bound.(*ssa.Variable)
+				if ok && val.TypeRef {
+					return val.Type, nil
+				}
+			}
+			return result, fmt.Errorf("unknown type %s", ti)
+		}
 		matches := reSizedType.FindStringSubmatch(ti.Name.Name)
 		if matches != nil {
 			tt, ok := types.Types[matches[1]]
@@ -112,6 +133,12 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 				Bits: 1,
 			}, nil
 		}
+		if ti.Name.Name == "byte" {
+			return types.Info{
+				Type: types.Uint,
+				Bits: 8,
+			}, nil
+		}
 		// Check dynamic types from the env.
 		b, ok := env.Get(ti.Name.Name)
 		if ok {
@@ -122,6 +149,35 @@ func (ti *TypeInfo) Resolve(env *Env, ctx *Codegen, gen *ssa.Generator) (
 		}
 		return result, fmt.Errorf("unknown type %s", ti)
 
+	case TypeArray:
+		elType, err := ti.ElementType.Resolve(env, ctx, gen)
+		if err != nil {
+			return result, err
+		}
+		if elType.Bits == 0 {
+			return result, fmt.Errorf(
+				"array element type %s has unspecified size", ti.ElementType)
+		}
+		constVal, ok, err := ti.ArrayLength.Eval(env, ctx, gen)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			return result, fmt.Errorf("array length %s is not constant",
+				ti.ArrayLength)
+		}
+		length, ok := constVal.(int32)
+		if !ok || length < 0 {
+			return result, fmt.Errorf("invalid array length %s",
+				ti.ArrayLength)
+		}
+		return types.Info{
+			Type:        types.Array,
+			Bits:        int(length) * elType.Bits,
+			ElementType: &elType,
+			ArraySize:   int(length),
+		}, nil
+
 	default:
 		return result, fmt.Errorf("unsupported type %s", ti)
 	}
@@ -235,6 +291,8 @@ type Variable struct {
 type Func struct {
 	Loc          utils.Point
 	Name         string
+	Receiver     *Variable
+	TypeParams   []*Variable
 	Args         []*Variable
 	Return       []*Variable
 	Body         List
@@ -259,9 +317,22 @@ func NewFunc(loc utils.Point, name string, args []*Variable, ret []*Variable,
 }
 
 func (ast *Func) String() string {
+	if ast.Receiver != nil {
+		return fmt.Sprintf("func (%s %s) %s()", ast.Receiver.Name,
+			ast.Receiver.Type, ast.Name)
+	}
 	return fmt.Sprintf("func %s()", ast.Name)
 }
 
+// QualifiedName returns the name of the function, qualified with its
+// receiver type for methods.
+func (ast *Func) QualifiedName() string {
+	if ast.Receiver != nil {
+		return fmt.Sprintf("%s.%s", ast.Receiver.Type, ast.Name)
+	}
+	return ast.Name
+}
+
 // Location implements the compiler.ast.AST.Location for function
 // definitions.
 func (ast *Func) Location() utils.Point {
@@ -360,11 +431,15 @@ func (ast *If) Location() utils.Point {
 // Call implements an AST call expression.
 type Call struct {
 	Loc   utils.Point
+	Recv  AST
 	Name  Identifier
 	Exprs []AST
 }
 
 func (ast *Call) String() string {
+	if ast.Recv != nil {
+		return fmt.Sprintf("%s.%s()", ast.Recv, ast.Name)
+	}
 	return fmt.Sprintf("%s()", ast.Name)
 }
 
@@ -374,6 +449,29 @@ func (ast *Call) Location() utils.Point {
 	return ast.Loc
 }
 
+// receiver returns the receiver expression of method calls or nil if
+// the call is a function call. The parser can't distinguish method
+// calls of variables from qualified function calls so a qualifier
+// bound in the environment is a method receiver.
+func (ast *Call) receiver(env *Env) AST {
+	if ast.Recv != nil {
+		return ast.Recv
+	}
+	if len(ast.Name.Package) == 0 {
+		return nil
+	}
+	_, ok := env.Get(ast.Name.Package)
+	if !ok {
+		return nil
+	}
+	return &VariableRef{
+		Loc: ast.Loc,
+		Name: Identifier{
+			Name: ast.Name.Package,
+		},
+	}
+}
+
 // Return implements an AST return statement.
 type Return struct {
 	Loc   utils.Point
@@ -410,6 +508,91 @@ func (ast *For) Location() utils.Point {
 	return ast.Loc
 }
 
+// Switch implements an AST switch statement. The switch without the
+// tag expression is a tagless switch where case expressions are
+// boolean conditions.
+type Switch struct {
+	Loc   utils.Point
+	Expr  AST
+	Cases []*Case
+}
+
+func (ast *Switch) String() string {
+	if ast.Expr == nil {
+		return "switch"
+	}
+	return fmt.Sprintf("switch %s", ast.Expr)
+}
+
+// Location implements the compiler.ast.AST.Location for switch
+// statements.
+func (ast *Switch) Location() utils.Point {
+	return ast.Loc
+}
+
+// Case implements a switch statement case clause. The default clause
+// has no expressions.
+type Case struct {
+	Loc     utils.Point
+	Default bool
+	Exprs   []AST
+	Body    List
+}
+
+func (c *Case) String() string {
+	if c.Default {
+		return "default"
+	}
+	return fmt.Sprintf("case %v", c.Exprs)
+}
+
+// Break implements an AST break statement.
+type Break struct {
+	Loc utils.Point
+}
+
+func (ast *Break) String() string {
+	return "break"
+}
+
+// Location implements the compiler.ast.AST.Location for break
+// statements.
+func (ast *Break) Location() utils.Point {
+	return ast.Loc
+}
+
+// Continue implements an AST continue statement.
+type Continue struct {
+	Loc utils.Point
+}
+
+func (ast *Continue) String() string {
+	return "continue"
+}
+
+// Location implements the compiler.ast.AST.Location for continue
+// statements.
+func (ast *Continue) Location() utils.Point {
+	return ast.Loc
+}
+
+// ssaValue wraps an already generated SSA value into an AST
+// expression. It is used when desugaring statements which must
+// evaluate their operand expressions only once.
+type ssaValue struct {
+	Loc   utils.Point
+	Value ssa.Variable
+}
+
+func (ast *ssaValue) String() string {
+	return ast.Value.String()
+}
+
+// Location implements the compiler.ast.AST.Location for SSA values.
+func (ast *ssaValue) Location() utils.Point {
+	return ast.Loc
+}
+
 // BinaryType defines binary expression types.
 type BinaryType int
 
@@ -484,6 +667,41 @@ func (ast *Binary) Location() utils.Point {
 	return ast.Loc
 }
 
+// Index implements an AST index expression.
+type Index struct {
+	Loc   utils.Point
+	Expr  AST
+	Index AST
+}
+
+func (ast *Index) String() string {
+	return fmt.Sprintf("%s[%s]", ast.Expr, ast.Index)
+}
+
+// Location implements the compiler.ast.AST.Location for index
+// expressions.
+func (ast *Index) Location() utils.Point {
+	return ast.Loc
+}
+
+// Conversion implements an AST type conversion for types that can't
+// be expressed as function calls.
+type Conversion struct {
+	Loc  utils.Point
+	Type *TypeInfo
+	Expr AST
+}
+
+func (ast *Conversion) String() string {
+	return fmt.Sprintf("%s(%s)", ast.Type, ast.Expr)
+}
+
+// Location implements the compiler.ast.AST.Location for type
+// conversions.
+func (ast *Conversion) Location() utils.Point {
+	return ast.Loc
+}
+
 // Slice implements an AST slice expression.
 type Slice struct {
 	Loc  utils.Point
@@ -509,6 +727,58 @@ func (ast *Slice) Location() utils.Point {
 	return ast.Loc
 }
 
+// Selector implements an AST selector expression.
+type Selector struct {
+	Loc  utils.Point
+	Expr AST
+	Name string
+}
+
+func (ast *Selector) String() string {
+	return fmt.Sprintf("%s.%s", ast.Expr, ast.Name)
+}
+
+// Location implements the compiler.ast.AST.Location for selector
+// expressions.
+func (ast *Selector) Location() utils.Point {
+	return ast.Loc
+}
+
+// CompositeLit implements an AST composite literal value.
+type CompositeLit struct {
+	Loc   utils.Point
+	Type  *TypeInfo
+	Value []KeyedElement
+}
+
+func (ast *CompositeLit) String() string {
+	str := fmt.Sprintf("%s{", ast.Type)
+	for idx, e := range ast.Value {
+		if idx > 0 {
+			str += ", "
+		}
+		if len(e.Key) > 0 {
+			str += fmt.Sprintf("%s: %s", e.Key, e.Element)
+		} else {
+			str += e.Element.String()
+		}
+	}
+	return str + "}"
+}
+
+// Location implements the compiler.ast.AST.Location for composite
+// literal values.
+func (ast *CompositeLit) Location() utils.Point {
+	return ast.Loc
+}
+
+// KeyedElement implements a keyed element of composite literal. The
+// key is empty for positional elements.
+type KeyedElement struct {
+	Key     string
+	Element AST
+}
+
 // VariableRef implements an AST variable reference.
 type VariableRef struct {
 	Loc  utils.Point
@@ -532,7 +802,18 @@ type Constant struct {
 }
 
 func (ast *Constant) String() string {
-	return ConstantName(ast.Value)
+	switch val := ast.Value.(type) {
+	case int, int32, uint64:
+		return fmt.Sprintf("%d", val)
+	case *big.Int:
+		return val.String()
+	case bool:
+		return fmt.Sprintf("%v", val)
+	case string:
+		return fmt.Sprintf("%q", val)
+	default:
+		return ConstantName(val)
+	}
 }
 
 // ConstantName returns the name of the constant value.
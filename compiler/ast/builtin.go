@@ -44,6 +44,12 @@ type Eval func(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 
 // Predeclared identifiers.
 var builtins = []Builtin{
+	{
+		Name: "len",
+		Type: BuiltinFunc,
+		SSA:  lenSSA,
+		Eval: lenEval,
+	},
 	{
 		Name: "make",
 		Type: BuiltinFunc,
@@ -143,8 +149,28 @@ func nativeSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
 
 		return block, []ssa.Variable{v}, nil
 
+	case "rotl", "rotr":
+		if len(args) != 2 {
+			return nil, nil, ctx.logger.Errorf(loc,
+				"invalid amount of arguments in call to '%s'", name)
+		}
+		if args[1].Type.Type != types.Int && args[1].Type.Type != types.Uint {
+			return nil, nil, ctx.logger.Errorf(loc,
+				"invalid rotation count type %s", args[1].Type)
+		}
+		v := gen.AnonVar(args[0].Type)
+		if name == "rotl" {
+			block.AddInstr(ssa.NewRotlInstr(args[0], args[1], v))
+		} else {
+			block.AddInstr(ssa.NewRotrInstr(args[0], args[1], v))
+		}
+
+		return block, []ssa.Variable{v}, nil
+
 	default:
-		if strings.HasSuffix(name, ".circ") {
+		if strings.HasSuffix(name, ".circ") ||
+			strings.HasSuffix(name, ".bristol") ||
+			strings.HasSuffix(name, ".mpclc") {
 			return nativeCircuit(name, block, ctx, gen, args, loc)
 		}
 		return nil, nil, ctx.logger.Errorf(loc, "unknown native '%s'", name)
@@ -157,7 +183,13 @@ func nativeCircuit(name string, block *ssa.Block, ctx *Codegen,
 
 	dir := path.Dir(loc.Source)
 	fp := path.Join(dir, name)
-	circ, err := circuit.Parse(fp)
+	f, err := utils.OpenFile(fp)
+	if err != nil {
+		return nil, nil, ctx.logger.Errorf(loc,
+			"failed to parse circuit: %s", err)
+	}
+	defer f.Close()
+	circ, err := circuit.ParseReader(fp, f)
 	if err != nil {
 		return nil, nil, ctx.logger.Errorf(loc,
 			"failed to parse circuit: %s", err)
@@ -236,7 +268,7 @@ func sizeEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 
 		if len(arg.Name.Package) > 0 {
 			var pkg *Package
-			pkg, ok = ctx.Packages[arg.Name.Package]
+			pkg, ok = ctx.importedPackage(arg.Name.Package)
 			if !ok {
 				return nil, false, ctx.logger.Errorf(loc,
 					"package '%s' not found", arg.Name.Package)
@@ -256,3 +288,75 @@ func sizeEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
 			"size(%v/%T) is not constant", arg, arg)
 	}
 }
+
+func lenSSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	args []ssa.Variable, loc utils.Point) (*ssa.Block, []ssa.Variable, error) {
+
+	if len(args) != 1 {
+		return nil, nil, ctx.logger.Errorf(loc,
+			"invalid amount of arguments in call to len")
+	}
+	n, err := typeLen(args[0].Type)
+	if err != nil {
+		return nil, nil, ctx.logger.Errorf(loc, "%s", err)
+	}
+	v, err := ssa.Constant(int32(n))
+	if err != nil {
+		return nil, nil, err
+	}
+	gen.AddConstant(v)
+
+	return block, []ssa.Variable{v}, nil
+}
+
+func lenEval(args []AST, env *Env, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point) (interface{}, bool, error) {
+
+	if len(args) != 1 {
+		return nil, false, ctx.logger.Errorf(loc,
+			"invalid amount of arguments in call to len")
+	}
+
+	switch arg := args[0].(type) {
+	case *Constant:
+		str, ok := arg.Value.(string)
+		if !ok {
+			return nil, false, ctx.logger.Errorf(loc,
+				"invalid argument %s for len", arg)
+		}
+		return int32(len(str)), true, nil
+
+	case *VariableRef:
+		if len(arg.Name.Package) > 0 {
+			return nil, false, nil
+		}
+		b, ok := env.Get(arg.Name.Name)
+		if !ok {
+			return nil, false, ctx.logger.Errorf(loc,
+				"undefined variable '%s'", arg.Name.String())
+		}
+		n, err := typeLen(b.Type)
+		if err != nil {
+			return nil, false, ctx.logger.Errorf(loc, "%s", err)
+		}
+		return int32(n), true, nil
+
+	default:
+		return nil, false, nil
+	}
+}
+
+// typeLen returns the length of the string or array type t. The
+// lengths of all values are known at compile time.
+func typeLen(t types.Info) (int, error) {
+	switch t.Type {
+	case types.String:
+		return t.Bits / 8, nil
+
+	case types.Array:
+		return t.ArraySize, nil
+
+	default:
+		return 0, fmt.Errorf("invalid argument (type %s) for len", t)
+	}
+}
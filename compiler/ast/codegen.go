@@ -9,17 +9,26 @@
 package ast
 
 import (
+	"fmt"
+
 	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/utils"
 )
 
 // Codegen implements compilation stack.
 type Codegen struct {
-	logger   *utils.Logger
-	Verbose  bool
-	Package  *Package
-	Packages map[string]*Package
-	Stack    []Compilation
+	logger     *utils.Logger
+	Verbose    bool
+	Package    *Package
+	Packages   map[string]*Package
+	Stack      []Compilation
+	tmpVars    int
+	evalCache  map[string]evalResult
+	failed     map[string]bool
+	main       *Package
+	warnings   utils.Warnings
+	warned     map[string]bool
+	noCallEval bool
 }
 
 // NewCodegen creates a new compilation.
@@ -29,6 +38,7 @@ func NewCodegen(logger *utils.Logger, pkg *Package,
 		logger:   logger,
 		Package:  pkg,
 		Packages: packages,
+		main:     pkg,
 		Verbose:  verbose,
 	}
 }
@@ -41,6 +51,17 @@ func (ctx *Codegen) Func() *Func {
 	return ctx.Stack[len(ctx.Stack)-1].Called
 }
 
+// importedPackage returns the package that the current package
+// imports with the alias.
+func (ctx *Codegen) importedPackage(alias string) (*Package, bool) {
+	id, ok := ctx.Package.ImportIDs[alias]
+	if !ok {
+		return nil, false
+	}
+	pkg, ok := ctx.Packages[id]
+	return pkg, ok
+}
+
 // Scope returns the variable scope in the current compilation.
 func (ctx *Codegen) Scope() int {
 	if ctx.Func() != nil {
@@ -49,6 +70,49 @@ func (ctx *Codegen) Scope() int {
 	return 0
 }
 
+// tmpName returns a unique name for a compiler generated
+// variable. The names can't clash with program identifiers.
+func (ctx *Codegen) tmpName(prefix string) string {
+	ctx.tmpVars++
+	return fmt.Sprintf("%%%s%d", prefix, ctx.tmpVars)
+}
+
+// defineFailed records the names that the failed statement
+// defines. Later references to the names are not reported as
+// undefined.
+func (ctx *Codegen) defineFailed(stmt AST) {
+	var names []string
+	switch stmt := stmt.(type) {
+	case *Assign:
+		if !stmt.Define {
+			return
+		}
+		for _, lv := range stmt.LValues {
+			ref, ok := lv.(*VariableRef)
+			if ok {
+				names = append(names, ref.Name.String())
+			}
+		}
+	case *VariableDef:
+		names = stmt.Names
+	}
+	if ctx.failed == nil {
+		ctx.failed = make(map[string]bool)
+	}
+	for _, name := range names {
+		ctx.failed[name] = true
+	}
+}
+
+// errUndefined reports that the variable name is undefined. The
+// names of failed definitions are not reported again.
+func (ctx *Codegen) errUndefined(loc utils.Point, name Identifier) error {
+	if ctx.failed[name.String()] {
+		return fmt.Errorf("undefined variable '%s'", name)
+	}
+	return ctx.logger.Errorf(loc, "undefined variable '%s'", name)
+}
+
 // PushCompilation pushes a new compilation to the compilation stack.
 func (ctx *Codegen) PushCompilation(start, ret, caller *ssa.Block,
 	called *Func) {
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// branchRewriter rewrites break and continue statements into
+// assignments of compiler generated predicate variables. The
+// statements following a rewritten branch are guarded with the guard
+// predicate so that they are executed only if the branch was not
+// taken. This turns the branches into normal conditional code that is
+// merged with phi functions.
+type branchRewriter struct {
+	brk   func(loc utils.Point) List
+	cont  func(loc utils.Point) List
+	guard string
+}
+
+// has tests if the statement contains branches that the rewriter
+// handles.
+func (r *branchRewriter) has(stmt AST) bool {
+	switch s := stmt.(type) {
+	case *Break:
+		return r.brk != nil
+	case *Continue:
+		return r.cont != nil
+	case *If:
+		return r.hasAny(s.True) || r.hasAny(s.False)
+	case *Switch:
+		// Switch statements handle their own break statements.
+		inner := &branchRewriter{
+			cont: r.cont,
+		}
+		for _, c := range s.Cases {
+			if inner.hasAny(c.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *branchRewriter) hasAny(list List) bool {
+	for _, stmt := range list {
+		if r.has(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite rewrites the branches of the statement list.
+func (r *branchRewriter) rewrite(list List) List {
+	var result List
+	for idx, stmt := range list {
+		switch s := stmt.(type) {
+		case *Break:
+			if r.brk != nil {
+				return append(result, r.brk(s.Loc)...)
+			}
+
+		case *Continue:
+			if r.cont != nil {
+				return append(result, r.cont(s.Loc)...)
+			}
+
+		case *If:
+			if r.has(s) {
+				result = append(result, &If{
+					Loc:   s.Loc,
+					Expr:  s.Expr,
+					True:  r.rewrite(s.True),
+					False: r.rewrite(s.False),
+				})
+				return append(result, r.rest(list[idx+1:])...)
+			}
+
+		case *Switch:
+			if r.has(s) {
+				inner := &branchRewriter{
+					cont:  r.cont,
+					guard: r.guard,
+				}
+				sw := &Switch{
+					Loc:  s.Loc,
+					Expr: s.Expr,
+				}
+				for _, c := range s.Cases {
+					sw.Cases = append(sw.Cases, &Case{
+						Loc:     c.Loc,
+						Default: c.Default,
+						Exprs:   c.Exprs,
+						Body:    inner.rewrite(c.Body),
+					})
+				}
+				result = append(result, sw)
+				return append(result, r.rest(list[idx+1:])...)
+			}
+		}
+		result = append(result, stmt)
+	}
+	return result
+}
+
+// rest guards the statements following a conditional branch.
+func (r *branchRewriter) rest(list List) List {
+	if len(list) == 0 {
+		return nil
+	}
+	loc := list[0].Location()
+	return List{
+		&If{
+			Loc:  loc,
+			Expr: tmpRef(loc, r.guard),
+			True: r.rewrite(list),
+		},
+	}
+}
+
+// tmpRef creates a reference to the compiler generated variable.
+func tmpRef(loc utils.Point, name string) *VariableRef {
+	return &VariableRef{
+		Loc: loc,
+		Name: Identifier{
+			Name: name,
+		},
+	}
+}
+
+// tmpAssign creates an assignment to the compiler generated
+// variable.
+func tmpAssign(loc utils.Point, name string, define bool,
+	value AST) *Assign {
+	return &Assign{
+		Loc:     loc,
+		LValues: []AST{tmpRef(loc, name)},
+		Exprs:   []AST{value},
+		Define:  define,
+	}
+}
+
+// conjuncts splits the expression into its logical and operands.
+func conjuncts(expr AST) []AST {
+	b, ok := expr.(*Binary)
+	if !ok || b.Op != BinaryAnd {
+		return []AST{expr}
+	}
+	return append(conjuncts(b.Left), conjuncts(b.Right)...)
+}
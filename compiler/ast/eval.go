@@ -12,6 +12,7 @@ import (
 	"math/big"
 
 	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/types"
 	"github.com/markkurossi/mpc/compiler/utils"
 )
 
@@ -107,11 +108,16 @@ func (ast *If) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 func (ast *Call) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	interface{}, bool, error) {
 
+	// Method calls are not constant.
+	if ast.receiver(env) != nil {
+		return nil, false, nil
+	}
+
 	// Resolve called.
 	var pkg *Package
 	var ok bool
 	if len(ast.Name.Package) > 0 {
-		pkg, ok = ctx.Packages[ast.Name.Package]
+		pkg, ok = ctx.importedPackage(ast.Name.Package)
 		if !ok {
 			return nil, false,
 				ctx.logger.Errorf(ast.Loc, "package '%s' not found",
@@ -120,9 +126,29 @@ func (ast *Call) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	} else {
 		pkg = ctx.Package
 	}
-	_, ok = pkg.Functions[ast.Name.Name]
+	called, ok := pkg.Functions[ast.Name.Name]
 	if ok {
-		return nil, false, nil
+		if ctx.noCallEval {
+			return nil, false, nil
+		}
+		// Evaluate calls with constant arguments at compile time.
+		var args []ssa.Variable
+		for _, expr := range ast.Exprs {
+			val, ok, err := expr.Eval(env, ctx, gen)
+			if err != nil || !ok {
+				return nil, ok, err
+			}
+			arg, err := ssa.Constant(val)
+			if err != nil {
+				return nil, false, nil
+			}
+			args = append(args, arg)
+		}
+		results, ok, err := ctx.evalCall(ast.Loc, gen, pkg, called, args)
+		if err != nil || !ok || len(results) != 1 {
+			return nil, false, err
+		}
+		return results[0].ConstValue, true, nil
 	}
 	// Check builtin functions.
 	for _, bi := range builtins {
@@ -154,109 +180,131 @@ func (ast *For) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	return nil, false, nil
 }
 
+// Eval implements the compiler.ast.AST.Eval for switch statements.
+func (ast *Switch) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	return nil, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for break statements.
+func (ast *Break) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	return nil, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for continue statements.
+func (ast *Continue) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	return nil, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for selector expressions.
+func (ast *Selector) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+
+	expr, ok, err := ast.Expr.Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	val, ok := expr.(ssa.CompoundValue)
+	if !ok {
+		return nil, false, nil
+	}
+	return constField(val, ast.Name)
+}
+
+// Eval implements the compiler.ast.AST.Eval for composite literal
+// values.
+func (ast *CompositeLit) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	return nil, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for SSA values.
+func (ast *ssaValue) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	if !ast.Value.Const {
+		return nil, false, nil
+	}
+	return ast.Value.ConstValue, true, nil
+}
+
 // Eval implements the compiler.ast.AST.Eval for binary expressions.
+// The expression is computed with the compile-time interpreter so the
+// constant folding follows the same rules as the compile-time
+// function calls.
 func (ast *Binary) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	interface{}, bool, error) {
-	l, ok, err := ast.Left.Eval(env, ctx, gen)
+	l, ok, err := evalOperand(env, ctx, gen, ast.Left)
 	if err != nil || !ok {
 		return nil, ok, err
 	}
-	r, ok, err := ast.Right.Eval(env, ctx, gen)
+	r, ok, err := evalOperand(env, ctx, gen, ast.Right)
 	if err != nil || !ok {
 		return nil, ok, err
 	}
 
-	switch lval := l.(type) {
-	case int32:
-		var rval int32
-		switch rv := r.(type) {
-		case int32:
-			rval = rv
-		default:
-			return nil, false, ctx.logger.Errorf(ast.Right.Location(),
-				"invalid r-value %T %s %T", lval, ast.Op, rv)
+	// Structures and arrays are compared in circuits.
+	if l.Type.Type == types.Struct || l.Type.Type == types.Array ||
+		r.Type.Type == types.Struct || r.Type.Type == types.Array {
+		return nil, false, nil
+	}
+
+	var v value
+	switch ast.Op {
+	case BinaryAnd, BinaryOr:
+		lb, err := l.boolean()
+		if err != nil {
+			return nil, false, nil
+		}
+		rb, err := r.boolean()
+		if err != nil {
+			return nil, false, nil
 		}
-		switch ast.Op {
-		case BinaryMult:
-			return lval * rval, true, nil
-		case BinaryDiv:
-			return lval / rval, true, nil
-		case BinaryMod:
-			return lval % rval, true, nil
-		case BinaryLshift:
-			return lval << rval, true, nil
-		case BinaryRshift:
-			return lval >> rval, true, nil
-
-		case BinaryPlus:
-			return lval + rval, true, nil
-		case BinaryMinus:
-			return lval - rval, true, nil
-
-		case BinaryEq:
-			return lval == rval, true, nil
-		case BinaryNeq:
-			return lval != rval, true, nil
-		case BinaryLt:
-			return lval < rval, true, nil
-		case BinaryLe:
-			return lval <= rval, true, nil
-		case BinaryGt:
-			return lval > rval, true, nil
-		case BinaryGe:
-			return lval >= rval, true, nil
-		default:
-			return nil, false, ctx.logger.Errorf(ast.Right.Location(),
-				"Binary.Eval '%T %s %T' not implemented yet", l, ast.Op, r)
+		if ast.Op == BinaryAnd {
+			v = boolValue(lb && rb)
+		} else {
+			v = boolValue(lb || rb)
 		}
 
-	case uint64:
-		var rval uint64
-		switch rv := r.(type) {
-		case uint64:
-			rval = rv
-		default:
-			return nil, false, ctx.logger.Errorf(ast.Right.Location(),
-				"%T: invalid r-value %v (%T)", lval, rv, rv)
+	default:
+		ip := &interp{
+			ctx: ctx,
+			gen: gen,
+		}
+		v, err = ip.binary(ast.Loc, ast.Op, l, r)
+		if err == errNotConstant {
+			return nil, false, nil
 		}
-		switch ast.Op {
-		case BinaryMult:
-			return lval * rval, true, nil
-		case BinaryDiv:
-			return lval / rval, true, nil
-		case BinaryMod:
-			return lval % rval, true, nil
-		case BinaryLshift:
-			return lval << rval, true, nil
-		case BinaryRshift:
-			return lval >> rval, true, nil
-
-		case BinaryPlus:
-			return lval + rval, true, nil
-		case BinaryMinus:
-			return lval - rval, true, nil
-
-		case BinaryEq:
-			return lval == rval, true, nil
-		case BinaryNeq:
-			return lval != rval, true, nil
-		case BinaryLt:
-			return lval < rval, true, nil
-		case BinaryLe:
-			return lval <= rval, true, nil
-		case BinaryGt:
-			return lval > rval, true, nil
-		case BinaryGe:
-			return lval >= rval, true, nil
-		default:
-			return nil, false, ctx.logger.Errorf(ast.Right.Location(),
-				"Binary.Eval '%T %s %T' not implemented yet", l, ast.Op, r)
+		if err != nil {
+			return nil, false, err
 		}
+	}
+	c, err := v.variable()
+	if err != nil {
+		return nil, false, nil
+	}
+	return c.ConstValue, true, nil
+}
 
-	default:
-		return nil, false, ctx.logger.Errorf(ast.Left.Location(),
-			"invalid l-value %v (%T)", lval, lval)
+// evalOperand evaluates the binary expression operand into a
+// compile-time value.
+func evalOperand(env *Env, ctx *Codegen, gen *ssa.Generator, expr AST) (
+	value, bool, error) {
+
+	val, ok, err := expr.Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return value{}, ok, err
+	}
+	c, err := ssa.Constant(val)
+	if err != nil {
+		return value{}, false, nil
+	}
+	v, err := constValue(c)
+	if err != nil {
+		return value{}, false, nil
 	}
+	return v, true, nil
 }
 
 func bigInt(i interface{}, ctx *Codegen, loc utils.Point) (*big.Int, error) {
@@ -326,6 +374,43 @@ func (ast *Slice) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	}
 }
 
+// Eval implements the compiler.ast.AST.Eval for index expressions.
+func (ast *Index) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+
+	expr, ok, err := ast.Expr.Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	val, ok, err := ast.Index.Eval(env, ctx, gen)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	index, err := intVal(val)
+	if err != nil {
+		return nil, false, ctx.logger.Errorf(ast.Index.Location(), "%s", err)
+	}
+	if array, ok := expr.(ssa.CompoundValue); ok {
+		return constIndex(ctx, ast.Index.Location(), array, index)
+	}
+	str, ok := expr.(string)
+	if !ok {
+		return nil, false, nil
+	}
+	if index < 0 || index >= len(str) {
+		return nil, false, ctx.logger.Errorf(ast.Index.Location(),
+			"invalid argument: index %d out of bounds [0:%d]",
+			index, len(str))
+	}
+	return int32(str[index]), true, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for type conversions.
+func (ast *Conversion) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	interface{}, bool, error) {
+	return nil, false, nil
+}
+
 func intVal(val interface{}) (int, error) {
 	switch v := val.(type) {
 	case int32:
@@ -350,13 +435,16 @@ func (ast *VariableRef) Eval(env *Env, ctx *Codegen,
 		if !ok || !val.Const {
 			return nil, false, nil
 		}
-		return nil, false, ctx.logger.Errorf(ast.Loc,
-			"select not implemented yet")
+		compound, ok := val.ConstValue.(ssa.CompoundValue)
+		if !ok {
+			return nil, false, nil
+		}
+		return constField(compound, ast.Name.Name)
 	}
 
 	if len(ast.Name.Package) > 0 {
 		var pkg *Package
-		pkg, ok = ctx.Packages[ast.Name.Package]
+		pkg, ok = ctx.importedPackage(ast.Name.Package)
 		if !ok {
 			return nil, false, ctx.logger.Errorf(ast.Loc,
 				"package '%s' not found", ast.Name.Package)
@@ -366,8 +454,7 @@ func (ast *VariableRef) Eval(env *Env, ctx *Codegen,
 		b, ok = env.Get(ast.Name.Name)
 	}
 	if !ok {
-		return nil, false, ctx.logger.Errorf(ast.Loc,
-			"undefined variable '%s'", ast.Name.String())
+		return nil, false, ctx.errUndefined(ast.Loc, ast.Name)
 	}
 
 	val, ok := b.Bound.(*ssa.Variable)
@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// constraints define the type parameter constraints.
+var constraints = map[string]func(t types.Info) bool{
+	"any": func(t types.Info) bool {
+		return true
+	},
+	"Integer": func(t types.Info) bool {
+		return t.Type == types.Int || t.Type == types.Uint
+	},
+	"Unsigned": func(t types.Info) bool {
+		return t.Type == types.Uint
+	},
+}
+
+// typeParam tests if the type info is a reference to a type
+// parameter of the function.
+func (ast *Func) typeParam(ti *TypeInfo) (*Variable, bool) {
+	if ti == nil || ti.Type != TypeName || len(ti.Name.Package) > 0 {
+		return nil, false
+	}
+	for _, tp := range ast.TypeParams {
+		if tp.Name == ti.Name.Name {
+			return tp, true
+		}
+	}
+	return nil, false
+}
+
+// instantiate infers the type parameters of the function from the
+// call arguments and binds them into the bindings. The typed
+// arguments are considered before the untyped constants.
+func (ast *Func) instantiate(loc utils.Point, ctx *Codegen,
+	gen *ssa.Generator, bindings *ssa.Bindings, params []*Variable,
+	args []ssa.Variable) error {
+
+	if len(ast.TypeParams) == 0 {
+		return nil
+	}
+
+	inferred := make(map[string]types.Info)
+	for _, constants := range []bool{false, true} {
+		for idx, param := range params {
+			tp, ok := ast.typeParam(param.Type)
+			if !ok || args[idx].Const != constants {
+				continue
+			}
+			_, ok = inferred[tp.Name]
+			if ok {
+				continue
+			}
+			t := args[idx].Type
+			t.Offset = 0
+			inferred[tp.Name] = t
+		}
+	}
+
+	for _, tp := range ast.TypeParams {
+		t, ok := inferred[tp.Name]
+		if !ok {
+			return ctx.logger.Errorf(loc,
+				"cannot infer %s in call to %s", tp.Name, ast.Name)
+		}
+		satisfies, ok := constraints[tp.Type.Name.Name]
+		if !ok || len(tp.Type.Name.Package) > 0 {
+			return ctx.logger.Errorf(tp.Loc, "undefined constraint: %s",
+				tp.Type)
+		}
+		if !satisfies(t) {
+			return ctx.logger.Errorf(loc, "%s does not satisfy %s",
+				t, tp.Type)
+		}
+		v, err := ssa.Constant(t)
+		if err != nil {
+			return err
+		}
+		lval, err := gen.NewVar(tp.Name, t, ctx.Scope())
+		if err != nil {
+			return err
+		}
+		bindings.Set(lval, &v)
+	}
+	return nil
+}
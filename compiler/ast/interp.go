@@ -0,0 +1,1490 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+const (
+	// maxEvalSteps limits the number of statements a compile-time
+	// function evaluation can execute.
+	maxEvalSteps = 1 << 22
+
+	// maxEvalDepth limits the call depth of a compile-time function
+	// evaluation.
+	maxEvalDepth = 256
+)
+
+// errNotConstant aborts the compile-time evaluation of a function
+// call. The call is compiled into a circuit instead.
+var errNotConstant = errors.New("not constant")
+
+// value implements compile-time values. Typed values hold the bits
+// of the value in the wire layout of their type. Untyped values are
+// integer constants holding their exact value. Their type is the
+// default type of the constant.
+type value struct {
+	Type    types.Info
+	Untyped bool
+	Val     *big.Int
+}
+
+// constValue creates a compile-time value from the constant
+// variable v.
+func constValue(v ssa.Variable) (value, error) {
+	if !v.Const || v.TypeRef {
+		return value{}, errNotConstant
+	}
+	switch val := v.ConstValue.(type) {
+	case int32:
+		return untyped(big.NewInt(int64(val))), nil
+
+	case uint64:
+		return untyped(new(big.Int).SetUint64(val)), nil
+
+	case *big.Int:
+		return untyped(new(big.Int).Set(val)), nil
+
+	case bool:
+		result := value{
+			Type: types.BoolType(),
+			Val:  big.NewInt(0),
+		}
+		if val {
+			result.Val.SetInt64(1)
+		}
+		return result, nil
+
+	case string:
+		bytes := []byte(val)
+		result := value{
+			Type: v.Type,
+			Val:  new(big.Int),
+		}
+		for i := len(bytes) - 1; i >= 0; i-- {
+			result.Val.Lsh(result.Val, 8)
+			result.Val.Or(result.Val, big.NewInt(int64(bytes[i])))
+		}
+		return result, nil
+
+	case ssa.CompoundValue:
+		return value{
+			Type: val.Type,
+			Val:  new(big.Int).Set(val.Value),
+		}, nil
+
+	default:
+		return value{}, errNotConstant
+	}
+}
+
+// untyped creates an untyped integer value.
+func untyped(x *big.Int) value {
+	c, err := ssa.Constant(intConst(x))
+	if err != nil {
+		panic(err)
+	}
+	return value{
+		Type:    c.Type,
+		Untyped: true,
+		Val:     x,
+	}
+}
+
+// intConst returns the smallest Go type holding the integer x.
+func intConst(x *big.Int) interface{} {
+	if x.IsInt64() {
+		i := x.Int64()
+		if i >= -(1<<31) && i < 1<<31 {
+			return int32(i)
+		}
+	}
+	if x.IsUint64() {
+		return x.Uint64()
+	}
+	return new(big.Int).Set(x)
+}
+
+// boolValue creates a boolean value.
+func boolValue(b bool) value {
+	v := value{
+		Type: types.BoolType(),
+		Val:  big.NewInt(0),
+	}
+	if b {
+		v.Val.SetInt64(1)
+	}
+	return v
+}
+
+// mask truncates the integer x into bits bits.
+func mask(x *big.Int, bits int) *big.Int {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	return new(big.Int).Mod(x, m)
+}
+
+// signed returns the integer value of v, interpreting signed types as
+// two's complement numbers.
+func (v value) signed() *big.Int {
+	if !v.Untyped && v.Type.Type == types.Int && v.Type.Bits > 0 &&
+		v.Val.Bit(v.Type.Bits-1) != 0 {
+		m := new(big.Int).Lsh(big.NewInt(1), uint(v.Type.Bits))
+		return new(big.Int).Sub(v.Val, m)
+	}
+	return v.Val
+}
+
+// boolean returns the value of the boolean value v.
+func (v value) boolean() (bool, error) {
+	if v.Untyped || v.Type.Type != types.Bool {
+		return false, errNotConstant
+	}
+	return v.Val.Sign() != 0, nil
+}
+
+// int returns the value of the integer value v.
+func (v value) int() (int, error) {
+	if !v.Untyped && v.Type.Type != types.Int && v.Type.Type != types.Uint {
+		return 0, errNotConstant
+	}
+	x := v.signed()
+	if !x.IsInt64() || x.Int64() >= 1<<31 || x.Int64() < -(1<<31) {
+		return 0, errNotConstant
+	}
+	return int(x.Int64()), nil
+}
+
+// assign converts the value v for assignment into type t.
+func (v value) assign(t types.Info) (value, error) {
+	t.Offset = 0
+	t.MinBits = t.Bits
+	if v.Untyped {
+		if t.Type != types.Int && t.Type != types.Uint {
+			return value{}, errNotConstant
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Bits))
+		if v.Val.Cmp(limit) >= 0 {
+			return value{}, errNotConstant
+		}
+		if v.Val.Sign() < 0 {
+			if t.Type != types.Int {
+				return value{}, errNotConstant
+			}
+			limit.Rsh(limit, 1)
+			if new(big.Int).Neg(v.Val).Cmp(limit) > 0 {
+				return value{}, errNotConstant
+			}
+		}
+		return value{
+			Type: t,
+			Val:  mask(v.Val, t.Bits),
+		}, nil
+	}
+	if !t.Equal(v.Type) {
+		return value{}, errNotConstant
+	}
+	return value{
+		Type: t,
+		Val:  v.Val,
+	}, nil
+}
+
+// convert converts the value v into type t. The conversion zero
+// extends or truncates the value like the circuit move operations.
+func (v value) convert(t types.Info) (value, error) {
+	switch t.Type {
+	case types.Int, types.Uint:
+	default:
+		return value{}, errNotConstant
+	}
+	if t.Bits == 0 {
+		t.Bits = v.Type.Bits
+	}
+	t.Offset = 0
+	t.MinBits = t.Bits
+	return value{
+		Type: t,
+		Val:  mask(v.Val, t.Bits),
+	}, nil
+}
+
+// bits returns the bits [from:from+count] of the value v.
+func (v value) bits(from, count int) *big.Int {
+	x := new(big.Int).Rsh(v.Val, uint(from))
+	return mask(x, count)
+}
+
+// setBits sets the bits [from:from+count] of the value v to x.
+func (v value) setBits(from, count int, x *big.Int) value {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(count))
+	m.Sub(m, big.NewInt(1))
+	m.Lsh(m, uint(from))
+
+	val := new(big.Int).AndNot(v.Val, m)
+	val.Or(val, new(big.Int).Lsh(x, uint(from)))
+
+	return value{
+		Type: v.Type,
+		Val:  val,
+	}
+}
+
+// field returns the named field of the structure value v.
+func (v value) field(name string) (value, error) {
+	if v.Untyped || v.Type.Type != types.Struct {
+		return value{}, errNotConstant
+	}
+	f, ok := structField(v.Type, name)
+	if !ok {
+		return value{}, errNotConstant
+	}
+	t := f.Type
+	t.Offset = 0
+	t.MinBits = t.Bits
+	return value{
+		Type: t,
+		Val:  v.bits(f.Type.Offset, f.Type.Bits),
+	}, nil
+}
+
+// setField sets the named field of the structure value v to x.
+func (v value) setField(name string, x value) (value, error) {
+	if v.Untyped || v.Type.Type != types.Struct {
+		return value{}, errNotConstant
+	}
+	f, ok := structField(v.Type, name)
+	if !ok {
+		return value{}, errNotConstant
+	}
+	x, err := x.assign(f.Type)
+	if err != nil {
+		return value{}, err
+	}
+	return v.setBits(f.Type.Offset, f.Type.Bits, x.Val), nil
+}
+
+// index returns the element idx of the string or array value v.
+func (v value) index(idx int) (value, error) {
+	if v.Untyped {
+		return value{}, errNotConstant
+	}
+	elType, count, ok := elementType(v.Type)
+	if !ok || idx < 0 || idx >= count {
+		return value{}, errNotConstant
+	}
+	return value{
+		Type: elType,
+		Val:  v.bits(idx*elType.Bits, elType.Bits),
+	}, nil
+}
+
+// setIndex sets the element idx of the array value v to x.
+func (v value) setIndex(idx int, x value) (value, error) {
+	if v.Untyped || v.Type.Type != types.Array {
+		return value{}, errNotConstant
+	}
+	elType, count, _ := elementType(v.Type)
+	if idx < 0 || idx >= count {
+		return value{}, errNotConstant
+	}
+	x, err := x.assign(elType)
+	if err != nil {
+		return value{}, err
+	}
+	return v.setBits(idx*elType.Bits, elType.Bits, x.Val), nil
+}
+
+// variable returns the value v as a constant variable.
+func (v value) variable() (ssa.Variable, error) {
+	if v.Untyped {
+		return ssa.Constant(intConst(v.Val))
+	}
+	switch v.Type.Type {
+	case types.Bool:
+		return ssa.Constant(v.Val.Sign() != 0)
+
+	case types.Int, types.Uint:
+		x := v.signed()
+		c, err := ssa.Constant(intConst(x))
+		if err != nil {
+			return c, err
+		}
+		if x.Sign() < 0 {
+			// The bits of negative constants depend on their size.
+			c.Name = fmt.Sprintf("$%s(%s)", v.Type, x)
+		}
+		minBits := c.Type.MinBits
+		if minBits > v.Type.Bits {
+			minBits = v.Type.Bits
+		}
+		c.Type = v.Type
+		c.Type.MinBits = minBits
+		return c, nil
+
+	case types.String:
+		bytes := make([]byte, v.Type.Bits/8)
+		for i := range bytes {
+			bytes[i] = byte(v.bits(i*8, 8).Uint64())
+		}
+		return ssa.Constant(string(bytes))
+
+	case types.Struct, types.Array:
+		return ssa.Constant(ssa.CompoundValue{
+			Type:  v.Type,
+			Value: v.Val,
+		})
+
+	default:
+		return ssa.Variable{}, errNotConstant
+	}
+}
+
+// control defines how the statement execution continues.
+type control int
+
+const (
+	ctrlNone control = iota
+	ctrlBreak
+	ctrlContinue
+	ctrlReturn
+)
+
+// frame implements the activation frame of an interpreted function.
+type frame struct {
+	pkg    *Package
+	fn     *Func
+	env    *Env
+	scopes []map[string]value
+	result []value
+}
+
+func (fr *frame) push() {
+	fr.scopes = append(fr.scopes, make(map[string]value))
+}
+
+func (fr *frame) pop() {
+	fr.scopes = fr.scopes[:len(fr.scopes)-1]
+}
+
+func (fr *frame) lookup(name string) (value, bool) {
+	for i := len(fr.scopes) - 1; i >= 0; i-- {
+		v, ok := fr.scopes[i][name]
+		if ok {
+			return v, true
+		}
+	}
+	return value{}, false
+}
+
+func (fr *frame) define(name string, v value) {
+	fr.scopes[len(fr.scopes)-1][name] = v
+}
+
+func (fr *frame) set(name string, v value) bool {
+	for i := len(fr.scopes) - 1; i >= 0; i-- {
+		_, ok := fr.scopes[i][name]
+		if ok {
+			fr.scopes[i][name] = v
+			return true
+		}
+	}
+	return false
+}
+
+// interp implements the compile-time evaluation of function calls.
+type interp struct {
+	ctx   *Codegen
+	gen   *ssa.Generator
+	steps int
+	depth int
+}
+
+// evalResult holds the cached result of a compile-time function
+// evaluation.
+type evalResult struct {
+	values []ssa.Variable
+	ok     bool
+}
+
+// evalCall evaluates the function call at compile time if all its
+// arguments are constant. The function returns false if the call
+// can't be evaluated at compile time.
+func (ctx *Codegen) evalCall(loc utils.Point, gen *ssa.Generator,
+	pkg *Package, f *Func, args []ssa.Variable) ([]ssa.Variable, bool, error) {
+
+	key := fmt.Sprintf("%p", f)
+	for _, arg := range args {
+		if !arg.Const || arg.TypeRef {
+			return nil, false, nil
+		}
+		key += fmt.Sprintf(",%s:%s", arg.Name, arg.Type)
+	}
+	if ctx.evalCache == nil {
+		ctx.evalCache = make(map[string]evalResult)
+	}
+	cached, ok := ctx.evalCache[key]
+	if ok {
+		return cached.values, cached.ok, nil
+	}
+
+	var vals []value
+	for _, arg := range args {
+		v, err := constValue(arg)
+		if err != nil {
+			ctx.evalCache[key] = evalResult{}
+			return nil, false, nil
+		}
+		vals = append(vals, v)
+	}
+
+	ip := &interp{
+		ctx: ctx,
+		gen: gen,
+	}
+	results, err := ip.call(loc, pkg, f, vals)
+	if err == errNotConstant {
+		ctx.evalCache[key] = evalResult{}
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var values []ssa.Variable
+	for _, r := range results {
+		v, err := r.variable()
+		if err != nil {
+			ctx.evalCache[key] = evalResult{}
+			return nil, false, nil
+		}
+		values = append(values, v)
+	}
+	ctx.evalCache[key] = evalResult{
+		values: values,
+		ok:     true,
+	}
+	return values, true, nil
+}
+
+// step counts the executed statements and aborts the evaluation if
+// it runs for too long.
+func (ip *interp) step() error {
+	ip.steps++
+	if ip.steps > maxEvalSteps {
+		return errNotConstant
+	}
+	return nil
+}
+
+// call calls the function f with the argument values.
+func (ip *interp) call(loc utils.Point, pkg *Package, f *Func,
+	args []value) ([]value, error) {
+
+	ip.depth++
+	callerPkg := ip.ctx.Package
+	ip.ctx.Package = pkg
+	defer func() {
+		ip.depth--
+		ip.ctx.Package = callerPkg
+	}()
+	if ip.depth > maxEvalDepth {
+		return nil, errNotConstant
+	}
+
+	params := f.Args
+	if f.Receiver != nil {
+		params = append([]*Variable{f.Receiver}, params...)
+	}
+	if len(args) != len(params) {
+		return nil, errNotConstant
+	}
+
+	fr := &frame{
+		pkg: pkg,
+		fn:  f,
+		env: &Env{
+			Bindings: pkg.Bindings.Clone(),
+		},
+	}
+	fr.push()
+
+	if len(f.TypeParams) > 0 {
+		vars := make([]ssa.Variable, len(args))
+		for idx, arg := range args {
+			vars[idx] = ssa.Variable{
+				Type:  arg.Type,
+				Const: arg.Untyped,
+			}
+		}
+		err := f.instantiate(loc, ip.ctx, ip.gen, &fr.env.Bindings, params,
+			vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for idx, param := range params {
+		t, err := param.Type.Resolve(fr.env, ip.ctx, ip.gen)
+		if err != nil {
+			return nil, errNotConstant
+		}
+		if t.Bits == 0 {
+			t.Bits = args[idx].Type.Bits
+		}
+		v, err := args[idx].assign(t)
+		if err != nil {
+			return nil, err
+		}
+		fr.define(param.Name, v)
+	}
+	for _, ret := range f.Return {
+		if len(ret.Name) == 0 || ret.Name[0] == '%' {
+			continue
+		}
+		t, err := ret.Type.Resolve(fr.env, ip.ctx, ip.gen)
+		if err != nil || t.Bits == 0 {
+			return nil, errNotConstant
+		}
+		v, err := value{Type: t, Val: new(big.Int)}.assign(t)
+		if err != nil {
+			return nil, err
+		}
+		fr.define(ret.Name, v)
+	}
+
+	ctrl, err := ip.execList(fr, f.Body)
+	if err != nil {
+		return nil, err
+	}
+	if ctrl != ctrlReturn {
+		if len(f.Return) > 0 {
+			return nil, errNotConstant
+		}
+		return nil, nil
+	}
+	if len(fr.result) != len(f.Return) {
+		return nil, errNotConstant
+	}
+	var result []value
+	for idx, ret := range f.Return {
+		t, err := ret.Type.Resolve(fr.env, ip.ctx, ip.gen)
+		if err != nil {
+			return nil, errNotConstant
+		}
+		if t.Bits == 0 {
+			t.Bits = fr.result[idx].Type.Bits
+		}
+		v, err := fr.result[idx].assign(t)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// execList executes the statements in a new scope.
+func (ip *interp) execList(fr *frame, list List) (control, error) {
+	fr.push()
+	defer fr.pop()
+
+	for _, stmt := range list {
+		ctrl, err := ip.exec(fr, stmt)
+		if err != nil || ctrl != ctrlNone {
+			return ctrl, err
+		}
+	}
+	return ctrlNone, nil
+}
+
+// exec executes the statement.
+func (ip *interp) exec(fr *frame, stmt AST) (control, error) {
+	if err := ip.step(); err != nil {
+		return ctrlNone, err
+	}
+
+	switch s := stmt.(type) {
+	case List:
+		return ip.execList(fr, s)
+
+	case *VariableDef:
+		t, err := s.Type.Resolve(fr.env, ip.ctx, ip.gen)
+		if err != nil || t.Bits == 0 {
+			return ctrlNone, errNotConstant
+		}
+		for _, name := range s.Names {
+			v := value{
+				Type: t,
+				Val:  new(big.Int),
+			}
+			if s.Init != nil {
+				v, err = ip.eval1(fr, s.Init)
+				if err != nil {
+					return ctrlNone, err
+				}
+			}
+			v, err = v.assign(t)
+			if err != nil {
+				return ctrlNone, err
+			}
+			fr.define(name, v)
+		}
+		return ctrlNone, nil
+
+	case *Assign:
+		return ctrlNone, ip.execAssign(fr, s)
+
+	case *If:
+		c, err := ip.eval1(fr, s.Expr)
+		if err != nil {
+			return ctrlNone, err
+		}
+		b, err := c.boolean()
+		if err != nil {
+			return ctrlNone, err
+		}
+		if b {
+			return ip.execList(fr, s.True)
+		}
+		return ip.execList(fr, s.False)
+
+	case *For:
+		return ip.execFor(fr, s)
+
+	case *Switch:
+		return ip.execSwitch(fr, s)
+
+	case *Return:
+		var result []value
+		if len(s.Exprs) == 0 {
+			for _, ret := range fr.fn.Return {
+				v, ok := fr.lookup(ret.Name)
+				if !ok {
+					return ctrlNone, errNotConstant
+				}
+				result = append(result, v)
+			}
+		} else {
+			var err error
+			result, err = ip.evalExprs(fr, s.Exprs)
+			if err != nil {
+				return ctrlNone, err
+			}
+		}
+		fr.result = result
+		return ctrlReturn, nil
+
+	case *Break:
+		return ctrlBreak, nil
+
+	case *Continue:
+		return ctrlContinue, nil
+
+	case *Call:
+		_, err := ip.eval(fr, s)
+		return ctrlNone, err
+
+	default:
+		return ctrlNone, errNotConstant
+	}
+}
+
+// execAssign executes the assignment statement.
+func (ip *interp) execAssign(fr *frame, s *Assign) error {
+	values, err := ip.evalExprs(fr, s.Exprs)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(s.LValues) {
+		return errNotConstant
+	}
+	for idx, lv := range s.LValues {
+		if s.Define {
+			ref, ok := lv.(*VariableRef)
+			if !ok || len(ref.Name.Package) > 0 {
+				return errNotConstant
+			}
+			v := values[idx]
+			if v.Untyped {
+				// Variables get the default type of the constant.
+				v, err = v.assign(v.Type)
+				if err != nil {
+					return err
+				}
+			}
+			fr.define(ref.Name.Name, v)
+			continue
+		}
+		err = ip.assign(fr, lv, values[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assign assigns the value v to the lvalue lv.
+func (ip *interp) assign(fr *frame, lv AST, v value) error {
+	switch lv := lv.(type) {
+	case *VariableRef:
+		if len(lv.Name.Package) > 0 {
+			base, ok := fr.lookup(lv.Name.Package)
+			if !ok {
+				return errNotConstant
+			}
+			base, err := base.setField(lv.Name.Name, v)
+			if err != nil {
+				return err
+			}
+			fr.set(lv.Name.Package, base)
+			return nil
+		}
+		cur, ok := fr.lookup(lv.Name.Name)
+		if !ok {
+			return errNotConstant
+		}
+		if !cur.Untyped {
+			var err error
+			v, err = v.assign(cur.Type)
+			if err != nil {
+				return err
+			}
+		}
+		fr.set(lv.Name.Name, v)
+		return nil
+
+	case *Selector:
+		base, err := ip.eval1(fr, lv.Expr)
+		if err != nil {
+			return err
+		}
+		base, err = base.setField(lv.Name, v)
+		if err != nil {
+			return err
+		}
+		return ip.assign(fr, lv.Expr, base)
+
+	case *Index:
+		base, err := ip.eval1(fr, lv.Expr)
+		if err != nil {
+			return err
+		}
+		idx, err := ip.eval1(fr, lv.Index)
+		if err != nil {
+			return err
+		}
+		i, err := idx.int()
+		if err != nil {
+			return err
+		}
+		base, err = base.setIndex(i, v)
+		if err != nil {
+			return err
+		}
+		return ip.assign(fr, lv.Expr, base)
+
+	default:
+		return errNotConstant
+	}
+}
+
+// execFor executes the for loop.
+func (ip *interp) execFor(fr *frame, s *For) (control, error) {
+	fr.push()
+	defer fr.pop()
+
+	if s.Init != nil {
+		_, err := ip.exec(fr, s.Init)
+		if err != nil {
+			return ctrlNone, err
+		}
+	}
+	for {
+		if err := ip.step(); err != nil {
+			return ctrlNone, err
+		}
+		if s.Cond != nil {
+			c, err := ip.eval1(fr, s.Cond)
+			if err != nil {
+				return ctrlNone, err
+			}
+			b, err := c.boolean()
+			if err != nil {
+				return ctrlNone, err
+			}
+			if !b {
+				return ctrlNone, nil
+			}
+		}
+		ctrl, err := ip.execList(fr, s.Body)
+		if err != nil {
+			return ctrlNone, err
+		}
+		switch ctrl {
+		case ctrlBreak:
+			return ctrlNone, nil
+		case ctrlReturn:
+			return ctrl, nil
+		}
+		if s.Inc != nil {
+			_, err = ip.exec(fr, s.Inc)
+			if err != nil {
+				return ctrlNone, err
+			}
+		}
+	}
+}
+
+// execSwitch executes the switch statement.
+func (ip *interp) execSwitch(fr *frame, s *Switch) (control, error) {
+	var tag *value
+	if s.Expr != nil {
+		v, err := ip.eval1(fr, s.Expr)
+		if err != nil {
+			return ctrlNone, err
+		}
+		tag = &v
+	}
+
+	var match, def *Case
+	for _, c := range s.Cases {
+		if c.Default {
+			def = c
+			continue
+		}
+		for _, expr := range c.Exprs {
+			v, err := ip.eval1(fr, expr)
+			if err != nil {
+				return ctrlNone, err
+			}
+			if tag != nil {
+				v, err = ip.binary(expr.Location(), BinaryEq, *tag, v)
+				if err != nil {
+					return ctrlNone, err
+				}
+			}
+			b, err := v.boolean()
+			if err != nil {
+				return ctrlNone, err
+			}
+			if b {
+				match = c
+				break
+			}
+		}
+		if match != nil {
+			break
+		}
+	}
+	if match == nil {
+		match = def
+	}
+	if match == nil {
+		return ctrlNone, nil
+	}
+	ctrl, err := ip.execList(fr, match.Body)
+	if ctrl == ctrlBreak {
+		ctrl = ctrlNone
+	}
+	return ctrl, err
+}
+
+// evalExprs evaluates the expressions. A single expression can
+// produce multiple values.
+func (ip *interp) evalExprs(fr *frame, exprs []AST) ([]value, error) {
+	if len(exprs) == 1 {
+		return ip.eval(fr, exprs[0])
+	}
+	var result []value
+	for _, expr := range exprs {
+		v, err := ip.eval1(fr, expr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// eval1 evaluates the single-valued expression.
+func (ip *interp) eval1(fr *frame, expr AST) (value, error) {
+	values, err := ip.eval(fr, expr)
+	if err != nil {
+		return value{}, err
+	}
+	if len(values) != 1 {
+		return value{}, errNotConstant
+	}
+	return values[0], nil
+}
+
+// eval evaluates the expression.
+func (ip *interp) eval(fr *frame, expr AST) ([]value, error) {
+	switch e := expr.(type) {
+	case *Constant:
+		c, err := ssa.Constant(e.Value)
+		if err != nil {
+			return nil, errNotConstant
+		}
+		v, err := constValue(c)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *VariableRef:
+		v, err := ip.variable(fr, e)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *Binary:
+		v, err := ip.evalBinary(fr, e)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *Call:
+		return ip.evalCall(fr, e)
+
+	case *Selector:
+		base, err := ip.eval1(fr, e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		v, err := base.field(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *Index:
+		base, err := ip.eval1(fr, e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := ip.eval1(fr, e.Index)
+		if err != nil {
+			return nil, err
+		}
+		i, err := idx.int()
+		if err != nil {
+			return nil, err
+		}
+		_, count, ok := elementType(base.Type)
+		if ok && !base.Untyped && (i < 0 || i >= count) {
+			return nil, ip.ctx.logger.Errorf(e.Index.Location(),
+				"invalid argument: index %d out of bounds [0:%d]", i, count)
+		}
+		v, err := base.index(i)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *Slice:
+		base, err := ip.eval1(fr, e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if base.Untyped {
+			return nil, errNotConstant
+		}
+		from := 0
+		to := base.Type.Bits
+		if e.From != nil {
+			v, err := ip.eval1(fr, e.From)
+			if err != nil {
+				return nil, err
+			}
+			from, err = v.int()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if e.To != nil {
+			v, err := ip.eval1(fr, e.To)
+			if err != nil {
+				return nil, err
+			}
+			to, err = v.int()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if from < 0 || from >= base.Type.Bits || from >= to {
+			return nil, errNotConstant
+		}
+		t := types.Info{
+			Type:    base.Type.Type,
+			Bits:    to - from,
+			MinBits: to - from,
+		}
+		return []value{{
+			Type: t,
+			Val:  base.bits(from, to-from),
+		}}, nil
+
+	case *CompositeLit:
+		v, err := ip.evalCompositeLit(fr, e)
+		if err != nil {
+			return nil, err
+		}
+		return []value{v}, nil
+
+	case *Conversion:
+		t, err := e.Type.Resolve(fr.env, ip.ctx, ip.gen)
+		if err != nil {
+			return nil, errNotConstant
+		}
+		v, err := ip.eval1(fr, e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if v.Untyped || v.Type.Bits != t.Bits {
+			return nil, errNotConstant
+		}
+		return []value{{
+			Type: t,
+			Val:  v.Val,
+		}}, nil
+
+	default:
+		return nil, errNotConstant
+	}
+}
+
+// variable evaluates the variable reference.
+func (ip *interp) variable(fr *frame, ref *VariableRef) (value, error) {
+	if len(ref.Name.Package) > 0 {
+		base, ok := fr.lookup(ref.Name.Package)
+		if ok {
+			return base.field(ref.Name.Name)
+		}
+		pkg, ok := ip.ctx.importedPackage(ref.Name.Package)
+		if !ok {
+			return value{}, errNotConstant
+		}
+		return bindingValue(pkg.Bindings.Get(ref.Name.Name))
+	}
+	v, ok := fr.lookup(ref.Name.Name)
+	if ok {
+		return v, nil
+	}
+	return bindingValue(fr.env.Get(ref.Name.Name))
+}
+
+// bindingValue returns the value of the constant binding b.
+func bindingValue(b ssa.Binding, ok bool) (value, error) {
+	if !ok {
+		return value{}, errNotConstant
+	}
+	v, ok := b.Bound.(*ssa.Variable)
+	if !ok {
+		return value{}, errNotConstant
+	}
+	return constValue(*v)
+}
+
+// evalCall evaluates the function call expression.
+func (ip *interp) evalCall(fr *frame, call *Call) ([]value, error) {
+	var recv *value
+	if call.Recv != nil {
+		v, err := ip.eval1(fr, call.Recv)
+		if err != nil {
+			return nil, err
+		}
+		recv = &v
+	} else if len(call.Name.Package) > 0 {
+		v, ok := fr.lookup(call.Name.Package)
+		if ok {
+			recv = &v
+		}
+	}
+
+	args, err := ip.evalExprs(fr, call.Exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	if recv != nil {
+		pkg, ok := ip.ctx.Packages[recv.Type.Package]
+		if !ok {
+			return nil, errNotConstant
+		}
+		f, ok := pkg.Methods[recv.Type.Name][call.Name.Name]
+		if !ok {
+			return nil, errNotConstant
+		}
+		return ip.call(call.Loc, pkg, f, append([]value{*recv}, args...))
+	}
+
+	pkg := fr.pkg
+	if len(call.Name.Package) > 0 {
+		var ok bool
+		pkg, ok = ip.ctx.importedPackage(call.Name.Package)
+		if !ok {
+			return nil, errNotConstant
+		}
+	}
+	f, ok := pkg.Functions[call.Name.Name]
+	if ok {
+		return ip.call(call.Loc, pkg, f, args)
+	}
+
+	if len(args) != 1 {
+		return nil, errNotConstant
+	}
+	switch call.Name.Name {
+	case "len":
+		if args[0].Untyped {
+			return nil, errNotConstant
+		}
+		l, err := typeLen(args[0].Type)
+		if err != nil {
+			return nil, errNotConstant
+		}
+		return []value{untyped(big.NewInt(int64(l)))}, nil
+
+	case "size":
+		return []value{untyped(big.NewInt(int64(args[0].Type.Bits)))}, nil
+	}
+
+	// Type conversion.
+	ti := &TypeInfo{
+		Type: TypeName,
+		Name: call.Name,
+	}
+	t, err := ti.Resolve(fr.env, ip.ctx, ip.gen)
+	if err != nil {
+		return nil, errNotConstant
+	}
+	v, err := args[0].convert(t)
+	if err != nil {
+		return nil, err
+	}
+	return []value{v}, nil
+}
+
+// evalBinary evaluates the binary expression.
+func (ip *interp) evalBinary(fr *frame, b *Binary) (value, error) {
+	l, err := ip.eval1(fr, b.Left)
+	if err != nil {
+		return value{}, err
+	}
+	switch b.Op {
+	case BinaryAnd, BinaryOr:
+		lb, err := l.boolean()
+		if err != nil {
+			return value{}, err
+		}
+		if lb == (b.Op == BinaryOr) {
+			return l, nil
+		}
+		r, err := ip.eval1(fr, b.Right)
+		if err != nil {
+			return value{}, err
+		}
+		_, err = r.boolean()
+		if err != nil {
+			return value{}, err
+		}
+		return r, nil
+	}
+	r, err := ip.eval1(fr, b.Right)
+	if err != nil {
+		return value{}, err
+	}
+	return ip.binary(b.Loc, b.Op, l, r)
+}
+
+// binary computes the binary operation op for the values. The
+// typed operations follow the circuit semantics: the operands are
+// bit vectors of their type's width and the comparisons and divisions
+// treat them as unsigned numbers for both signed and unsigned types.
+// The right shift of a signed value is arithmetic.
+func (ip *interp) binary(loc utils.Point, op BinaryType, l, r value) (
+	value, error) {
+
+	switch op {
+	case BinaryLshift, BinaryRshift:
+		count, err := r.int()
+		if err != nil || count < 0 {
+			return value{}, errNotConstant
+		}
+		if l.Untyped {
+			if op == BinaryLshift {
+				return untyped(new(big.Int).Lsh(l.Val, uint(count))), nil
+			}
+			return untyped(new(big.Int).Rsh(l.Val, uint(count))), nil
+		}
+		if l.Type.Type != types.Int && l.Type.Type != types.Uint {
+			return value{}, errNotConstant
+		}
+		var x *big.Int
+		if op == BinaryLshift {
+			x = new(big.Int).Lsh(l.Val, uint(count))
+		} else {
+			x = new(big.Int).Rsh(l.signed(), uint(count))
+		}
+		return value{
+			Type: l.Type,
+			Val:  mask(x, l.Type.Bits),
+		}, nil
+	}
+
+	if l.Untyped && r.Untyped {
+		return ip.untypedBinary(loc, op, l.Val, r.Val)
+	}
+	var err error
+	if l.Untyped {
+		l, err = l.assign(r.Type)
+	} else if r.Untyped {
+		r, err = r.assign(l.Type)
+	}
+	if err != nil {
+		return value{}, err
+	}
+
+	if l.Type.Type == types.String && r.Type.Type == types.String {
+		return stringBinary(op, l, r)
+	}
+	if !l.Type.Equal(r.Type) {
+		return value{}, errNotConstant
+	}
+
+	switch op {
+	case BinaryEq:
+		return boolValue(l.Val.Cmp(r.Val) == 0), nil
+	case BinaryNeq:
+		return boolValue(l.Val.Cmp(r.Val) != 0), nil
+	}
+
+	t := l.Type
+	if t.Type != types.Int && t.Type != types.Uint {
+		return value{}, errNotConstant
+	}
+
+	var x *big.Int
+	switch op {
+	case BinaryLt:
+		return boolValue(l.Val.Cmp(r.Val) < 0), nil
+	case BinaryLe:
+		return boolValue(l.Val.Cmp(r.Val) <= 0), nil
+	case BinaryGt:
+		return boolValue(l.Val.Cmp(r.Val) > 0), nil
+	case BinaryGe:
+		return boolValue(l.Val.Cmp(r.Val) >= 0), nil
+	case BinaryMult:
+		x = new(big.Int).Mul(l.Val, r.Val)
+	case BinaryPlus:
+		x = new(big.Int).Add(l.Val, r.Val)
+	case BinaryMinus:
+		x = new(big.Int).Sub(l.Val, r.Val)
+	case BinaryDiv, BinaryMod:
+		if r.Val.Sign() == 0 {
+			return value{}, ip.ctx.logger.Errorf(loc,
+				"invalid operation: division by zero")
+		}
+		if op == BinaryDiv {
+			x = new(big.Int).Quo(l.Val, r.Val)
+		} else {
+			x = new(big.Int).Rem(l.Val, r.Val)
+		}
+	case BinaryBand:
+		x = new(big.Int).And(l.Val, r.Val)
+	case BinaryBclear:
+		x = new(big.Int).AndNot(l.Val, r.Val)
+	case BinaryBor:
+		x = new(big.Int).Or(l.Val, r.Val)
+	case BinaryBxor:
+		x = new(big.Int).Xor(l.Val, r.Val)
+	default:
+		return value{}, errNotConstant
+	}
+	return value{
+		Type: t,
+		Val:  mask(x, t.Bits),
+	}, nil
+}
+
+// untypedBinary computes the binary operation op for the untyped
+// integer values.
+func (ip *interp) untypedBinary(loc utils.Point, op BinaryType,
+	l, r *big.Int) (value, error) {
+
+	var x *big.Int
+	switch op {
+	case BinaryEq:
+		return boolValue(l.Cmp(r) == 0), nil
+	case BinaryNeq:
+		return boolValue(l.Cmp(r) != 0), nil
+	case BinaryLt:
+		return boolValue(l.Cmp(r) < 0), nil
+	case BinaryLe:
+		return boolValue(l.Cmp(r) <= 0), nil
+	case BinaryGt:
+		return boolValue(l.Cmp(r) > 0), nil
+	case BinaryGe:
+		return boolValue(l.Cmp(r) >= 0), nil
+	case BinaryMult:
+		x = new(big.Int).Mul(l, r)
+	case BinaryPlus:
+		x = new(big.Int).Add(l, r)
+	case BinaryMinus:
+		x = new(big.Int).Sub(l, r)
+	case BinaryDiv, BinaryMod:
+		if r.Sign() == 0 {
+			return value{}, ip.ctx.logger.Errorf(loc,
+				"invalid operation: division by zero")
+		}
+		if op == BinaryDiv {
+			x = new(big.Int).Quo(l, r)
+		} else {
+			x = new(big.Int).Rem(l, r)
+		}
+	case BinaryBand:
+		x = new(big.Int).And(l, r)
+	case BinaryBclear:
+		x = new(big.Int).AndNot(l, r)
+	case BinaryBor:
+		x = new(big.Int).Or(l, r)
+	case BinaryBxor:
+		x = new(big.Int).Xor(l, r)
+	default:
+		return value{}, errNotConstant
+	}
+	return untyped(x), nil
+}
+
+// stringBinary computes the binary operation op for the string
+// values. The comparisons pad the shorter string with zero bytes.
+func stringBinary(op BinaryType, l, r value) (value, error) {
+	if op == BinaryPlus {
+		t := l.Type
+		t.Bits += r.Type.Bits
+		t.MinBits = t.Bits
+		val := new(big.Int).Lsh(r.Val, uint(l.Type.Bits))
+		val.Or(val, l.Val)
+		return value{
+			Type: t,
+			Val:  val,
+		}, nil
+	}
+
+	n := l.Type.Bits / 8
+	if r.Type.Bits/8 > n {
+		n = r.Type.Bits / 8
+	}
+	cmp := reverseString(l.Val, n).Cmp(reverseString(r.Val, n))
+
+	switch op {
+	case BinaryEq:
+		return boolValue(cmp == 0), nil
+	case BinaryNeq:
+		return boolValue(cmp != 0), nil
+	case BinaryLt:
+		return boolValue(cmp < 0), nil
+	case BinaryLe:
+		return boolValue(cmp <= 0), nil
+	case BinaryGt:
+		return boolValue(cmp > 0), nil
+	case BinaryGe:
+		return boolValue(cmp >= 0), nil
+	default:
+		return value{}, errNotConstant
+	}
+}
+
+// reverseString reverses the byte order of the n byte string value
+// x so that the first byte becomes the most significant.
+func reverseString(x *big.Int, n int) *big.Int {
+	result := new(big.Int)
+	for i := 0; i < n; i++ {
+		b := new(big.Int).Rsh(x, uint(i*8))
+		result.Lsh(result, 8)
+		result.Or(result, mask(b, 8))
+	}
+	return result
+}
+
+// evalCompositeLit evaluates the structure literal.
+func (ip *interp) evalCompositeLit(fr *frame, lit *CompositeLit) (
+	value, error) {
+
+	t, err := lit.Type.Resolve(fr.env, ip.ctx, ip.gen)
+	if err != nil || t.Type != types.Struct {
+		return value{}, errNotConstant
+	}
+	result := value{
+		Type: t,
+		Val:  new(big.Int),
+	}
+	for idx, e := range lit.Value {
+		name := e.Key
+		if len(name) == 0 {
+			if idx >= len(t.Struct) {
+				return value{}, errNotConstant
+			}
+			name = t.Struct[idx].Name
+		}
+		v, err := ip.eval1(fr, e.Element)
+		if err != nil {
+			return value{}, err
+		}
+		result, err = result.setField(name, v)
+		if err != nil {
+			return value{}, err
+		}
+	}
+	return result, nil
+}
+
+// constField returns the named field of the constant structure.
+func constField(val ssa.CompoundValue, name string) (interface{}, bool, error) {
+	v, err := value{Type: val.Type, Val: val.Value}.field(name)
+	if err != nil {
+		return nil, false, nil
+	}
+	c, err := v.variable()
+	if err != nil {
+		return nil, false, nil
+	}
+	return c.ConstValue, true, nil
+}
+
+// constIndex returns the element index of the constant array.
+func constIndex(ctx *Codegen, loc utils.Point, val ssa.CompoundValue,
+	index int) (interface{}, bool, error) {
+
+	_, count, ok := elementType(val.Type)
+	if !ok {
+		return nil, false, nil
+	}
+	if index < 0 || index >= count {
+		return nil, false, ctx.logger.Errorf(loc,
+			"invalid argument: index %d out of bounds [0:%d]", index, count)
+	}
+	v, err := value{Type: val.Type, Val: val.Value}.index(index)
+	if err != nil {
+		return nil, false, nil
+	}
+	c, err := v.variable()
+	if err != nil {
+		return nil, false, nil
+	}
+	return c.ConstValue, true, nil
+}
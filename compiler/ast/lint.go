@@ -0,0 +1,483 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ast
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// lintVar describes a local variable for the lint analysis.
+type lintVar struct {
+	name string
+	loc  utils.Point
+	arg  bool
+	used bool
+}
+
+// lintScope implements a lexical scope of local variables.
+type lintScope struct {
+	parent *lintScope
+	vars   map[string]*lintVar
+	order  []*lintVar
+}
+
+func (s *lintScope) lookup(name string) (*lintVar, bool) {
+	for ; s != nil; s = s.parent {
+		v, ok := s.vars[name]
+		if ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// linter implements the AST analysis for compiler warnings.
+type linter struct {
+	ctx     *Codegen
+	pkg     *Package
+	scope   *lintScope
+	imports map[string]bool
+}
+
+// lint analyzes the package and reports warnings for unused
+// variables, unused imports, and shadowed names.
+func (pkg *Package) lint(ctx *Codegen) {
+	w := ctx.warnings
+	if !w.Unused && !w.UnusedImport && !w.Shadow {
+		return
+	}
+	l := &linter{
+		ctx:     ctx,
+		pkg:     pkg,
+		imports: make(map[string]bool),
+	}
+
+	for _, t := range pkg.Types {
+		l.typeInfo(t)
+	}
+	for _, c := range pkg.Constants {
+		l.typeInfo(c.Type)
+		l.expr(c.Init)
+	}
+
+	var funcs []*Func
+	for _, f := range pkg.Functions {
+		funcs = append(funcs, f)
+	}
+	for _, methods := range pkg.Methods {
+		for _, f := range methods {
+			funcs = append(funcs, f)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		a, b := funcs[i].Loc, funcs[j].Loc
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	for _, f := range funcs {
+		l.function(f)
+	}
+
+	if !w.UnusedImport {
+		return
+	}
+	var aliases []string
+	for alias := range pkg.Imports {
+		if !l.imports[alias] {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		ctx.warningf(pkg.ImportLocs[alias], "%q imported and not used",
+			pkg.Imports[alias])
+	}
+}
+
+func (l *linter) function(f *Func) {
+	l.push()
+	if f.Receiver != nil {
+		l.typeInfo(f.Receiver.Type)
+		l.define(f.Receiver.Name, f.Receiver.Loc, true).used = true
+	}
+	for _, tp := range f.TypeParams {
+		l.typeInfo(tp.Type)
+	}
+	for _, arg := range f.Args {
+		l.typeInfo(arg.Type)
+		l.define(arg.Name, arg.Loc, true)
+	}
+	for _, ret := range f.Return {
+		l.typeInfo(ret.Type)
+		if len(ret.Name) > 0 && ret.Name[0] != '%' {
+			l.define(ret.Name, ret.Loc, true).used = true
+		}
+	}
+	l.list(f.Body)
+	l.pop()
+}
+
+func (l *linter) push() {
+	l.scope = &lintScope{
+		parent: l.scope,
+		vars:   make(map[string]*lintVar),
+	}
+}
+
+func (l *linter) pop() {
+	if l.ctx.warnings.Unused {
+		for _, v := range l.scope.order {
+			if v.used {
+				continue
+			}
+			if v.arg {
+				l.ctx.warningf(v.loc, "argument %s is unused", v.name)
+			} else {
+				l.ctx.warningf(v.loc, "%s declared and not used", v.name)
+			}
+		}
+	}
+	l.scope = l.scope.parent
+}
+
+// shadow warns if the variable declaration shadows a variable of an
+// enclosing scope.
+func (l *linter) shadow(name string, loc utils.Point) {
+	if !l.ctx.warnings.Shadow || l.scope.parent == nil {
+		return
+	}
+	prev, ok := l.scope.parent.lookup(name)
+	if ok {
+		l.ctx.warningf(loc, "declaration of %s shadows declaration at %s",
+			name, prev.loc)
+	}
+}
+
+// define defines a local variable in the current scope.
+func (l *linter) define(name string, loc utils.Point, arg bool) *lintVar {
+	v := &lintVar{
+		name: name,
+		loc:  loc,
+		arg:  arg,
+	}
+	_, ok := l.scope.vars[name]
+	if !ok {
+		l.scope.order = append(l.scope.order, v)
+	}
+	l.scope.vars[name] = v
+	return v
+}
+
+// use marks the name used. The name can be a local variable or an
+// imported package.
+func (l *linter) use(name string) {
+	v, ok := l.scope.lookup(name)
+	if ok {
+		v.used = true
+		return
+	}
+	_, ok = l.pkg.Imports[name]
+	if ok {
+		l.imports[name] = true
+	}
+}
+
+func (l *linter) typeInfo(ti *TypeInfo) {
+	if ti == nil {
+		return
+	}
+	if len(ti.Name.Package) > 0 {
+		l.use(ti.Name.Package)
+	} else {
+		l.use(ti.Name.Name)
+	}
+	l.typeInfo(ti.ElementType)
+	l.typeInfo(ti.AliasType)
+	for _, f := range ti.StructFields {
+		l.typeInfo(f.Type)
+	}
+	l.expr(ti.ArrayLength)
+}
+
+func (l *linter) list(list List) {
+	l.push()
+	for _, stmt := range list {
+		l.stmt(stmt)
+	}
+	l.pop()
+}
+
+func (l *linter) stmt(stmt AST) {
+	switch s := stmt.(type) {
+	case List:
+		l.list(s)
+
+	case *VariableDef:
+		l.typeInfo(s.Type)
+		l.expr(s.Init)
+		for _, name := range s.Names {
+			l.shadow(name, s.Loc)
+			l.define(name, s.Loc, false)
+		}
+
+	case *Assign:
+		for _, expr := range s.Exprs {
+			l.expr(expr)
+		}
+		for _, lv := range s.LValues {
+			ref, ok := lv.(*VariableRef)
+			if s.Define && ok && len(ref.Name.Package) == 0 {
+				_, defined := l.scope.vars[ref.Name.Name]
+				if !defined {
+					l.shadow(ref.Name.Name, ref.Loc)
+					l.define(ref.Name.Name, ref.Loc, false)
+				}
+				continue
+			}
+			l.lvalue(lv)
+		}
+
+	case *If:
+		l.expr(s.Expr)
+		l.list(s.True)
+		if s.False != nil {
+			l.list(s.False)
+		}
+
+	case *For:
+		l.push()
+		l.stmt(s.Init)
+		l.expr(s.Cond)
+		l.stmt(s.Inc)
+		l.list(s.Body)
+		l.pop()
+
+	case *Switch:
+		l.expr(s.Expr)
+		for _, c := range s.Cases {
+			for _, expr := range c.Exprs {
+				l.expr(expr)
+			}
+			l.list(c.Body)
+		}
+
+	case *Return:
+		for _, expr := range s.Exprs {
+			l.expr(expr)
+		}
+
+	case nil:
+
+	default:
+		l.expr(stmt)
+	}
+}
+
+// lvalue analyzes the assignment lvalue. Assigning to a variable, or
+// to its fields and elements, does not use the variable.
+func (l *linter) lvalue(lv AST) {
+	switch lv := lv.(type) {
+	case *VariableRef:
+	case *Selector:
+		l.lvalue(lv.Expr)
+	case *Index:
+		l.lvalue(lv.Expr)
+		l.expr(lv.Index)
+	default:
+		l.expr(lv)
+	}
+}
+
+func (l *linter) expr(expr AST) {
+	switch e := expr.(type) {
+	case *VariableRef:
+		if len(e.Name.Package) > 0 {
+			l.use(e.Name.Package)
+		} else {
+			l.use(e.Name.Name)
+		}
+
+	case *Binary:
+		l.expr(e.Left)
+		l.expr(e.Right)
+
+	case *Call:
+		l.expr(e.Recv)
+		if len(e.Name.Package) > 0 {
+			l.use(e.Name.Package)
+		} else {
+			// Local types are used in conversions.
+			l.use(e.Name.Name)
+		}
+		for _, arg := range e.Exprs {
+			l.expr(arg)
+		}
+
+	case *Index:
+		l.expr(e.Expr)
+		l.expr(e.Index)
+
+	case *Slice:
+		l.expr(e.Expr)
+		l.expr(e.From)
+		l.expr(e.To)
+
+	case *Selector:
+		l.expr(e.Expr)
+
+	case *CompositeLit:
+		l.typeInfo(e.Type)
+		for _, el := range e.Value {
+			l.expr(el.Element)
+		}
+
+	case *Conversion:
+		l.typeInfo(e.Type)
+		l.expr(e.Expr)
+	}
+}
+
+// warningf reports the warning once for each source location. Only
+// the warnings of the compiled package are reported.
+func (ctx *Codegen) warningf(loc utils.Point, format string,
+	a ...interface{}) {
+
+	if ctx.Package != ctx.main {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	key := fmt.Sprintf("%s: %s", loc, msg)
+	if ctx.warned[key] {
+		return
+	}
+	if ctx.warned == nil {
+		ctx.warned = make(map[string]bool)
+	}
+	ctx.warned[key] = true
+	ctx.logger.Warningf(loc, "%s", msg)
+}
+
+// checkTruncate warns if assigning the value v to a variable of type
+// t implicitly truncates the value.
+func (ctx *Codegen) checkTruncate(loc utils.Point, v ssa.Variable,
+	t types.Info) {
+
+	if !ctx.warnings.Truncate {
+		return
+	}
+	if t.Type != types.Int && t.Type != types.Uint {
+		return
+	}
+	if v.Type.Type != types.Int && v.Type.Type != types.Uint {
+		return
+	}
+	if v.Const {
+		if v.Type.MinBits > t.Bits {
+			ctx.warningf(loc, "constant %s overflows %s", v, t)
+		}
+		return
+	}
+	if v.Type.Bits > t.Bits {
+		ctx.warningf(loc, "implicit conversion from %s to %s truncates value",
+			v.Type, t)
+	}
+}
+
+// checkCompare tests if the comparison is always true or false
+// because the constant operand is outside the range of the other
+// operand's type. The function warns about such comparisons and
+// returns their result and true.
+func (ctx *Codegen) checkCompare(ast *Binary, l, r ssa.Variable) (
+	bool, bool) {
+
+	op := ast.Op
+	switch op {
+	case BinaryEq, BinaryNeq, BinaryLt, BinaryLe, BinaryGt, BinaryGe:
+	default:
+		return false, false
+	}
+
+	var v, c ssa.Variable
+	if r.Const && !l.Const {
+		v, c = l, r
+	} else if l.Const && !r.Const {
+		v, c = r, l
+		switch op {
+		case BinaryLt:
+			op = BinaryGt
+		case BinaryLe:
+			op = BinaryGe
+		case BinaryGt:
+			op = BinaryLt
+		case BinaryGe:
+			op = BinaryLe
+		}
+	} else {
+		return false, false
+	}
+	if v.Type.Type != types.Int && v.Type.Type != types.Uint {
+		return false, false
+	}
+	cv, err := constValue(c)
+	if err != nil || !cv.Untyped {
+		return false, false
+	}
+	x := cv.Val
+
+	min := new(big.Int)
+	max := new(big.Int).Lsh(big.NewInt(1), uint(v.Type.Bits))
+	if v.Type.Type == types.Int {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	max.Sub(max, big.NewInt(1))
+
+	var result, always bool
+	switch op {
+	case BinaryEq, BinaryNeq:
+		if x.Cmp(min) < 0 || x.Cmp(max) > 0 {
+			always = true
+			result = op == BinaryNeq
+		}
+	case BinaryLt:
+		if x.Cmp(min) <= 0 {
+			always, result = true, false
+		} else if x.Cmp(max) > 0 {
+			always, result = true, true
+		}
+	case BinaryLe:
+		if x.Cmp(min) < 0 {
+			always, result = true, false
+		} else if x.Cmp(max) >= 0 {
+			always, result = true, true
+		}
+	case BinaryGt:
+		if x.Cmp(max) >= 0 {
+			always, result = true, false
+		} else if x.Cmp(min) < 0 {
+			always, result = true, true
+		}
+	case BinaryGe:
+		if x.Cmp(max) > 0 {
+			always, result = true, false
+		} else if x.Cmp(min) <= 0 {
+			always, result = true, true
+		}
+	}
+	if always && ctx.warnings.Compare {
+		ctx.warningf(ast.Loc, "comparison %s is always %v", ast, result)
+	}
+	return result, always
+}
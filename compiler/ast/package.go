@@ -8,6 +8,7 @@ package ast
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/ssa"
@@ -15,38 +16,64 @@ import (
 	"github.com/markkurossi/mpc/compiler/utils"
 )
 
-// Package implements a MPCL package.
+// Package implements a MPCL package. The ID identifies the package
+// in the compilation's packages; the imported packages are identified
+// by their directories since different packages can have the same
+// name. The ImportIDs map the import aliases to the IDs of the
+// imported packages.
 type Package struct {
 	Name        string
+	ID          string
 	Initialized bool
 	Imports     map[string]string
+	ImportIDs   map[string]string
+	ImportLocs  map[string]utils.Point
 	Bindings    ssa.Bindings
 	Types       []*TypeInfo
 	Constants   []*ConstantDef
 	Functions   map[string]*Func
+	Methods     map[string]map[string]*Func
 }
 
 // NewPackage creates a new package.
 func NewPackage(name string) *Package {
 	return &Package{
 		Name:      name,
+		ID:        name,
 		Imports:   make(map[string]string),
+		ImportIDs: make(map[string]string),
 		Functions: make(map[string]*Func),
+		Methods:   make(map[string]map[string]*Func),
 	}
 }
 
 // Compile compiles the package.
 func (pkg *Package) Compile(packages map[string]*Package, logger *utils.Logger,
 	params *utils.Params) (*ssa.Program, Annotations, error) {
+	return pkg.CompileFunc(packages, logger, params, "main")
+}
+
+// CompileFunc compiles the package using the named function as the
+// program's entry point.
+func (pkg *Package) CompileFunc(packages map[string]*Package,
+	logger *utils.Logger, params *utils.Params, name string) (
+	*ssa.Program, Annotations, error) {
 
-	main, ok := pkg.Functions["main"]
+	main, ok := pkg.Functions[name]
 	if !ok {
 		return nil, nil, logger.Errorf(utils.Point{},
-			"no main function defined")
+			"no %s function defined", name)
+	}
+
+	if len(main.TypeParams) > 0 {
+		return nil, nil, logger.Errorf(main.Loc,
+			"func %s must have no type parameters", name)
 	}
 
 	gen := ssa.NewGenerator(params)
 	ctx := NewCodegen(logger, pkg, packages, params.Verbose)
+	ctx.warnings = params.Warnings
+	pkg.lint(ctx)
 
 	// Init package.
 	err := pkg.Init(packages, ctx, gen)
@@ -54,6 +81,10 @@ func (pkg *Package) Compile(packages map[string]*Package, logger *utils.Logger,
 		return nil, nil, err
 	}
 
+	// The package constants are evaluated also when the call
+	// evaluation is disabled.
+	ctx.noCallEval = params.NoCallEval
+
 	ctx.PushCompilation(gen.Block(), gen.Block(), nil, main)
 	ctx.Start().Bindings = pkg.Bindings.Clone()
 
@@ -137,6 +168,7 @@ func (pkg *Package) Compile(packages map[string]*Package, logger *utils.Logger,
 	if err != nil {
 		return nil, nil, err
 	}
+	program.Optimize()
 	program.GC()
 
 	if params.SSAOut != nil {
@@ -185,7 +217,7 @@ func (pkg *Package) Init(packages map[string]*Package, ctx *Codegen,
 
 	// Imported packages.
 	for alias, name := range pkg.Imports {
-		p, ok := packages[alias]
+		p, ok := packages[pkg.ImportIDs[alias]]
 		if !ok {
 			return fmt.Errorf("imported and not used: \"%s\"", name)
 		}
@@ -195,6 +227,13 @@ func (pkg *Package) Init(packages map[string]*Package, ctx *Codegen,
 		}
 	}
 
+	// The types and constants refer to the imports of this package.
+	callerPkg := ctx.Package
+	ctx.Package = pkg
+	defer func() {
+		ctx.Package = callerPkg
+	}()
+
 	// Define types.
 	for _, typeDef := range pkg.Types {
 		err := pkg.defineType(typeDef, ctx, gen)
@@ -203,6 +242,38 @@ func (pkg *Package) Init(packages map[string]*Package, ctx *Codegen,
 		}
 	}
 
+	// Check that the receiver types of the methods are defined.
+	var typeNames []string
+	for typeName := range pkg.Methods {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Strings(typeNames)
+	var first error
+	for _, typeName := range typeNames {
+		b, ok := pkg.Bindings.Get(typeName)
+		if ok {
+			v, ok := b.Bound.(*ssa.Variable)
+			if ok && v.TypeRef {
+				continue
+			}
+		}
+		var names []string
+		for name := range pkg.Methods[typeName] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			err := ctx.logger.Errorf(pkg.Methods[typeName][name].Loc,
+				"undefined receiver type %s", typeName)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if first != nil {
+		return first
+	}
+
 	// Define constants.
 
 	block := gen.Block()
@@ -258,6 +329,8 @@ func (pkg *Package) defineType(def *TypeInfo, ctx *Codegen,
 			Bits:    bits,
 			MinBits: minBits,
 			Struct:  fields,
+			Name:    def.TypeName,
+			Package: pkg.ID,
 		}
 
 		v, err := ssa.Constant(info)
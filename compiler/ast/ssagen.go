@@ -8,26 +8,65 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
 )
 
 // SSA implements the compiler.ast.AST.SSA for list statements.
 func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
 
-	var err error
+	var first error
+
+	frame := gen.Loc
+	defer func() {
+		gen.Loc = frame
+	}()
 
 	for _, b := range ast {
+		loc := &utils.Location{
+			Point: b.Location(),
+		}
+		if frame != nil {
+			loc.Func = frame.Func
+			loc.Caller = frame.Caller
+		}
+		gen.Loc = loc
+
 		if block.Dead {
 			ctx.logger.Warningf(b.Location(), "unreachable code")
 			break
 		}
-		block, _, err = b.SSA(block, ctx, gen)
+		// On errors, restore the compilation state and continue with
+		// the next statement to report all errors of the function. The
+		// failed statement can leave the block with partial branches
+		// so the next statement starts from a fresh block.
+		depth := len(ctx.Stack)
+		pkg := ctx.Package
+
+		next, _, err := b.SSA(block, ctx, gen)
 		if err != nil {
-			return nil, nil, err
+			if first == nil {
+				first = err
+			}
+			ctx.Stack = ctx.Stack[:depth]
+			ctx.Package = pkg
+			ctx.defineFailed(b)
+			if ctx.logger.TooManyErrors() {
+				break
+			}
+			fresh := gen.Block()
+			fresh.Bindings = block.Bindings.Clone()
+			block = fresh
+			continue
 		}
+		block = next
+	}
+	if first != nil {
+		return nil, nil, first
 	}
 
 	return block, nil, nil
@@ -37,8 +76,20 @@ func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 func (ast *Func) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
 
-	ctx.Start().Name = fmt.Sprintf("%s#%d", ast.Name, ast.NumInstances)
-	ctx.Return().Name = fmt.Sprintf("%s.ret#%d", ast.Name, ast.NumInstances)
+	name := ast.QualifiedName()
+
+	callSite := gen.Loc
+	gen.Loc = &utils.Location{
+		Point:  ast.Loc,
+		Func:   fmt.Sprintf("%s.%s", ctx.Package.Name, name),
+		Caller: callSite,
+	}
+	defer func() {
+		gen.Loc = callSite
+	}()
+
+	ctx.Start().Name = fmt.Sprintf("%s#%d", name, ast.NumInstances)
+	ctx.Return().Name = fmt.Sprintf("%s.ret#%d", name, ast.NumInstances)
 	ast.NumInstances++
 
 	// Define return variables.
@@ -151,7 +202,7 @@ func (ast *VariableDef) SSA(block *ssa.Block, ctx *Codegen,
 			switch lValue.Type.Type {
 			case types.Bool:
 				initVal = false
-			case types.Int, types.Uint:
+			case types.Int, types.Uint, types.Struct, types.Array:
 				initVal = int32(0)
 			case types.String:
 				initVal = ""
@@ -175,6 +226,7 @@ func (ast *VariableDef) SSA(block *ssa.Block, ctx *Codegen,
 					"multiple-value %s used in single-value context", ast.Init)
 			}
 			init = v[0]
+			ctx.checkTruncate(ast.Init.Location(), init, lValue.Type)
 		}
 		block.AddInstr(ssa.NewMovInstr(init, lValue))
 	}
@@ -200,6 +252,7 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 			if err != nil {
 				return nil, nil, err
 			}
+			gen.AddConstant(constVar)
 			values = append(values, constVar)
 		} else {
 			var v []ssa.Variable
@@ -221,6 +274,33 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 	}
 
 	for idx, lv := range ast.LValues {
+		base, path, ok := fieldLValue(lv, block.Bindings)
+		if ok {
+			if ast.Define {
+				return nil, nil, ctx.logger.Errorf(ast.Loc,
+					"non-name %s on left side of :=", lv)
+			}
+			block, err = assignField(block, ctx, gen, lv, base, path,
+				values[idx])
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		index, ok := lv.(*Index)
+		if ok {
+			if ast.Define {
+				return nil, nil, ctx.logger.Errorf(ast.Loc,
+					"non-name %s on left side of :=", lv)
+			}
+			block, err = assignElement(block, ctx, gen, index, values[idx])
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
 		ref, ok := lv.(*VariableRef)
 		if !ok {
 			return nil, nil, ctx.logger.Errorf(ast.Loc,
@@ -248,6 +328,11 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 			if err != nil {
 				return nil, nil, err
 			}
+			loc := ast.Loc
+			if len(ast.Exprs) == len(ast.LValues) {
+				loc = ast.Exprs[idx].Location()
+			}
+			ctx.checkTruncate(loc, values[idx], lValue.Type)
 		}
 
 		block.AddInstr(ssa.NewMovInstr(values[idx], lValue))
@@ -257,6 +342,191 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 	return block, values, nil
 }
 
+// fieldLValue tests if the assignment lvalue lv selects a structure
+// field. It returns the name of the variable holding the structure
+// and the path of the selected fields.
+func fieldLValue(lv AST, bindings ssa.Bindings) (string, []string, bool) {
+	switch lv := lv.(type) {
+	case *VariableRef:
+		if len(lv.Name.Package) == 0 {
+			return "", nil, false
+		}
+		_, ok := bindings.Get(lv.Name.Package)
+		if !ok {
+			return "", nil, false
+		}
+		return lv.Name.Package, []string{lv.Name.Name}, true
+
+	case *Selector:
+		ref, ok := lv.Expr.(*VariableRef)
+		if ok && len(ref.Name.Package) == 0 {
+			return ref.Name.Name, []string{lv.Name}, true
+		}
+		base, path, ok := fieldLValue(lv.Expr, bindings)
+		if !ok {
+			return "", nil, false
+		}
+		return base, append(path, lv.Name), true
+	}
+	return "", nil, false
+}
+
+// assignField assigns the value v into the structure field, selected
+// by the path from the variable base.
+func assignField(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	lv AST, base string, path []string, v ssa.Variable) (*ssa.Block, error) {
+
+	b, ok := block.Bindings.Get(base)
+	if !ok {
+		return nil, ctx.logger.Errorf(lv.Location(), "undefined: %s", base)
+	}
+	value := b.Value(block, gen)
+
+	var offset int
+	t := value.Type
+	expr := base
+	for _, name := range path {
+		if t.Type != types.Struct {
+			return nil, ctx.logger.Errorf(lv.Location(),
+				"%s.%s undefined", expr, name)
+		}
+		field, ok := structField(t, name)
+		if !ok {
+			return nil, ctx.logger.Errorf(lv.Location(),
+				"%s.%s undefined (type %s has no field or method %s)",
+				expr, name, t, name)
+		}
+		offset += field.Type.Offset
+		t = field.Type
+		expr += "." + name
+	}
+	if !(ssa.Variable{Type: t}).TypeCompatible(v) {
+		return nil, ctx.logger.Errorf(lv.Location(),
+			"cannot use %s (type %s) as type %s in assignment", v, v.Type, t)
+	}
+
+	from, to, err := fieldBounds(offset, t.Bits)
+	if err != nil {
+		return nil, err
+	}
+	lValue, err := gen.NewVar(b.Name, b.Type, ctx.Scope())
+	if err != nil {
+		return nil, err
+	}
+	block.AddInstr(ssa.NewAmovInstr(v, value, from, to, lValue))
+	block.Bindings.Set(lValue, nil)
+
+	return block, nil
+}
+
+// assignElement assigns the value v into the array element, selected
+// by the index lvalue lv. Secret index values update all elements,
+// keeping their old values unless the index matches.
+func assignElement(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	lv *Index, v ssa.Variable) (*ssa.Block, error) {
+
+	ref, ok := lv.Expr.(*VariableRef)
+	if !ok || len(ref.Name.Package) > 0 {
+		return nil, ctx.logger.Errorf(lv.Location(), "cannot assign to %s", lv)
+	}
+	b, ok := block.Bindings.Get(ref.Name.Name)
+	if !ok {
+		return nil, ctx.logger.Errorf(lv.Location(), "undefined: %s",
+			ref.Name)
+	}
+	value := b.Value(block, gen)
+	if value.Type.Type != types.Array {
+		return nil, ctx.logger.Errorf(lv.Location(),
+			"cannot assign to %s (type %s does not support indexing)",
+			lv, value.Type)
+	}
+	elType, count, _ := elementType(value.Type)
+	if !(ssa.Variable{Type: elType}).TypeCompatible(v) {
+		return nil, ctx.logger.Errorf(lv.Location(),
+			"cannot use %s (type %s) as type %s in assignment",
+			v, v.Type, elType)
+	}
+
+	block, val, err := lv.Index.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) != 1 {
+		return nil, ctx.logger.Errorf(lv.Index.Location(),
+			"invalid index %s", lv.Index)
+	}
+	index := val[0]
+	if index.Type.Type != types.Int && index.Type.Type != types.Uint {
+		return nil, ctx.logger.Errorf(lv.Index.Location(),
+			"invalid argument: index %s (type %s) must be integer",
+			lv.Index, index.Type)
+	}
+
+	if index.Const {
+		i, err := intVal(index.ConstValue)
+		if err != nil {
+			return nil, ctx.logger.Errorf(lv.Index.Location(), "%s", err)
+		}
+		if i < 0 || i >= count {
+			return nil, ctx.logger.Errorf(lv.Index.Location(),
+				"invalid argument: index %d out of bounds [0:%d]", i, count)
+		}
+		from, to, err := fieldBounds(i*elType.Bits, elType.Bits)
+		if err != nil {
+			return nil, err
+		}
+		lValue, err := gen.NewVar(b.Name, b.Type, ctx.Scope())
+		if err != nil {
+			return nil, err
+		}
+		block.AddInstr(ssa.NewAmovInstr(v, value, from, to, lValue))
+		block.Bindings.Set(lValue, nil)
+		return block, nil
+	}
+
+	el := gen.AnonVar(elType)
+	block.AddInstr(ssa.NewMovInstr(v, el))
+	v = el
+
+	for i := 0; i < count; i++ {
+		if index.Type.Bits < 31 && i >= 1<<index.Type.Bits {
+			// The index can't have this value.
+			break
+		}
+		from, to, err := fieldBounds(i*elType.Bits, elType.Bits)
+		if err != nil {
+			return nil, err
+		}
+		old := gen.AnonVar(elType)
+		block.AddInstr(ssa.NewSliceInstr(value, from, to, old))
+
+		k, err := ssa.Constant(int32(i))
+		if err != nil {
+			return nil, err
+		}
+		gen.AddConstant(k)
+		eq := gen.AnonVar(types.BoolType())
+		instr, err := ssa.NewEqInstr(index, k, eq)
+		if err != nil {
+			return nil, err
+		}
+		block.AddInstr(instr)
+
+		next := gen.AnonVar(elType)
+		block.AddInstr(ssa.NewPhiInstr(eq, v, old, next))
+
+		lValue, err := gen.NewVar(b.Name, b.Type, ctx.Scope())
+		if err != nil {
+			return nil, err
+		}
+		block.AddInstr(ssa.NewAmovInstr(next, value, from, to, lValue))
+		block.Bindings.Set(lValue, nil)
+		value = lValue
+	}
+
+	return block, nil
+}
+
 // SSA implements the compiler.ast.AST.SSA for if statements.
 func (ast *If) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
@@ -358,12 +628,32 @@ func (ast *If) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
 
-	// Generate call values.
-
 	var callValues [][]ssa.Variable
 	var v []ssa.Variable
 	var err error
 
+	// Generate method receiver.
+	recv := ast.receiver(&Env{
+		Bindings: block.Bindings,
+	})
+	var recvValue ssa.Variable
+	if recv != nil {
+		block, v, err = recv.SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) == 0 {
+			return nil, nil, ctx.logger.Errorf(recv.Location(),
+				"%s used as value", recv)
+		}
+		if len(v) > 1 {
+			return nil, nil, ctx.logger.Errorf(recv.Location(),
+				"multiple-value %s in single-value context", recv)
+		}
+		recvValue = v[0]
+	}
+
+	// Generate call values.
 	for _, expr := range ast.Exprs {
 		block, v, err = expr.SSA(block, ctx, gen)
 		if err != nil {
@@ -374,17 +664,35 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 
 	// Resolve called.
 	var pkg *Package
-	if len(ast.Name.Package) > 0 {
-		var ok bool
-		pkg, ok = ctx.Packages[ast.Name.Package]
+	var called *Func
+	var ok bool
+	if recv != nil {
+		t := recvValue.Type
+		pkg, ok = ctx.Packages[t.Package]
+		if ok {
+			called, ok = pkg.Methods[t.Name][ast.Name.Name]
+		}
 		if !ok {
+			typeName := t.Name
+			if len(typeName) == 0 {
+				typeName = t.String()
+			}
 			return nil, nil, ctx.logger.Errorf(ast.Loc,
-				"package '%s' not found", ast.Name.Package)
+				"%s.%s undefined (type %s has no method %s)",
+				recv, ast.Name.Name, typeName, ast.Name.Name)
 		}
 	} else {
-		pkg = ctx.Package
+		if len(ast.Name.Package) > 0 {
+			pkg, ok = ctx.importedPackage(ast.Name.Package)
+			if !ok {
+				return nil, nil, ctx.logger.Errorf(ast.Loc,
+					"package '%s' not found", ast.Name.Package)
+			}
+		} else {
+			pkg = ctx.Package
+		}
+		called, ok = pkg.Functions[ast.Name.Name]
 	}
-	called, ok := pkg.Functions[ast.Name.Name]
 	if !ok {
 		// Check builtin functions.
 		for _, bi := range builtins {
@@ -426,7 +734,11 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"multiple-value %s in single-value context", ast.Exprs[0])
 		}
 
-		// Convert value to type
+		// Convert value to type. Unsized types get their size from
+		// the value.
+		if typeInfo.Bits == 0 {
+			typeInfo.Bits = callValues[0][0].Type.Bits
+		}
 		t := gen.AnonVar(typeInfo)
 		block.AddInstr(ssa.NewMovInstr(callValues[0][0], t))
 
@@ -483,15 +795,46 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		}
 	}
 
+	params := called.Args
+	if called.Receiver != nil {
+		params = append([]*Variable{called.Receiver}, params...)
+		args = append([]ssa.Variable{recvValue}, args...)
+	}
+
+	// Evaluate calls with constant arguments at compile time.
+	if !ctx.noCallEval {
+		results, ok, err := ctx.evalCall(ast.Loc, gen, pkg, called, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			for _, r := range results {
+				gen.AddConstant(r)
+			}
+			return block, results, nil
+		}
+	}
+
 	// Return block.
 	rblock := gen.Block()
 	rblock.Bindings = block.Bindings.Clone()
 
 	ctx.PushCompilation(gen.Block(), gen.Block(), rblock, called)
+	ctx.Start().Bindings = pkg.Bindings.Clone()
+
+	// The called function resolves its names in its own package.
+	callerPkg := ctx.Package
+	ctx.Package = pkg
+
+	err = called.instantiate(ast.Loc, ctx, gen, &ctx.Start().Bindings,
+		params, args)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Define arguments.
-	for idx, arg := range called.Args {
-		typeInfo, err := arg.Type.Resolve(NewEnv(block), ctx, gen)
+	for idx, arg := range params {
+		typeInfo, err := arg.Type.Resolve(NewEnv(ctx.Start()), ctx, gen)
 		if err != nil {
 			return nil, nil, ctx.logger.Errorf(arg.Loc,
 				"invalid argument type: %s", err)
@@ -508,7 +851,11 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"invalid value %v for argument %d of %s",
 				args[idx].Type, idx, called)
 		}
-		ctx.Start().Bindings.Set(a, &args[idx])
+		if ctx.noCallEval {
+			ctx.Start().Bindings.Set(a, nil)
+		} else {
+			ctx.Start().Bindings.Set(a, &args[idx])
+		}
 
 		block.AddInstr(ssa.NewMovInstr(args[idx], a))
 	}
@@ -525,6 +872,7 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	block = rblock
 
 	ctx.PopCompilation()
+	ctx.Package = callerPkg
 
 	return block, returnValues, nil
 }
@@ -631,7 +979,14 @@ func (ast *Return) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return block, nil, nil
 }
 
-// SSA implements the compiler.ast.AST.SSA for for statements.
+// SSA implements the compiler.ast.AST.SSA for for statements. The
+// loop is unrolled as long as its condition is true. If the condition
+// depends on non-constant values, it must also contain a public
+// iteration bound as a constant conjunct, for example
+// `i < 64 && b != 0'. The loop body is guarded with an active
+// predicate which is cleared when the data-dependent condition
+// becomes false or when the loop is terminated with a break
+// statement.
 func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
 
@@ -647,30 +1002,98 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		return nil, nil, ctx.logger.Errorf(ast.Init.Location(),
 			"init statement is not compile-time constant: %s", err)
 	}
+	block.Bindings = env.Bindings
+
+	// Define loop predicates. The active predicate tells if the loop
+	// is still running and the iter predicate tells if the current
+	// iteration is running i.e. it has not executed a continue
+	// statement.
+	active := ctx.tmpName("active")
+	block, _, err = tmpAssign(ast.Loc, active, true,
+		&Constant{Loc: ast.Loc, Value: true}).SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	iter := active
+	body := ast.Body
+
+	r := &branchRewriter{
+		brk: func(loc utils.Point) List {
+			return List{
+				tmpAssign(loc, active, false,
+					&Constant{Loc: loc, Value: false}),
+				tmpAssign(loc, iter, false,
+					&Constant{Loc: loc, Value: false}),
+			}
+		},
+		cont: func(loc utils.Point) List {
+			return List{
+				tmpAssign(loc, iter, false,
+					&Constant{Loc: loc, Value: false}),
+			}
+		},
+	}
+	if r.hasAny(body) {
+		iter = ctx.tmpName("iter")
+		r.guard = iter
+		body = r.rewrite(body)
+
+		block, _, err = tmpAssign(ast.Loc, iter, true,
+			&Constant{Loc: ast.Loc, Value: true}).SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	env = NewEnv(block)
 
 	// Expand body as long as condition is true.
 	for {
-		constVal, ok, err := ast.Cond.Eval(env, ctx, gen)
+		running, cond, err := ast.loopCond(env, ctx, gen)
 		if err != nil {
 			return nil, nil, err
 		}
-		if !ok {
-			return nil, nil, ctx.logger.Errorf(ast.Cond.Location(),
-				"condition is not compile-time constant: %s", err)
-		}
-		val, ok := constVal.(bool)
-		if !ok {
-			return nil, nil, ctx.logger.Errorf(ast.Cond.Location(),
-				"condition is not boolean expression")
-		}
-		if !val {
+		if !running {
 			// Loop completed.
 			break
 		}
 		block.Bindings = env.Bindings
 
+		if cond != nil {
+			// Clear active predicate when the condition becomes
+			// false.
+			val, ok, err := tmpRef(ast.Loc, active).Eval(env, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok || val != true {
+				cond = &Binary{
+					Loc:   cond.Location(),
+					Left:  tmpRef(ast.Loc, active),
+					Op:    BinaryAnd,
+					Right: cond,
+				}
+			}
+			block, _, err = tmpAssign(ast.Loc, active, false,
+				cond).SSA(block, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if iter != active {
+			block, _, err = tmpAssign(ast.Loc, iter, false,
+				tmpRef(ast.Loc, active)).SSA(block, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// Expand block.
-		block, _, err = ast.Body.SSA(block, ctx, gen)
+		guarded := &If{
+			Loc:  ast.Loc,
+			Expr: tmpRef(ast.Loc, iter),
+			True: body,
+		}
+		block, _, err = guarded.SSA(block, ctx, gen)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -685,11 +1108,207 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			return nil, nil, ctx.logger.Errorf(ast.Init.Location(),
 				"increment statement is not compile-time constant: %s", ast.Inc)
 		}
+
+		// Check if the loop was terminated with break.
+		val, ok, err := tmpRef(ast.Loc, active).Eval(env, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok && val == false {
+			break
+		}
 	}
 
 	return block, nil, nil
 }
 
+// loopCond evaluates the loop condition for the next iteration. It
+// returns false if the loop has completed. Otherwise it returns the
+// data-dependent part of the condition or nil if the condition is
+// compile-time constant.
+func (ast *For) loopCond(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	bool, AST, error) {
+
+	var cond AST
+	var bounded bool
+
+	for _, c := range conjuncts(ast.Cond) {
+		constVal, ok, err := c.Eval(env, ctx, gen)
+		if err != nil {
+			return false, nil, err
+		}
+		if !ok {
+			if cond == nil {
+				cond = c
+			} else {
+				cond = &Binary{
+					Loc:   c.Location(),
+					Left:  cond,
+					Op:    BinaryAnd,
+					Right: c,
+				}
+			}
+			continue
+		}
+		val, ok := constVal.(bool)
+		if !ok {
+			return false, nil, ctx.logger.Errorf(c.Location(),
+				"condition is not boolean expression")
+		}
+		if !val {
+			return false, nil, nil
+		}
+		bounded = true
+	}
+	if cond != nil && !bounded {
+		return false, nil, ctx.logger.Errorf(ast.Cond.Location(),
+			"condition is not compile-time constant and loop has no public iteration bound: %s",
+			ast.Cond)
+	}
+	return true, cond, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for break statements. The
+// break statements are rewritten by their enclosing for and switch
+// statements.
+func (ast *Break) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Variable, error) {
+	return nil, nil, ctx.logger.Errorf(ast.Loc,
+		"break is not in a loop or switch")
+}
+
+// SSA implements the compiler.ast.AST.SSA for continue statements.
+// The continue statements are rewritten by their enclosing for
+// statements.
+func (ast *Continue) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+	return nil, nil, ctx.logger.Errorf(ast.Loc, "continue is not in a loop")
+}
+
+// SSA implements the compiler.ast.AST.SSA for switch statements. The
+// switch is lowered into a chain of if-else statements which are
+// merged with phi functions as normal if statements. The tag
+// expression is evaluated only once before the case comparisons.
+func (ast *Switch) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Variable, error) {
+
+	cases := ast.Cases
+
+	// Rewrite break statements which terminate the switch.
+	r := &branchRewriter{}
+	r.brk = func(loc utils.Point) List {
+		return List{
+			tmpAssign(loc, r.guard, false, &Constant{Loc: loc, Value: false}),
+		}
+	}
+	for _, c := range cases {
+		if r.hasAny(c.Body) {
+			r.guard = ctx.tmpName("switch")
+			break
+		}
+	}
+	if len(r.guard) > 0 {
+		var err error
+		block, _, err = tmpAssign(ast.Loc, r.guard, true,
+			&Constant{Loc: ast.Loc, Value: true}).SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		cases = nil
+		for _, c := range ast.Cases {
+			cases = append(cases, &Case{
+				Loc:     c.Loc,
+				Default: c.Default,
+				Exprs:   c.Exprs,
+				Body:    r.rewrite(c.Body),
+			})
+		}
+	}
+
+	var tag AST
+	if ast.Expr != nil {
+		var v []ssa.Variable
+		var err error
+		block, v, err = ast.Expr.SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) == 0 {
+			return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+				"%s used as value", ast.Expr)
+		} else if len(v) > 1 {
+			return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+				"multiple-value %s used in single-value context", ast.Expr)
+		}
+		tag = &ssaValue{
+			Loc:   ast.Expr.Location(),
+			Value: v[0],
+		}
+	}
+
+	var def *Case
+	var first, last *If
+
+	for _, c := range cases {
+		if c.Default {
+			def = c
+			continue
+		}
+		var cond AST
+		for _, expr := range c.Exprs {
+			if tag != nil {
+				expr = &Binary{
+					Loc:   expr.Location(),
+					Left:  tag,
+					Op:    BinaryEq,
+					Right: expr,
+				}
+			}
+			if cond == nil {
+				cond = expr
+			} else {
+				cond = &Binary{
+					Loc:   expr.Location(),
+					Left:  cond,
+					Op:    BinaryOr,
+					Right: expr,
+				}
+			}
+		}
+		stmt := &If{
+			Loc:  c.Loc,
+			Expr: cond,
+			True: c.Body,
+		}
+		if last == nil {
+			first = stmt
+		} else {
+			last.False = List{stmt}
+		}
+		last = stmt
+	}
+	if def != nil {
+		if last == nil {
+			return def.Body.SSA(block, ctx, gen)
+		}
+		last.False = def.Body
+	}
+	if first == nil {
+		return block, nil, nil
+	}
+	return first.SSA(block, ctx, gen)
+}
+
+// SSA implements the compiler.ast.AST.SSA for SSA values.
+func (ast *ssaValue) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+
+	if ast.Value.Const {
+		gen.AddConstant(ast.Value)
+	}
+	return block, []ssa.Variable{ast.Value}, nil
+}
+
 // SSA implements the compiler.ast.AST.SSA for binary expressions.
 func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
@@ -742,10 +1361,33 @@ func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	l := lArr[0]
 	r := rArr[0]
 
-	if !l.TypeCompatible(r) {
-		return nil, nil,
-			ctx.logger.Errorf(ast.Loc, "invalid types: %s %s %s",
-				l.Type, ast.Op, r.Type)
+	if l.Type.Type == types.String && r.Type.Type == types.String {
+		return ast.stringSSA(block, ctx, gen, l, r)
+	}
+
+	if result, ok := ctx.checkCompare(ast, l, r); ok {
+		v, err := ssa.Constant(result)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(v)
+		return block, []ssa.Variable{v}, nil
+	}
+
+	switch ast.Op {
+	case BinaryLshift, BinaryRshift:
+		// The shift count can be of any integer type.
+		if r.Type.Type != types.Int && r.Type.Type != types.Uint {
+			return nil, nil, ctx.logger.Errorf(ast.Right.Location(),
+				"invalid shift count type %s", r.Type)
+		}
+
+	default:
+		if !l.TypeCompatible(r) {
+			return nil, nil,
+				ctx.logger.Errorf(ast.Loc, "invalid types: %s %s %s",
+					l.Type, ast.Op, r.Type)
+		}
 	}
 
 	// Resolve target type.
@@ -778,7 +1420,7 @@ func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	case BinaryLshift:
 		instr = ssa.NewLshiftInstr(l, r, t)
 	case BinaryRshift:
-		instr = ssa.NewRshiftInstr(l, r, t)
+		instr, err = ssa.NewRshiftInstr(l.Type, l, r, t)
 	case BinaryBand:
 		instr, err = ssa.NewBandInstr(l, r, t)
 	case BinaryBclear:
@@ -821,6 +1463,310 @@ func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return block, []ssa.Variable{t}, nil
 }
 
+// stringSSA implements the binary operations for fixed-size strings.
+// The strings are compared as byte arrays where the shorter string is
+// padded with zero bytes.
+func (ast *Binary) stringSSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator, l, r ssa.Variable) (
+	*ssa.Block, []ssa.Variable, error) {
+
+	switch ast.Op {
+	case BinaryPlus:
+		bits := l.Type.Bits + r.Type.Bits
+		t := types.Info{
+			Type:    types.String,
+			Bits:    bits,
+			MinBits: bits,
+		}
+		tmp := gen.AnonVar(t)
+		block.AddInstr(ssa.NewMovInstr(l, tmp))
+
+		from, to, err := fieldBounds(l.Type.Bits, r.Type.Bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := gen.AnonVar(t)
+		block.AddInstr(ssa.NewAmovInstr(r, tmp, from, to, v))
+
+		return block, []ssa.Variable{v}, nil
+
+	case BinaryLt, BinaryLe, BinaryGt, BinaryGe, BinaryEq, BinaryNeq:
+		n := l.Type.Bits / 8
+		if r.Type.Bits/8 > n {
+			n = r.Type.Bits / 8
+		}
+		lv, err := reverseBytes(block, gen, l, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		rv, err := reverseBytes(block, gen, r, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		t := gen.AnonVar(types.BoolType())
+
+		var instr ssa.Instr
+		switch ast.Op {
+		case BinaryLt:
+			instr, err = ssa.NewLtInstr(lv.Type, lv, rv, t)
+		case BinaryLe:
+			instr, err = ssa.NewLeInstr(lv.Type, lv, rv, t)
+		case BinaryGt:
+			instr, err = ssa.NewGtInstr(lv.Type, lv, rv, t)
+		case BinaryGe:
+			instr, err = ssa.NewGeInstr(lv.Type, lv, rv, t)
+		case BinaryEq:
+			instr, err = ssa.NewEqInstr(lv, rv, t)
+		case BinaryNeq:
+			instr, err = ssa.NewNeqInstr(lv, rv, t)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		block.AddInstr(instr)
+
+		return block, []ssa.Variable{t}, nil
+
+	default:
+		return nil, nil, ctx.logger.Errorf(ast.Loc,
+			"invalid operation: operator %s not defined on %s (type %s)",
+			ast.Op, ast.Left, l.Type)
+	}
+}
+
+// reverseBytes returns the n-byte string v as an unsigned integer
+// where the first byte of the string is the most significant byte.
+// This makes the integer comparison order match the lexicographic
+// order of the strings.
+func reverseBytes(block *ssa.Block, gen *ssa.Generator, v ssa.Variable,
+	n int) (ssa.Variable, error) {
+
+	t := types.Info{
+		Type:    types.Uint,
+		Bits:    n * 8,
+		MinBits: n * 8,
+	}
+	if v.Const {
+		str, ok := v.ConstValue.(string)
+		if !ok {
+			return v, fmt.Errorf("invalid string constant %s", v)
+		}
+		val := new(big.Int)
+		for i := 0; i < len(str); i++ {
+			b := big.NewInt(int64(str[i]))
+			val.Or(val, b.Lsh(b, uint((n-1-i)*8)))
+		}
+		c, err := ssa.Constant(val)
+		if err != nil {
+			return c, err
+		}
+		c.Type = t
+		gen.AddConstant(c)
+		return c, nil
+	}
+
+	zero, err := ssa.Constant(int32(0))
+	if err != nil {
+		return zero, err
+	}
+	gen.AddConstant(zero)
+	result := gen.AnonVar(t)
+	block.AddInstr(ssa.NewMovInstr(zero, result))
+
+	for i := 0; i < v.Type.Bits/8; i++ {
+		b := gen.AnonVar(types.Info{
+			Type:    types.Uint,
+			Bits:    8,
+			MinBits: 8,
+		})
+		from, to, err := fieldBounds(i*8, 8)
+		if err != nil {
+			return zero, err
+		}
+		block.AddInstr(ssa.NewSliceInstr(v, from, to, b))
+
+		from, to, err = fieldBounds((n-1-i)*8, 8)
+		if err != nil {
+			return zero, err
+		}
+		next := gen.AnonVar(t)
+		block.AddInstr(ssa.NewAmovInstr(b, result, from, to, next))
+		result = next
+	}
+	return result, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for selector expressions.
+func (ast *Selector) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+
+	block, v, err := ast.Expr.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+			"%s used as value", ast.Expr)
+	} else if len(v) > 1 {
+		return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+			"multiple-value %s in single-value context", ast.Expr)
+	}
+	return selectField(block, ctx, gen, ast.Loc, ast.Expr.String(), v[0],
+		ast.Name)
+}
+
+// selectField selects the field name from the structure value.
+func selectField(block *ssa.Block, ctx *Codegen, gen *ssa.Generator,
+	loc utils.Point, expr string, value ssa.Variable, name string) (
+	*ssa.Block, []ssa.Variable, error) {
+
+	if value.Type.Type != types.Struct {
+		return nil, nil, ctx.logger.Errorf(loc, "%s.%s undefined", expr, name)
+	}
+	field, ok := structField(value.Type, name)
+	if !ok {
+		return nil, nil, ctx.logger.Errorf(loc,
+			"%s.%s undefined (type %s has no field or method %s)",
+			expr, name, value.Type, name)
+	}
+
+	if value.Const {
+		val, err := constValue(value)
+		if err == nil {
+			val, err = val.field(name)
+		}
+		if err == nil {
+			c, err := val.variable()
+			if err == nil {
+				gen.AddConstant(c)
+				return block, []ssa.Variable{c}, nil
+			}
+		}
+	}
+
+	fieldType := field.Type
+	fieldType.Offset = 0
+	fieldType.MinBits = fieldType.Bits
+	t := gen.AnonVar(fieldType)
+
+	fromConst, toConst, err := fieldBounds(field.Type.Offset, field.Type.Bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	block.AddInstr(ssa.NewSliceInstr(value, fromConst, toConst, t))
+	return block, []ssa.Variable{t}, nil
+}
+
+// structField returns the named field of the structure type t.
+func structField(t types.Info, name string) (types.StructField, bool) {
+	for _, f := range t.Struct {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return types.StructField{}, false
+}
+
+// fieldBounds returns the bit range constants for the field at
+// offset with size bits.
+func fieldBounds(offset, bits int) (ssa.Variable, ssa.Variable, error) {
+	from, err := ssa.Constant(int32(offset))
+	if err != nil {
+		return from, from, err
+	}
+	to, err := ssa.Constant(int32(offset + bits))
+	if err != nil {
+		return from, to, err
+	}
+	return from, to, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for composite literal
+// values. The literal value is constructed by assigning its fields
+// into the zero value of the literal type.
+func (ast *CompositeLit) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+
+	typeInfo, err := ast.Type.Resolve(NewEnv(block), ctx, gen)
+	if err != nil {
+		return nil, nil, ctx.logger.Errorf(ast.Loc, "%s", err)
+	}
+	if typeInfo.Type != types.Struct {
+		return nil, nil, ctx.logger.Errorf(ast.Loc,
+			"invalid type for composite literal: %s", ast.Type)
+	}
+	var keyed bool
+	if len(ast.Value) > 0 {
+		keyed = len(ast.Value[0].Key) > 0
+		if !keyed && len(ast.Value) < len(typeInfo.Struct) {
+			return nil, nil, ctx.logger.Errorf(ast.Loc,
+				"too few values in %s", ast)
+		}
+		if !keyed && len(ast.Value) > len(typeInfo.Struct) {
+			return nil, nil, ctx.logger.Errorf(ast.Loc,
+				"too many values in %s", ast)
+		}
+	}
+
+	zero, err := ssa.Constant(int32(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	gen.AddConstant(zero)
+
+	value := gen.AnonVar(typeInfo)
+	block.AddInstr(ssa.NewMovInstr(zero, value))
+
+	seen := make(map[string]bool)
+	for idx, e := range ast.Value {
+		if (len(e.Key) > 0) != keyed {
+			return nil, nil, ctx.logger.Errorf(e.Element.Location(),
+				"mixture of field:value and value elements in struct literal")
+		}
+		var field types.StructField
+		if keyed {
+			var ok bool
+			field, ok = structField(typeInfo, e.Key)
+			if !ok {
+				return nil, nil, ctx.logger.Errorf(e.Element.Location(),
+					"unknown field '%s' in struct literal of type %s",
+					e.Key, ast.Type)
+			}
+			if seen[e.Key] {
+				return nil, nil, ctx.logger.Errorf(e.Element.Location(),
+					"duplicate field name %s in struct literal", e.Key)
+			}
+			seen[e.Key] = true
+		} else {
+			field = typeInfo.Struct[idx]
+		}
+
+		var v []ssa.Variable
+		block, v, err = e.Element.SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) != 1 {
+			return nil, nil, ctx.logger.Errorf(e.Element.Location(),
+				"multiple-value %s in single-value context", e.Element)
+		}
+		if !(ssa.Variable{Type: field.Type}).TypeCompatible(v[0]) {
+			return nil, nil, ctx.logger.Errorf(e.Element.Location(),
+				"cannot use %s (type %s) as type %s in field value",
+				e.Element, v[0].Type, field.Type)
+		}
+		from, to, err := fieldBounds(field.Type.Offset, field.Type.Bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		t := gen.AnonVar(typeInfo)
+		block.AddInstr(ssa.NewAmovInstr(v[0], value, from, to, t))
+		value = t
+	}
+
+	return block, []ssa.Variable{value}, nil
+}
+
 // SSA implements the compiler.ast.AST.SSA for slice expressions.
 func (ast *Slice) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Variable, error) {
@@ -899,58 +1845,184 @@ func (ast *Slice) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return block, []ssa.Variable{t}, nil
 }
 
-// SSA implements the compiler.ast.AST.SSA for variable references.
-func (ast *VariableRef) SSA(block *ssa.Block, ctx *Codegen,
-	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
-
-	var b ssa.Binding
-	var ok bool
+// SSA implements the compiler.ast.AST.SSA for index expressions.
+func (ast *Index) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Variable, error) {
 
-	// Check if package name is bound to variable.
-	b, ok = block.Bindings.Get(ast.Name.Package)
+	// Check constant folding.
+	constVal, ok, err := ast.Eval(NewEnv(block), ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
 	if ok {
-		// Selector.
-		value := b.Value(block, gen)
-		if value.Type.Type != types.Struct {
-			return nil, nil, ctx.logger.Errorf(ast.Loc,
-				"%s.%s undefined", ast.Name.Package, ast.Name.Name)
+		v, err := ssa.Constant(constVal)
+		if err != nil {
+			return nil, nil, err
 		}
+		gen.AddConstant(v)
+		return block, []ssa.Variable{v}, nil
+	}
 
-		var field *types.StructField
-		for _, f := range value.Type.Struct {
-			if f.Name == ast.Name.Name {
-				field = &f
-				break
-			}
+	block, expr, err := ast.Expr.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(expr) != 1 {
+		return nil, nil, ctx.logger.Errorf(ast.Loc, "invalid expression")
+	}
+	value := expr[0]
+
+	elType, count, ok := elementType(value.Type)
+	if !ok {
+		return nil, nil, ctx.logger.Errorf(ast.Loc,
+			"invalid operation: %s (type %s does not support indexing)",
+			ast, value.Type)
+	}
+
+	block, val, err := ast.Index.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(val) != 1 {
+		return nil, nil, ctx.logger.Errorf(ast.Index.Location(),
+			"invalid index %s", ast.Index)
+	}
+	index := val[0]
+	if index.Type.Type != types.Int && index.Type.Type != types.Uint {
+		return nil, nil, ctx.logger.Errorf(ast.Index.Location(),
+			"invalid argument: index %s (type %s) must be integer",
+			ast.Index, index.Type)
+	}
+
+	if index.Const {
+		i, err := intVal(index.ConstValue)
+		if err != nil {
+			return nil, nil, ctx.logger.Errorf(ast.Index.Location(), "%s", err)
 		}
-		if field == nil {
-			return nil, nil, ctx.logger.Errorf(ast.Loc,
-				"%s.%s undefined (type %s has no field or method %s)",
-				ast.Name.Package, ast.Name.Name, value.Type, ast.Name.Name)
+		if i < 0 || i >= count {
+			return nil, nil, ctx.logger.Errorf(ast.Index.Location(),
+				"invalid argument: index %d out of bounds [0:%d]", i, count)
+		}
+		t := gen.AnonVar(elType)
+		from, to, err := fieldBounds(i*elType.Bits, elType.Bits)
+		if err != nil {
+			return nil, nil, err
 		}
+		block.AddInstr(ssa.NewSliceInstr(value, from, to, t))
+		return block, []ssa.Variable{t}, nil
+	}
 
-		t := gen.AnonVar(types.Info{
-			Type:    field.Type.Type,
-			Bits:    field.Type.Bits,
-			MinBits: field.Type.Bits,
-		})
+	// Secret index. Select the element by comparing the index against
+	// all element positions. Out of range index values select zero.
+	zero, err := ssa.Constant(int32(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	gen.AddConstant(zero)
+	result := gen.AnonVar(elType)
+	block.AddInstr(ssa.NewMovInstr(zero, result))
 
-		fromConst, err := ssa.Constant(int32(field.Type.Offset))
+	for i := 0; i < count; i++ {
+		if index.Type.Bits < 31 && i >= 1<<index.Type.Bits {
+			// The index can't have this value.
+			break
+		}
+		el := gen.AnonVar(elType)
+		from, to, err := fieldBounds(i*elType.Bits, elType.Bits)
 		if err != nil {
 			return nil, nil, err
 		}
-		toConst, err := ssa.Constant(int32(field.Type.Offset + field.Type.Bits))
+		block.AddInstr(ssa.NewSliceInstr(value, from, to, el))
+
+		k, err := ssa.Constant(int32(i))
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(k)
+		eq := gen.AnonVar(types.BoolType())
+		instr, err := ssa.NewEqInstr(index, k, eq)
 		if err != nil {
 			return nil, nil, err
 		}
+		block.AddInstr(instr)
 
-		block.AddInstr(ssa.NewSliceInstr(value, fromConst, toConst, t))
-		return block, []ssa.Variable{t}, nil
+		next := gen.AnonVar(elType)
+		block.AddInstr(ssa.NewPhiInstr(eq, el, result, next))
+		result = next
+	}
+
+	return block, []ssa.Variable{result}, nil
+}
+
+// elementType returns the element type and the number of elements of
+// the indexable type t.
+func elementType(t types.Info) (types.Info, int, bool) {
+	switch t.Type {
+	case types.String:
+		return types.Info{
+			Type:    types.Uint,
+			Bits:    8,
+			MinBits: 8,
+		}, t.Bits / 8, true
+
+	case types.Array:
+		return *t.ElementType, t.ArraySize, true
+
+	default:
+		return types.Info{}, 0, false
+	}
+}
+
+// SSA implements the compiler.ast.AST.SSA for type conversions.
+func (ast *Conversion) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+
+	typeInfo, err := ast.Type.Resolve(NewEnv(block), ctx, gen)
+	if err != nil {
+		return nil, nil, ctx.logger.Errorf(ast.Loc, "%s", err)
+	}
+	block, val, err := ast.Expr.SSA(block, ctx, gen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(val) == 0 {
+		return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+			"%s used as value", ast.Expr)
+	}
+	if len(val) > 1 {
+		return nil, nil, ctx.logger.Errorf(ast.Expr.Location(),
+			"multiple-value %s in single-value context", ast.Expr)
+	}
+	if val[0].Type.Bits != typeInfo.Bits {
+		return nil, nil, ctx.logger.Errorf(ast.Loc,
+			"cannot convert %s (type %s) to type %s",
+			ast.Expr, val[0].Type, typeInfo)
+	}
+
+	t := gen.AnonVar(typeInfo)
+	block.AddInstr(ssa.NewMovInstr(val[0], t))
+
+	return block, []ssa.Variable{t}, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for variable references.
+func (ast *VariableRef) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Variable, error) {
+
+	var b ssa.Binding
+	var ok bool
+
+	// Check if package name is bound to variable.
+	b, ok = block.Bindings.Get(ast.Name.Package)
+	if ok {
+		// Selector.
+		return selectField(block, ctx, gen, ast.Loc, ast.Name.Package,
+			b.Value(block, gen), ast.Name.Name)
 	}
 
 	if len(ast.Name.Package) > 0 {
 		var pkg *Package
-		pkg, ok = ctx.Packages[ast.Name.Package]
+		pkg, ok = ctx.importedPackage(ast.Name.Package)
 		if !ok {
 			return nil, nil,
 				ctx.logger.Errorf(ast.Loc, "package '%s' not found",
@@ -961,8 +2033,7 @@ func (ast *VariableRef) SSA(block *ssa.Block, ctx *Codegen,
 		b, ok = block.Bindings.Get(ast.Name.Name)
 	}
 	if !ok {
-		return nil, nil, ctx.logger.Errorf(ast.Loc, "undefined variable '%s'",
-			ast.Name.String())
+		return nil, nil, ctx.errUndefined(ast.Loc, ast.Name)
 	}
 
 	value := b.Value(block, gen)
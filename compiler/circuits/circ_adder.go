@@ -52,8 +52,13 @@ func NewFullAdder(compiler *Compiler, a, b, cin, s, cout *Wire) {
 	}
 }
 
-// NewAdder creates a new adder circuit implementing z=x+y.
+// NewAdder creates a new adder circuit implementing z=x+y. The adder
+// is a ripple-carry adder, or a parallel prefix adder if the compiler
+// creates depth-optimized circuits.
 func NewAdder(compiler *Compiler, x, y, z []*Wire) error {
+	if compiler.lowDepth() {
+		return NewPrefixAdder(compiler, x, y, z)
+	}
 	x, y = compiler.ZeroPad(x, y)
 	if len(z) < len(x) {
 		return fmt.Errorf("Invalid adder arguments: x=%d, y=%d, z=%d",
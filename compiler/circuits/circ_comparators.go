@@ -14,6 +14,9 @@ import (
 
 // comparator tests if x>y if cin=0, and x>=y if cin=1.
 func comparator(compiler *Compiler, cin *Wire, x, y, r []*Wire) error {
+	if compiler.lowDepth() {
+		return prefixComparator(compiler, cin, x, y, r)
+	}
 	x, y = compiler.ZeroPad(x, y)
 	if len(r) != 1 {
 		return fmt.Errorf("invalid lt comparator arguments: r=%d", len(r))
@@ -70,6 +73,15 @@ func NewNeqComparator(compiler *Compiler, x, y, r []*Wire) error {
 		compiler.AddGate(NewBinary(circuit.XOR, x[0], y[0], r[0]))
 		return nil
 	}
+	if compiler.lowDepth() {
+		xors := make([]*Wire, len(x))
+		for i := range x {
+			xors[i] = NewWire()
+			compiler.AddGate(NewBinary(circuit.XOR, x[i], y[i], xors[i]))
+		}
+		orTree(compiler, xors, r[0])
+		return nil
+	}
 
 	c := NewWire()
 	compiler.AddGate(NewBinary(circuit.XOR, x[0], y[0], c))
@@ -0,0 +1,357 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// csdDigit specifies a non-zero digit of the canonical signed digit
+// representation of a number.
+type csdDigit struct {
+	shift int
+	neg   bool
+}
+
+// csd returns the non-zero digits of the canonical signed digit (CSD)
+// representation of the non-negative number c, from the most
+// significant digit to the least significant digit. The CSD
+// representation has no adjacent non-zero digits and it has the
+// minimum number of non-zero digits of all signed digit
+// representations.
+func csd(c *big.Int) []csdDigit {
+	var digits []csdDigit
+
+	v := new(big.Int).Set(c)
+	for shift := 0; v.Sign() > 0; shift++ {
+		if v.Bit(0) != 0 {
+			if v.Bit(1) != 0 {
+				// v mod 4 = 3: digit -1.
+				digits = append(digits, csdDigit{
+					shift: shift,
+					neg:   true,
+				})
+				v.Add(v, big.NewInt(1))
+			} else {
+				// v mod 4 = 1: digit 1.
+				digits = append(digits, csdDigit{
+					shift: shift,
+				})
+				v.Sub(v, big.NewInt(1))
+			}
+		}
+		v.Rsh(v, 1)
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return digits
+}
+
+// NewConstMultiplier creates a multiplier circuit implementing z=x*c
+// for the non-negative constant c. The multiplication is computed
+// with the shifts, additions, and subtractions of the canonical
+// signed digit representation of the constant. The shifts do not
+// create any gates and the additions and subtractions of x<<k only
+// compute the bits k and above. If the compiler creates
+// depth-optimized circuits, the shifted terms are added with one
+// carry-save adder tree instead of a chain of adders.
+func NewConstMultiplier(cc *Compiler, x []*Wire, c *big.Int, z []*Wire) error {
+	if cc.lowDepth() {
+		return newConstMultiplierTree(cc, x, c, z)
+	}
+	acc := make([]*Wire, len(z))
+	for i := range acc {
+		acc[i] = cc.ZeroWire()
+	}
+	for idx, digit := range csd(c) {
+		k := digit.shift
+		if k >= len(z) {
+			continue
+		}
+		shifted := x
+		if len(shifted) > len(z)-k {
+			shifted = shifted[:len(z)-k]
+		}
+		if idx == 0 {
+			// The most significant digit is always positive.
+			copy(acc[k:], shifted)
+			continue
+		}
+		r := MakeWires(len(z) - k)
+		var err error
+		if digit.neg {
+			err = NewSubtractor(cc, acc[k:], shifted, r)
+		} else {
+			err = NewAdder(cc, acc[k:], shifted, r)
+		}
+		if err != nil {
+			return err
+		}
+		copy(acc[k:], r)
+	}
+	copy(z, acc)
+	return nil
+}
+
+// newConstMultiplierTree creates a depth-optimized multiplier circuit
+// implementing z=x*c for the non-negative constant c. The terms of
+// the canonical signed digit representation are added in columns
+// with the Dadda reduction. The negative terms -(x<<k) are computed
+// as (^x<<k)+2^k where the constant parts of all terms are summed
+// into one constant row.
+func newConstMultiplierTree(cc *Compiler, x []*Wire, c *big.Int,
+	z []*Wire) error {
+
+	n := len(z)
+	columns := make([][]*Wire, n)
+	constant := new(big.Int)
+
+	for _, digit := range csd(c) {
+		k := digit.shift
+		if k >= n {
+			continue
+		}
+		if !digit.neg {
+			for j := k; j < n && j-k < len(x); j++ {
+				columns[j] = append(columns[j], x[j-k])
+			}
+			continue
+		}
+		constant.Add(constant, new(big.Int).Lsh(big.NewInt(1), uint(k)))
+		for j := k; j < n; j++ {
+			if j-k < len(x) {
+				w := NewWire()
+				cc.INV(x[j-k], w)
+				columns[j] = append(columns[j], w)
+			} else {
+				// The high bits of ^x are ones.
+				constant.Add(constant,
+					new(big.Int).Lsh(big.NewInt(1), uint(j)))
+			}
+		}
+	}
+	for j := 0; j < n; j++ {
+		if constant.Bit(j) != 0 {
+			columns[j] = append(columns[j], cc.OneWire())
+		}
+	}
+	return addColumns(cc, columns, z)
+}
+
+// magic returns the shift p and the magic number m=ceil(2^p/d) for
+// dividing n-bit numbers by the constant d. The quotient is the
+// product x*m shifted right by p bits. The function returns the
+// smallest p for which the error e=m*d-2^p satisfies
+// e*(2^n-1)<2^p. This condition guarantees that the quotient is exact
+// for all n-bit numbers x. The condition holds for
+// p=n+ceil(log2(d)).
+func magic(n int, d *big.Int) (int, *big.Int) {
+	max := new(big.Int).Lsh(big.NewInt(1), uint(n))
+	max.Sub(max, big.NewInt(1))
+
+	var p int
+	var m *big.Int
+	for p = n; ; p++ {
+		pow := new(big.Int).Lsh(big.NewInt(1), uint(p))
+		m = new(big.Int).Add(pow, d)
+		m.Sub(m, big.NewInt(1))
+		m.Div(m, d)
+
+		e := new(big.Int).Mul(m, d)
+		e.Sub(e, pow)
+		if e.Mul(e, max).Cmp(pow) < 0 {
+			return p, m
+		}
+	}
+}
+
+// NewConstDivider creates a division circuit computing q=a/d and
+// r=a%d for the positive constant d. The quotient or the remainder
+// can be nil if it is not needed. The division by a power of two is
+// computed with shifts and masks which do not create any gates. The
+// other divisions are computed with constant multiplications by
+// multiplying the dividend with a magic number m=ceil(2^p/d), where
+// p is at most len(a)+ceil(log2(d)). The high bits p and above of the
+// product are the quotient and the remainder is computed as a-q*d.
+func NewConstDivider(cc *Compiler, a []*Wire, d *big.Int, q, r []*Wire) error {
+	n := len(a)
+	l := d.BitLen()
+
+	var quotient []*Wire
+	if d.TrailingZeroBits() == uint(l-1) {
+		// Power of two.
+		l--
+		quotient = make([]*Wire, 0, n)
+		if l < n {
+			quotient = append(quotient, a[l:]...)
+		}
+		for i := range r {
+			if i < l && i < n {
+				r[i] = a[i]
+			} else {
+				r[i] = cc.ZeroWire()
+			}
+		}
+		r = nil
+	} else {
+		p, m := magic(n, d)
+
+		product := MakeWires(n + m.BitLen())
+		err := NewConstMultiplier(cc, a, m, product)
+		if err != nil {
+			return err
+		}
+		if p < len(product) {
+			quotient = product[p:]
+		}
+	}
+
+	for i := range q {
+		if i < len(quotient) {
+			q[i] = quotient[i]
+		} else {
+			q[i] = cc.ZeroWire()
+		}
+	}
+	if r == nil {
+		return nil
+	}
+
+	qd := MakeWires(n)
+	err := NewConstMultiplier(cc, quotient, d, qd)
+	if err != nil {
+		return err
+	}
+	rem := MakeWires(n)
+	err = NewSubtractor(cc, a, qd, rem)
+	if err != nil {
+		return err
+	}
+	for i := range r {
+		if i < n {
+			r[i] = rem[i]
+		} else {
+			r[i] = cc.ZeroWire()
+		}
+	}
+	return nil
+}
+
+// ConstMultiplierCheaper tests if the constant multiplier
+// NewConstMultiplier is cheaper than the generic multiplier for
+// computing the product of the xBits wide value and the cBits wide
+// constant k into the zBits wide result.
+func (c *Compiler) ConstMultiplierCheaper(xBits, cBits, zBits int,
+	k *big.Int) (bool, error) {
+
+	key := fmt.Sprintf("mult,%d,%d,%d,%s", xBits, cBits, zBits, k)
+	return c.constCheaper(key, xBits, cBits, zBits, k,
+		func(cc *Compiler, x, y, z []*Wire) error {
+			return NewConstMultiplier(cc, x, k, z)
+		},
+		func(cc *Compiler, x, y, z []*Wire) error {
+			return NewMultiplier(cc, cc.Params.CircMultArrayTreshold,
+				x, y, z)
+		})
+}
+
+// ConstDividerCheaper tests if the constant divider NewConstDivider is
+// cheaper than the generic divider for computing the quotient or the
+// remainder of the aBits wide dividend and the dBits wide constant
+// divisor d into the zBits wide result.
+func (c *Compiler) ConstDividerCheaper(aBits, dBits, zBits int, d *big.Int,
+	quotient bool) (bool, error) {
+
+	key := fmt.Sprintf("div,%d,%d,%d,%s,%v", aBits, dBits, zBits, d,
+		quotient)
+	return c.constCheaper(key, aBits, dBits, zBits, d,
+		func(cc *Compiler, a, b, z []*Wire) error {
+			if quotient {
+				return NewConstDivider(cc, a, d, z, nil)
+			}
+			return NewConstDivider(cc, a, d, nil, z)
+		},
+		func(cc *Compiler, a, b, z []*Wire) error {
+			if quotient {
+				return NewDivider(cc, a, b, z, nil)
+			}
+			return NewDivider(cc, a, b, nil, z)
+		})
+}
+
+// constCheaper tests if the circuit created by the function reduced
+// is cheaper than the circuit created by the function generic. The
+// functions are called with the xBits wide input x, the yBits wide
+// constant y holding the value k, and the zBits wide output z. The
+// results are cached with the key.
+func (c *Compiler) constCheaper(key string, xBits, yBits, zBits int,
+	k *big.Int, reduced, generic func(cc *Compiler, x, y, z []*Wire) error) (
+	bool, error) {
+
+	cheaper, ok := c.constCosts[key]
+	if ok {
+		return cheaper, nil
+	}
+	reducedCost, err := c.constCost(xBits, yBits, zBits, k, reduced)
+	if err != nil {
+		return false, err
+	}
+	genericCost, err := c.constCost(xBits, yBits, zBits, k, generic)
+	if err != nil {
+		return false, err
+	}
+	cheaper = reducedCost <= genericCost
+	if c.constCosts == nil {
+		c.constCosts = make(map[string]bool)
+	}
+	c.constCosts[key] = cheaper
+	return cheaper, nil
+}
+
+// constCost returns the cost of the circuit created by the function
+// build. The circuit is created with a scratch compiler and it is
+// optimized with the gate optimizations of the compiler parameters so
+// the constant inputs are folded as in the final circuit.
+func (c *Compiler) constCost(xBits, yBits, zBits int, k *big.Int,
+	build func(cc *Compiler, x, y, z []*Wire) error) (int, error) {
+
+	x := MakeWires(xBits)
+	z := MakeWires(zBits)
+	cc, err := NewCompiler(c.Params, nil, nil, x, z)
+	if err != nil {
+		return 0, err
+	}
+	cc.OutputsAssigned = true
+
+	y := make([]*Wire, yBits)
+	for i := range y {
+		if k.Bit(i) != 0 {
+			y[i] = cc.OneWire()
+		} else {
+			y[i] = cc.ZeroWire()
+		}
+	}
+	err = build(cc, x, y, z)
+	if err != nil {
+		return 0, err
+	}
+	for _, w := range z {
+		w.Output = true
+	}
+	if cc.Params.OptSimplifyGates {
+		cc.Simplify()
+	}
+	if cc.Params.OptDedupGates {
+		cc.Dedup()
+	}
+	if cc.Params.OptPruneGates {
+		cc.Prune()
+	}
+	return cc.Compile().Cost(), nil
+}
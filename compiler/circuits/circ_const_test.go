@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var constTests = []struct {
+	bits  int
+	value int64
+}{
+	{8, 1},
+	{8, 3},
+	{8, 7},
+	{8, 10},
+	{8, 16},
+	{8, 255},
+	{8, 300},
+	{16, 641},
+	{32, 3},
+	{32, 10},
+	{32, 1000003},
+	{32, 1 << 20},
+}
+
+func TestCSD(t *testing.T) {
+	for c := int64(0); c < 1024; c++ {
+		digits := csd(big.NewInt(c))
+		var v int64
+		for i, d := range digits {
+			if i == 0 && d.neg {
+				t.Errorf("csd(%d): negative most significant digit", c)
+			}
+			if i > 0 && digits[i-1].shift-d.shift < 2 {
+				t.Errorf("csd(%d): adjacent non-zero digits", c)
+			}
+			if d.neg {
+				v -= 1 << d.shift
+			} else {
+				v += 1 << d.shift
+			}
+		}
+		if v != c {
+			t.Errorf("csd(%d): digits %v have value %d", c, digits, v)
+		}
+	}
+}
+
+func TestConstMultiplier(t *testing.T) {
+	for _, test := range constTests {
+		for _, lowDepth := range []bool{false, true} {
+			testConstMultiplier(t, test.bits, big.NewInt(test.value),
+				lowDepth)
+		}
+	}
+}
+
+func testConstMultiplier(t *testing.T, bits int, c *big.Int, lowDepth bool) {
+	in := NewIO(bits, "in")
+	inputs := makeWires(bits, false)
+	outputs := makeWires(bits, true)
+	cc, err := NewCompiler(&utils.Params{
+		CircLowDepth: lowDepth,
+	}, in, NewIO(bits, "out"), inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	z := MakeWires(bits)
+	err = NewConstMultiplier(cc, inputs, c, z)
+	if err != nil {
+		t.Fatalf("NewConstMultiplier: %s", err)
+	}
+	for i := range z {
+		cc.ID(z[i], outputs[i])
+	}
+	circ := cc.Compile()
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	mask.Sub(mask, big.NewInt(1))
+
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		x := in.Random(rnd)[0]
+		result, err := circ.Compute([]*big.Int{x})
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		expected := new(big.Int).Mul(x, c)
+		expected.And(expected, mask)
+		if result[0].Cmp(expected) != 0 {
+			t.Errorf("%d-bit %v*%v (lowdepth=%v): got %v, expected %v",
+				bits, x, c, lowDepth, result[0], expected)
+		}
+	}
+}
+
+func TestConstDivider(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, test := range constTests {
+		d := big.NewInt(test.value)
+		in := NewIO(test.bits, "in")
+		inputs := makeWires(test.bits, false)
+		outputs := makeWires(test.bits*2, true)
+		cc, err := NewCompiler(params, in,
+			append(NewIO(test.bits, "q"), NewIO(test.bits, "r")...),
+			inputs, outputs)
+		if err != nil {
+			t.Fatalf("NewCompiler: %s", err)
+		}
+		qr := MakeWires(test.bits * 2)
+		err = NewConstDivider(cc, inputs, d, qr[:test.bits], qr[test.bits:])
+		if err != nil {
+			t.Fatalf("NewConstDivider: %s", err)
+		}
+		for i := range qr {
+			cc.ID(qr[i], outputs[i])
+		}
+		circ := cc.Compile()
+
+		for i := 0; i < 100; i++ {
+			x := in.Random(rnd)[0]
+			result, err := circ.Compute([]*big.Int{x})
+			if err != nil {
+				t.Fatalf("Compute: %s", err)
+			}
+			q, r := new(big.Int).QuoRem(x, d, new(big.Int))
+			if result[0].Cmp(q) != 0 || result[1].Cmp(r) != 0 {
+				t.Errorf("%d-bit %v/%v: got %v,%v, expected %v,%v",
+					test.bits, x, d, result[0], result[1], q, r)
+			}
+		}
+	}
+}
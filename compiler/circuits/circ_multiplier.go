@@ -14,8 +14,13 @@ import (
 	"github.com/markkurossi/mpc/circuit"
 )
 
-// NewMultiplier creates a multiplier circuit implementing x*y=z.
+// NewMultiplier creates a multiplier circuit implementing x*y=z. The
+// multiplier is a Karatsuba multiplier, or a Wallace tree multiplier
+// if the compiler creates depth-optimized circuits.
 func NewMultiplier(c *Compiler, arrayTreshold int, x, y, z []*Wire) error {
+	if c.lowDepth() {
+		return NewWallaceMultiplier(c, x, y, z)
+	}
 	if false {
 		return NewArrayMultiplier(c, x, y, z)
 	}
@@ -25,6 +30,106 @@ func NewMultiplier(c *Compiler, arrayTreshold int, x, y, z []*Wire) error {
 	return NewKaratsubaMultiplier(c, arrayTreshold, x, y, z)
 }
 
+// NewWallaceMultiplier creates a multiplier circuit implementing
+// x*y=z. This function implements the Wallace tree multiplier: the
+// partial products are computed in one AND layer, the columns of the
+// partial products are reduced to two rows with the Dadda reduction,
+// and the rows are added with a parallel prefix adder. The multiplier
+// has a logarithmic number of AND layers.
+func NewWallaceMultiplier(cc *Compiler, x, y, z []*Wire) error {
+	x, y = cc.ZeroPad(x, y)
+	if len(x) > len(z) {
+		return fmt.Errorf("Invalid multiplier arguments: x=%d, y=%d, z=%d",
+			len(x), len(y), len(z))
+	}
+	n := len(z)
+
+	// The partial products by their result bits.
+	columns := make([][]*Wire, n)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(y) && i+j < n; j++ {
+			w := NewWire()
+			cc.AddGate(NewBinary(circuit.AND, x[i], y[j], w))
+			columns[i+j] = append(columns[i+j], w)
+		}
+	}
+
+	return addColumns(cc, columns, z)
+}
+
+// addColumns adds the columns of bits with the Dadda reduction and a
+// parallel prefix adder. The column k holds the bits with the weight
+// 2^k and the sum is stored in z. The columns can't be longer than z.
+func addColumns(cc *Compiler, columns [][]*Wire, z []*Wire) error {
+	n := len(z)
+
+	// Each stage of the Dadda reduction reduces the columns to the
+	// next height of the sequence 2, 3, 4, 6, 9, ..., taking into
+	// account the carries from the previous column.
+	var height int
+	for _, col := range columns {
+		height = max(height, len(col))
+	}
+	heights := []int{2}
+	for heights[len(heights)-1] < height {
+		heights = append(heights, heights[len(heights)-1]*3/2)
+	}
+	for i := len(heights) - 2; i >= 0; i-- {
+		columns = daddaStage(cc, columns, heights[i])
+	}
+
+	a := make([]*Wire, n)
+	b := make([]*Wire, n)
+	for k, col := range columns {
+		if len(col) > 2 {
+			return fmt.Errorf("Dadda reduction: column %d not reduced", k)
+		}
+		a[k] = cc.ZeroWire()
+		b[k] = cc.ZeroWire()
+		if len(col) > 0 {
+			a[k] = col[0]
+		}
+		if len(col) > 1 {
+			b[k] = col[1]
+		}
+	}
+	return NewPrefixAdder(cc, a, b, z)
+}
+
+// daddaStage reduces the columns to the height d with full and half
+// adders.
+func daddaStage(cc *Compiler, columns [][]*Wire, d int) [][]*Wire {
+	n := len(columns)
+	next := make([][]*Wire, n)
+	for k, col := range columns {
+		// The next column holds the carries from the previous column.
+		excess := len(col) + len(next[k]) - d
+		var i int
+		for excess > 0 && i+2 <= len(col) {
+			s := NewWire()
+			var cout *Wire
+			if k+1 < n {
+				cout = NewWire()
+			}
+			if excess >= 2 && i+3 <= len(col) {
+				NewFullAdder(cc, col[i], col[i+1], col[i+2], s, cout)
+				i += 3
+				excess -= 2
+			} else {
+				NewHalfAdder(cc, col[i], col[i+1], s, cout)
+				i += 2
+				excess--
+			}
+			next[k] = append(next[k], s)
+			if cout != nil {
+				next[k+1] = append(next[k+1], cout)
+			}
+		}
+		next[k] = append(next[k], col[i:]...)
+	}
+	return next
+}
+
 // NewArrayMultiplier creates a multiplier circuit implementing
 // x*y=z. This function implements Array Multiplier Circuit.
 func NewArrayMultiplier(compiler *Compiler, x, y, z []*Wire) error {
@@ -16,6 +16,11 @@ import (
 // to output, based on the value of the condition cond.
 func NewMUX(compiler *Compiler, cond, t, f, out []*Wire) error {
 	t, f = compiler.ZeroPad(t, f)
+	if len(t) < len(out) {
+		// Zero-extend values which are narrower than the result.
+		t, _ = compiler.ZeroPad(t, out)
+		f, _ = compiler.ZeroPad(f, out)
+	}
 	if len(cond) != 1 || len(t) != len(f) || len(t) != len(out) {
 		return fmt.Errorf("invalid mux arguments: cond=%d, l=%d, r=%d, out=%d",
 			len(cond), len(t), len(f), len(out))
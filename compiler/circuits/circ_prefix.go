@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// lowDepth tests if the compiler creates depth-optimized circuits.
+func (c *Compiler) lowDepth() bool {
+	return c.Params != nil && c.Params.CircLowDepth
+}
+
+// prefixCarries computes the carries from the generate signals g and
+// the propagate signals p with the Sklansky parallel prefix
+// network. The function returns the carries where the carry i is the
+// carry out of the bit i. The network has ceil(log2(n)) AND layers.
+func prefixCarries(cc *Compiler, g, p []*Wire) []*Wire {
+	n := len(g)
+	g = append([]*Wire(nil), g...)
+	p = append([]*Wire(nil), p...)
+
+	for step := 1; step < n; step <<= 1 {
+		for i := 0; i < n; i++ {
+			if i&step == 0 {
+				continue
+			}
+			// The bit i's group [i&^(step-1), i] is combined with the
+			// group ending at the bit j just below it.
+			j := i&^(step-1) - 1
+
+			// G = G_i | P_i & G_j. The terms are disjoint so the OR
+			// can be computed with XOR.
+			t := NewWire()
+			cc.AddGate(NewBinary(circuit.AND, p[i], g[j], t))
+			gi := NewWire()
+			cc.AddGate(NewBinary(circuit.XOR, g[i], t, gi))
+			g[i] = gi
+
+			// The propagate signals of the groups starting from the
+			// bit 0 are not needed.
+			if i&^(2*step-1) != 0 {
+				pi := NewWire()
+				cc.AddGate(NewBinary(circuit.AND, p[i], p[j], pi))
+				p[i] = pi
+			} else {
+				p[i] = nil
+			}
+		}
+	}
+	return g
+}
+
+// NewPrefixAdder creates a parallel prefix adder circuit implementing
+// z=x+y. The adder has a logarithmic number of AND layers and it is
+// suitable for protocols where each AND layer costs a communication
+// round.
+func NewPrefixAdder(cc *Compiler, x, y, z []*Wire) error {
+	x, y = cc.ZeroPad(x, y)
+	if len(z) < len(x) {
+		return fmt.Errorf("Invalid adder arguments: x=%d, y=%d, z=%d",
+			len(x), len(y), len(z))
+	}
+	n := len(x)
+
+	g := make([]*Wire, n)
+	p := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		if i == 0 {
+			p[i] = z[0]
+		} else {
+			p[i] = NewWire()
+		}
+		cc.AddGate(NewBinary(circuit.XOR, x[i], y[i], p[i]))
+		if i+1 < n || len(z) > n {
+			g[i] = NewWire()
+			cc.AddGate(NewBinary(circuit.AND, x[i], y[i], g[i]))
+		}
+	}
+	if len(z) == n {
+		// N+N=N, overflow, drop carry bit.
+		g = g[:n-1]
+	}
+	c := prefixCarries(cc, g, p[:len(g)])
+
+	for i := 1; i < n; i++ {
+		cc.AddGate(NewBinary(circuit.XOR, p[i], c[i-1], z[i]))
+	}
+	if len(z) > n {
+		cc.ID(c[n-1], z[n])
+	}
+
+	// Set all leftover bits to zero.
+	for i := n + 1; i < len(z); i++ {
+		z[i] = cc.ZeroWire()
+	}
+	return nil
+}
+
+// NewPrefixSubtractor creates a parallel prefix subtractor circuit
+// implementing z=x-y. The subtraction is computed as x+^y+1 with a
+// parallel prefix adder.
+func NewPrefixSubtractor(cc *Compiler, x, y, z []*Wire) error {
+	x, y = cc.ZeroPad(x, y)
+	if len(z) < len(x) {
+		return fmt.Errorf("Invalid subtractor arguments: x=%d, y=%d, z=%d",
+			len(x), len(y), len(z))
+	}
+	n := len(x)
+
+	g := make([]*Wire, n)
+	p := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		p[i] = NewWire()
+		cc.AddGate(NewBinary(circuit.XNOR, x[i], y[i], p[i]))
+		if i+1 == n && len(z) == n {
+			// N-N=N, overflow, drop carry bit.
+			break
+		}
+		g[i] = NewWire()
+		if i == 0 {
+			// The carry in is 1 so the bit 0 generates a carry if
+			// x|^y = ^(^x&y).
+			nx := NewWire()
+			cc.INV(x[i], nx)
+			t := NewWire()
+			cc.AddGate(NewBinary(circuit.AND, nx, y[i], t))
+			cc.INV(t, g[i])
+		} else {
+			ny := NewWire()
+			cc.INV(y[i], ny)
+			cc.AddGate(NewBinary(circuit.AND, x[i], ny, g[i]))
+		}
+	}
+	if len(z) == n {
+		g = g[:n-1]
+	}
+	c := prefixCarries(cc, g, p[:len(g)])
+
+	cc.AddGate(NewBinary(circuit.XOR, x[0], y[0], z[0]))
+	for i := 1; i < n; i++ {
+		cc.AddGate(NewBinary(circuit.XOR, p[i], c[i-1], z[i]))
+	}
+	if len(z) > n {
+		// The borrow bit is the inverse of the carry.
+		cc.INV(c[n-1], z[n])
+	}
+	for i := n + 1; i < len(z); i++ {
+		z[i] = cc.ZeroWire()
+	}
+	return nil
+}
+
+// cmpGroup holds the comparison result of a group of bits: gt tells
+// if the x bits are greater than the y bits and eq tells if they are
+// equal.
+type cmpGroup struct {
+	gt *Wire
+	eq *Wire
+}
+
+// prefixComparator tests if x>y if cin=0, and x>=y if cin=1. The
+// comparison results of the bits are combined with a balanced tree
+// having a logarithmic number of AND layers.
+func prefixComparator(cc *Compiler, cin *Wire, x, y, r []*Wire) error {
+	x, y = cc.ZeroPad(x, y)
+	if len(r) != 1 {
+		return fmt.Errorf("invalid lt comparator arguments: r=%d", len(r))
+	}
+
+	// The groups from the least significant bit. The carry in is the
+	// lowest group which is never equal.
+	var groups []cmpGroup
+	if cin != cc.ZeroWire() {
+		groups = append(groups, cmpGroup{
+			gt: cin,
+		})
+	}
+	for i := 0; i < len(x); i++ {
+		ny := NewWire()
+		cc.INV(y[i], ny)
+		gt := NewWire()
+		cc.AddGate(NewBinary(circuit.AND, x[i], ny, gt))
+		var eq *Wire
+		if len(groups) > 0 {
+			eq = NewWire()
+			cc.AddGate(NewBinary(circuit.XNOR, x[i], y[i], eq))
+		}
+		groups = append(groups, cmpGroup{
+			gt: gt,
+			eq: eq,
+		})
+	}
+
+	for len(groups) > 1 {
+		var next []cmpGroup
+		for i := 0; i+1 < len(groups); i += 2 {
+			lo := groups[i]
+			hi := groups[i+1]
+
+			// gt = gt_hi | eq_hi & gt_lo. The terms are disjoint so
+			// the OR can be computed with XOR.
+			t := NewWire()
+			cc.AddGate(NewBinary(circuit.AND, hi.eq, lo.gt, t))
+			var gt *Wire
+			if len(groups) == 2 {
+				gt = r[0]
+			} else {
+				gt = NewWire()
+			}
+			cc.AddGate(NewBinary(circuit.XOR, hi.gt, t, gt))
+
+			// The lowest group's equality is not needed.
+			var eq *Wire
+			if i > 0 {
+				eq = NewWire()
+				cc.AddGate(NewBinary(circuit.AND, hi.eq, lo.eq, eq))
+			}
+			next = append(next, cmpGroup{
+				gt: gt,
+				eq: eq,
+			})
+		}
+		if len(groups)%2 == 1 {
+			next = append(next, groups[len(groups)-1])
+		}
+		groups = next
+	}
+	if groups[0].gt != r[0] {
+		cc.ID(groups[0].gt, r[0])
+	}
+	return nil
+}
+
+// orTree computes the OR of the wires with a balanced tree having a
+// logarithmic number of OR layers. The result is stored in the wire
+// r.
+func orTree(cc *Compiler, wires []*Wire, r *Wire) {
+	if len(wires) == 1 {
+		cc.ID(wires[0], r)
+		return
+	}
+	for len(wires) > 2 {
+		var next []*Wire
+		for i := 0; i+1 < len(wires); i += 2 {
+			w := NewWire()
+			cc.AddGate(NewBinary(circuit.OR, wires[i], wires[i+1], w))
+			next = append(next, w)
+		}
+		if len(wires)%2 == 1 {
+			next = append(next, wires[len(wires)-1])
+		}
+		wires = next
+	}
+	cc.AddGate(NewBinary(circuit.OR, wires[0], wires[1], r))
+}
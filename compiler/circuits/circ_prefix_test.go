@@ -0,0 +1,209 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+type binaryCircuit func(cc *Compiler, x, y, z []*Wire) error
+
+var lowDepthTests = []struct {
+	name    string
+	circ    binaryCircuit
+	outBits func(n int) int
+	eval    func(x, y *big.Int, n int) *big.Int
+}{
+	{
+		name: "add",
+		circ: NewAdder,
+		outBits: func(n int) int {
+			return n + 1
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Add(x, y)
+		},
+	},
+	{
+		name: "add-overflow",
+		circ: NewAdder,
+		outBits: func(n int) int {
+			return n
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Add(x, y)
+		},
+	},
+	{
+		name: "sub",
+		circ: NewSubtractor,
+		outBits: func(n int) int {
+			return n + 1
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Sub(x, y)
+		},
+	},
+	{
+		name: "sub-overflow",
+		circ: NewSubtractor,
+		outBits: func(n int) int {
+			return n
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Sub(x, y)
+		},
+	},
+	{
+		name: "mult",
+		circ: func(cc *Compiler, x, y, z []*Wire) error {
+			return NewMultiplier(cc, 0, x, y, z)
+		},
+		outBits: func(n int) int {
+			return 2 * n
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Mul(x, y)
+		},
+	},
+	{
+		name: "mult-truncate",
+		circ: func(cc *Compiler, x, y, z []*Wire) error {
+			return NewMultiplier(cc, 0, x, y, z)
+		},
+		outBits: func(n int) int {
+			return n
+		},
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return new(big.Int).Mul(x, y)
+		},
+	},
+	{
+		name: "gt",
+		circ: NewGtComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) > 0)
+		},
+	},
+	{
+		name: "ge",
+		circ: NewGeComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) >= 0)
+		},
+	},
+	{
+		name: "lt",
+		circ: NewLtComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) < 0)
+		},
+	},
+	{
+		name: "le",
+		circ: NewLeComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) <= 0)
+		},
+	},
+	{
+		name: "eq",
+		circ: NewEqComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) == 0)
+		},
+	},
+	{
+		name: "neq",
+		circ: NewNeqComparator,
+		eval: func(x, y *big.Int, n int) *big.Int {
+			return bit(x.Cmp(y) != 0)
+		},
+	},
+}
+
+func bit(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+func compileBinary(t *testing.T, params *utils.Params, circ binaryCircuit,
+	n, outBits int) *circuit.Circuit {
+
+	inputs := makeWires(n*2, false)
+	outputs := makeWires(outBits, true)
+	cc, err := NewCompiler(params,
+		append(NewIO(n, "x"), NewIO(n, "y")...), NewIO(outBits, "z"),
+		inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	z := MakeWires(outBits)
+	err = circ(cc, inputs[:n], inputs[n:], z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range z {
+		cc.ID(z[i], outputs[i])
+	}
+	return cc.Compile()
+}
+
+func TestLowDepth(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	lowDepth := &utils.Params{
+		CircLowDepth: true,
+	}
+	for _, test := range lowDepthTests {
+		outBits := test.outBits
+		if outBits == nil {
+			outBits = func(n int) int {
+				return 1
+			}
+		}
+		for _, n := range []int{1, 2, 3, 5, 8, 13, 32, 64} {
+			circ := compileBinary(t, lowDepth, test.circ, n, outBits(n))
+			ref := compileBinary(t, params, test.circ, n, outBits(n))
+
+			if n >= 32 {
+				depth := circ.Metrics().ANDDepth
+				refDepth := ref.Metrics().ANDDepth
+				if depth*2 > refDepth {
+					t.Errorf("%s/%d: depth %d, expected < %d/2",
+						test.name, n, depth, refDepth)
+				}
+			}
+
+			mask := new(big.Int).Lsh(big.NewInt(1), uint(outBits(n)))
+			mask.Sub(mask, big.NewInt(1))
+			for i := 0; i < 50; i++ {
+				inputs := circ.Inputs.Random(rnd)
+				x, y := inputs[0], inputs[1]
+				if i == 0 {
+					y.Set(x)
+				}
+				result, err := circ.Compute(inputs)
+				if err != nil {
+					t.Fatalf("Compute: %s", err)
+				}
+				expected := test.eval(x, y, n)
+				expected.And(expected, mask)
+				if result[0].Cmp(expected) != 0 {
+					t.Errorf("%s/%d: %v, %v: got %v, expected %v",
+						test.name, n, x, y, result[0], expected)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// NewLeftShifter creates a barrel shifter circuit implementing
+// r=x<<s.
+func NewLeftShifter(compiler *Compiler, x, s, r []*Wire) error {
+	return barrelShifter(compiler, x, s, r, false, compiler.ZeroWire(),
+		func(w []*Wire, count int) []*Wire {
+			return compiler.ShiftLeft(w, len(w), count)
+		})
+}
+
+// NewRightShifter creates a barrel shifter circuit implementing the
+// logical right shift r=x>>s.
+func NewRightShifter(compiler *Compiler, x, s, r []*Wire) error {
+	zero := compiler.ZeroWire()
+	return barrelShifter(compiler, x, s, r, false, zero,
+		func(w []*Wire, count int) []*Wire {
+			return compiler.ShiftRight(w, len(w), count, zero)
+		})
+}
+
+// NewArithRightShifter creates a barrel shifter circuit implementing
+// the arithmetic right shift r=x>>s. The vacated high bits are filled
+// with the sign bit of x.
+func NewArithRightShifter(compiler *Compiler, x, s, r []*Wire) error {
+	if len(x) == 0 {
+		return fmt.Errorf("invalid arithmetic shift arguments: x=%d", len(x))
+	}
+	sign := x[len(x)-1]
+	return barrelShifter(compiler, x, s, r, false, sign,
+		func(w []*Wire, count int) []*Wire {
+			return compiler.ShiftRight(w, len(w), count, sign)
+		})
+}
+
+// NewRotateLeft creates a barrel shifter circuit rotating x left by s
+// bits. The rotation is done modulo the size of the result r.
+func NewRotateLeft(compiler *Compiler, x, s, r []*Wire) error {
+	return barrelShifter(compiler, x, s, r, true, nil,
+		func(w []*Wire, count int) []*Wire {
+			return rotate(w, count)
+		})
+}
+
+// NewRotateRight creates a barrel shifter circuit rotating x right by
+// s bits. The rotation is done modulo the size of the result r.
+func NewRotateRight(compiler *Compiler, x, s, r []*Wire) error {
+	return barrelShifter(compiler, x, s, r, true, nil,
+		func(w []*Wire, count int) []*Wire {
+			return rotate(w, len(w)-count)
+		})
+}
+
+// barrelShifter creates a logarithmic shifter circuit. Each bit j of
+// the shift amount s selects between the current value and the value
+// shifted by 2^j bits. For shifts, the amount bits that shift
+// everything out of the result select the fill value. For rotations,
+// all amount bits are processed with the stage amounts reduced modulo
+// the result size.
+func barrelShifter(compiler *Compiler, x, s, r []*Wire, rot bool,
+	fill *Wire, shift func(w []*Wire, count int) []*Wire) error {
+
+	n := len(r)
+	if n == 0 || len(s) == 0 {
+		return fmt.Errorf("invalid shifter arguments: x=%d, s=%d, r=%d",
+			len(x), len(s), len(r))
+	}
+
+	cur := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		if i < len(x) {
+			cur[i] = x[i]
+		} else if fill != nil {
+			cur[i] = fill
+		} else {
+			cur[i] = compiler.ZeroWire()
+		}
+	}
+
+	var stages int
+	if rot {
+		stages = len(s)
+	} else {
+		for stages < len(s) && 1<<stages < n {
+			stages++
+		}
+	}
+	overflow := s[stages:]
+
+	count := 1 % n
+	for j := 0; j < stages; j++ {
+		var out []*Wire
+		if j+1 == stages && len(overflow) == 0 {
+			out = r
+		} else {
+			out = MakeWires(n)
+		}
+		if count == 0 {
+			// Rotation by a multiple of the result size.
+			for i := 0; i < n; i++ {
+				compiler.ID(cur[i], out[i])
+			}
+		} else {
+			err := NewMUX(compiler, s[j:j+1], shift(cur, count), cur, out)
+			if err != nil {
+				return err
+			}
+		}
+		cur = out
+		count = (count * 2) % n
+	}
+	if len(overflow) == 0 {
+		if stages == 0 {
+			for i := 0; i < n; i++ {
+				compiler.ID(cur[i], r[i])
+			}
+		}
+		return nil
+	}
+
+	// Any set overflow bit shifts all bits out of the result.
+	ovf := overflow[0]
+	for i := 1; i < len(overflow); i++ {
+		w := NewWire()
+		compiler.AddGate(NewBinary(circuit.OR, ovf, overflow[i], w))
+		ovf = w
+	}
+	fills := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		fills[i] = fill
+	}
+	return NewMUX(compiler, []*Wire{ovf}, fills, cur, r)
+}
+
+func rotate(w []*Wire, count int) []*Wire {
+	n := len(w)
+	result := make([]*Wire, n)
+	for i := 0; i < n; i++ {
+		result[(i+count)%n] = w[i]
+	}
+	return result
+}
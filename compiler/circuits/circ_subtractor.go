@@ -31,8 +31,13 @@ func NewFullSubtractor(compiler *Compiler, x, y, cin, d, cout *Wire) {
 	}
 }
 
-// NewSubtractor creates a new subtractor circuit implementing z=x-y.
+// NewSubtractor creates a new subtractor circuit implementing
+// z=x-y. The subtractor is a ripple-borrow subtractor, or a parallel
+// prefix subtractor if the compiler creates depth-optimized circuits.
 func NewSubtractor(compiler *Compiler, x, y, z []*Wire) error {
+	if compiler.lowDepth() {
+		return NewPrefixSubtractor(compiler, x, y, z)
+	}
 	x, y = compiler.ZeroPad(x, y)
 	if len(z) < len(x) {
 		return fmt.Errorf("Invalid subtractor arguments: x=%d, y=%d, z=%d",
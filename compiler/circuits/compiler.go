@@ -27,13 +27,16 @@ type Compiler struct {
 	InputWires      []*Wire
 	OutputWires     []*Wire
 	Gates           []*Gate
+	Loc             *utils.Location
 	nextWireID      uint32
 	pending         []*Gate
 	assigned        []*Gate
 	compiled        []circuit.Gate
+	compiledLocs    []*utils.Location
 	wiresX          map[string][]*Wire
 	zeroWire        *Wire
 	oneWire         *Wire
+	constCosts      map[string]bool
 }
 
 // NewCompiler creates a new circuit compiler for the specified
@@ -124,6 +127,21 @@ func (c *Compiler) ShiftLeft(w []*Wire, size, count int) []*Wire {
 	return result
 }
 
+// ShiftRight shifts the size number of bits of the input wires w,
+// count bits right. The vacated high bits are set to the fill wire.
+func (c *Compiler) ShiftRight(w []*Wire, size, count int, fill *Wire) []*Wire {
+	result := make([]*Wire, size)
+
+	for i := 0; i < size; i++ {
+		if i+count < len(w) {
+			result[i] = w[i+count]
+		} else {
+			result[i] = fill
+		}
+	}
+	return result
+}
+
 // INV creates an inverse wire inverting the input wire i's value to
 // the output wire o.
 func (c *Compiler) INV(i, o *Wire) {
@@ -136,8 +154,12 @@ func (c *Compiler) ID(i, o *Wire) {
 	c.AddGate(NewBinary(circuit.XOR, i, c.ZeroWire(), o))
 }
 
-// AddGate adds a get into the circuit.
+// AddGate adds a get into the circuit. The gate is attributed to the
+// compiler's current source location, unless it already has one.
 func (c *Compiler) AddGate(gate *Gate) {
+	if gate.Loc == nil {
+		gate.Loc = c.Loc
+	}
 	c.Gates = append(c.Gates, gate)
 }
 
@@ -171,6 +193,21 @@ func (c *Compiler) Prune() int {
 	return nPos
 }
 
+// removeDead removes the count number of dead gates from the
+// circuit.
+func (c *Compiler) removeDead(count int) {
+	if count == 0 {
+		return
+	}
+	n := make([]*Gate, 0, len(c.Gates)-count)
+	for _, g := range c.Gates {
+		if !g.Dead {
+			n = append(n, g)
+		}
+	}
+	c.Gates = n
+}
+
 // Compile compiles the circuit.
 func (c *Compiler) Compile() *circuit.Circuit {
 	if len(c.pending) != 0 {
@@ -185,6 +222,7 @@ func (c *Compiler) Compile() *circuit.Circuit {
 		panic("Compile: compiled set")
 	}
 	c.compiled = make([]circuit.Gate, 0, len(c.Gates))
+	c.compiledLocs = make([]*utils.Location, 0, len(c.Gates))
 
 	for _, w := range c.InputWires {
 		w.Assign(c)
@@ -301,3 +339,22 @@ func (w *Wire) AddOutput(gate *Gate) {
 func (w *Wire) RemoveOutput(gate *Gate) {
 	w.NumOutputs--
 }
+
+// moveOutputs moves all output gates of the wire to the wire to.
+func (w *Wire) moveOutputs(to *Wire) {
+	for _, g := range w.Outputs {
+		if g.Dead {
+			continue
+		}
+		if g.A == w {
+			g.A = to
+			to.AddOutput(g)
+		}
+		if g.B == w {
+			g.B = to
+			to.AddOutput(g)
+		}
+	}
+	w.Outputs = nil
+	w.NumOutputs = 0
+}
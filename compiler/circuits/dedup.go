@@ -0,0 +1,54 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"github.com/markkurossi/mpc/circuit"
+)
+
+type gateKey struct {
+	op circuit.Operation
+	a  *Wire
+	b  *Wire
+}
+
+// Dedup removes structurally identical gates from the circuit. Two
+// gates are identical if they have the same operation and the same
+// input wires. Since all gate operations are commutative, the order
+// of the input wires does not matter. The consumers of the removed
+// gates are connected to the output wire of the first identical
+// gate. The function returns the number of removed gates.
+func (c *Compiler) Dedup() int {
+	gates := make(map[gateKey]*Gate)
+	var removed int
+
+	for _, g := range c.Gates {
+		if g.Dead {
+			continue
+		}
+		prev, ok := gates[gateKey{g.Op, g.A, g.B}]
+		if !ok {
+			prev, ok = gates[gateKey{g.Op, g.B, g.A}]
+		}
+		if g.O.Output || g.O == c.zeroWire || g.O == c.oneWire {
+			// The gate must be kept but it can't be shared.
+			continue
+		}
+		if ok {
+			g.Dead = true
+			g.A.RemoveOutput(g)
+			g.B.RemoveOutput(g)
+			g.O.moveOutputs(prev.O)
+			removed++
+		} else {
+			gates[gateKey{g.Op, g.A, g.B}] = g
+		}
+	}
+	c.removeDead(removed)
+
+	return removed
+}
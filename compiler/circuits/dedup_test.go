@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+func TestDedup(t *testing.T) {
+	inputs := makeWires(3, false)
+	outputs := makeWires(2, true)
+	c, err := NewCompiler(params, NewIO(3, "in"), NewIO(2, "out"),
+		inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	a := inputs[0]
+	b := inputs[1]
+	d := inputs[2]
+
+	// out0 = (a AND b) XOR d
+	ab := NewWire()
+	c.AddGate(NewBinary(circuit.AND, a, b, ab))
+	c.AddGate(NewBinary(circuit.XOR, ab, d, outputs[0]))
+
+	// out1 = (b AND a) XOR d XOR (a AND b)
+	ba := NewWire()
+	c.AddGate(NewBinary(circuit.AND, b, a, ba))
+	bad := NewWire()
+	c.AddGate(NewBinary(circuit.XOR, d, ba, bad))
+	ab2 := NewWire()
+	c.AddGate(NewBinary(circuit.AND, a, b, ab2))
+	c.AddGate(NewBinary(circuit.XOR, bad, ab2, outputs[1]))
+
+	removed := c.Dedup()
+	if removed != 2 {
+		t.Errorf("Dedup removed %d gates, expected 2", removed)
+	}
+	circ := c.Compile()
+	if circ.Stats[circuit.AND] != 1 {
+		t.Errorf("unexpected circuit: %s", circ)
+	}
+
+	for in := int64(0); in < 8; in++ {
+		av := in & 1
+		bv := (in >> 1) & 1
+		dv := (in >> 2) & 1
+		expected := (av&bv ^ dv) | dv<<1
+
+		result, err := circ.Compute([]*big.Int{big.NewInt(in)})
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		if result[0].Int64() != expected {
+			t.Errorf("a=%d, b=%d, d=%d: got %b, expected %b",
+				av, bv, dv, result[0].Int64(), expected)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 
 	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
 )
 
 // Gate implements binary gates.
@@ -23,6 +24,7 @@ type Gate struct {
 	A        *Wire
 	B        *Wire
 	O        *Wire
+	Loc      *utils.Location
 }
 
 // NewBinary creates a new binary gate.
@@ -84,4 +86,5 @@ func (g *Gate) Compile(c *Compiler) {
 		Output: circuit.Wire(g.O.ID),
 		Op:     g.Op,
 	})
+	c.compiledLocs = append(c.compiledLocs, g.Loc)
 }
@@ -0,0 +1,407 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// ProfileEntry describes the gates attributed to a source line or to
+// a function.
+type ProfileEntry struct {
+	Func  string
+	Loc   utils.Point
+	Stats [circuit.INV + 1]int
+	// Depth is the length of the longest path of AND, OR, and INV
+	// gates through the entry's own gates. The wires coming from
+	// other entries start new paths.
+	Depth int
+}
+
+// Gates returns the total number of gates of the entry.
+func (e *ProfileEntry) Gates() int {
+	var count int
+	for _, v := range e.Stats {
+		count += v
+	}
+	return count
+}
+
+// Cost computes the relative computational cost of the entry. The
+// cost is computed as in circuit.Circuit.Cost.
+func (e *ProfileEntry) Cost() int {
+	return (e.Stats[circuit.AND]+e.Stats[circuit.OR])*4 +
+		e.Stats[circuit.INV]*2
+}
+
+func (e *ProfileEntry) location() string {
+	if e.Loc.Undefined() {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d", e.Loc.Source, e.Loc.Line)
+}
+
+// Profile attributes the gates of a compiled circuit to the MPCL
+// source lines and functions that created them.
+type Profile struct {
+	Lines []*ProfileEntry
+	Funcs []*ProfileEntry
+	gates []circuit.Gate
+	locs  []*utils.Location
+}
+
+// Profile creates the gate profile of the compiled circuit. The
+// function must be called after Compile.
+func (c *Compiler) Profile() *Profile {
+	p := &Profile{
+		gates: c.compiled,
+		locs:  c.compiledLocs,
+	}
+
+	lines := make(map[string]*ProfileEntry)
+	funcs := make(map[string]*ProfileEntry)
+
+	lineOwner := make([]*ProfileEntry, c.nextWireID)
+	lineDepth := make([]int, c.nextWireID)
+	funcOwner := make([]*ProfileEntry, c.nextWireID)
+	funcDepth := make([]int, c.nextWireID)
+
+	for idx, g := range c.compiled {
+		loc := c.compiledLocs[idx]
+		var point utils.Point
+		var fn string
+		if loc != nil {
+			point = loc.Point
+			point.Col = 0
+			fn = loc.Func
+		}
+		if len(fn) == 0 {
+			fn = "<unknown>"
+		}
+
+		key := fmt.Sprintf("%s\x00%s:%d", fn, point.Source, point.Line)
+		line, ok := lines[key]
+		if !ok {
+			line = &ProfileEntry{
+				Func: fn,
+				Loc:  point,
+			}
+			lines[key] = line
+			p.Lines = append(p.Lines, line)
+		}
+		f, ok := funcs[fn]
+		if !ok {
+			f = &ProfileEntry{
+				Func: fn,
+			}
+			funcs[fn] = f
+			p.Funcs = append(p.Funcs, f)
+		}
+		line.Stats[g.Op]++
+		f.Stats[g.Op]++
+
+		line.Depth = localDepth(g, line, lineOwner, lineDepth, line.Depth)
+		f.Depth = localDepth(g, f, funcOwner, funcDepth, f.Depth)
+	}
+
+	sortEntries(p.Lines)
+	sortEntries(p.Funcs)
+
+	return p
+}
+
+// localDepth computes the depth of the gate g's output wire within
+// the entry e and returns the maximum of the depth and max.
+func localDepth(g circuit.Gate, e *ProfileEntry, owner []*ProfileEntry,
+	depth []int, max int) int {
+
+	var d int
+	if owner[g.Input0] == e {
+		d = depth[g.Input0]
+	}
+	if g.Op != circuit.INV && owner[g.Input1] == e && depth[g.Input1] > d {
+		d = depth[g.Input1]
+	}
+	switch g.Op {
+	case circuit.AND, circuit.OR, circuit.INV:
+		d++
+	}
+	owner[g.Output] = e
+	depth[g.Output] = d
+
+	if d > max {
+		return d
+	}
+	return max
+}
+
+func sortEntries(entries []*ProfileEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Cost() != b.Cost() {
+			return a.Cost() > b.Cost()
+		}
+		if a.Gates() != b.Gates() {
+			return a.Gates() > b.Gates()
+		}
+		if a.Loc.Source != b.Loc.Source {
+			return a.Loc.Source < b.Loc.Source
+		}
+		if a.Loc.Line != b.Loc.Line {
+			return a.Loc.Line < b.Loc.Line
+		}
+		return a.Func < b.Func
+	})
+}
+
+// Print prints the profile as tables sorted by the entry cost.
+func (p *Profile) Print(w io.Writer) {
+	fmt.Fprintf(w, "Lines:\n")
+	printEntries(w, p.Lines, true)
+	fmt.Fprintf(w, "\nFunctions:\n")
+	printEntries(w, p.Funcs, false)
+}
+
+func printEntries(w io.Writer, entries []*ProfileEntry, lines bool) {
+	fmt.Fprintf(w, "%8s %8s %8s %8s %8s %6s  %s",
+		"XOR", "XNOR", "AND", "OR", "INV", "Depth", "Function")
+	if lines {
+		fmt.Fprintf(w, "\tLocation")
+	}
+	fmt.Fprintln(w)
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "%8d %8d %8d %8d %8d %6d  %s",
+			e.Stats[circuit.XOR], e.Stats[circuit.XNOR],
+			e.Stats[circuit.AND], e.Stats[circuit.OR],
+			e.Stats[circuit.INV], e.Depth, e.Func)
+		if lines {
+			fmt.Fprintf(w, "\t%s", e.location())
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// WritePprof writes the profile in the gzip-compressed protocol
+// buffer format of the pprof tool. The samples are attributed to the
+// source lines and their inlined call stacks.
+func (p *Profile) WritePprof(w io.Writer) error {
+	var prof pprofBuilder
+	prof.strings = make(map[string]int64)
+	prof.locations = make(map[string]uint64)
+	prof.functions = make(map[string]uint64)
+	prof.samples = make(map[string]*pprofSample)
+	prof.str("")
+
+	sampleTypes := []string{"gates", "xor", "xnor", "and", "or", "inv"}
+	for _, t := range sampleTypes {
+		var vt protoBuffer
+		vt.int64(1, prof.str(t))
+		vt.int64(2, prof.str("count"))
+		prof.out.message(1, &vt)
+	}
+
+	var stacks = make(map[*utils.Location][]uint64)
+	for idx, g := range p.gates {
+		loc := p.locs[idx]
+		stack, ok := stacks[loc]
+		if !ok {
+			stack = prof.stack(loc)
+			stacks[loc] = stack
+		}
+		prof.sample(stack, g.Op)
+	}
+
+	for _, key := range prof.order {
+		s := prof.samples[key]
+		var sb protoBuffer
+		sb.packed(1, s.stack)
+		values := make([]uint64, len(s.values))
+		for i, v := range s.values {
+			values[i] = uint64(v)
+		}
+		sb.packed(2, values)
+		prof.out.message(2, &sb)
+	}
+	prof.out.data = append(prof.out.data, prof.locData.data...)
+	prof.out.data = append(prof.out.data, prof.funcData.data...)
+	for _, s := range prof.stringTable {
+		prof.out.string(6, s)
+	}
+	prof.out.int64(14, prof.str("and"))
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(prof.out.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type pprofSample struct {
+	stack  []uint64
+	values [6]int64
+}
+
+type pprofBuilder struct {
+	out         protoBuffer
+	locData     protoBuffer
+	funcData    protoBuffer
+	strings     map[string]int64
+	stringTable []string
+	locations   map[string]uint64
+	functions   map[string]uint64
+	samples     map[string]*pprofSample
+	order       []string
+}
+
+func (b *pprofBuilder) str(s string) int64 {
+	idx, ok := b.strings[s]
+	if !ok {
+		idx = int64(len(b.stringTable))
+		b.strings[s] = idx
+		b.stringTable = append(b.stringTable, s)
+	}
+	return idx
+}
+
+func (b *pprofBuilder) function(name, file string) uint64 {
+	key := name + "\x00" + file
+	id, ok := b.functions[key]
+	if !ok {
+		id = uint64(len(b.functions) + 1)
+		b.functions[key] = id
+
+		var fb protoBuffer
+		fb.uint64(1, id)
+		fb.int64(2, b.str(name))
+		fb.int64(3, b.str(name))
+		fb.int64(4, b.str(file))
+		b.funcData.message(5, &fb)
+	}
+	return id
+}
+
+func (b *pprofBuilder) location(loc *utils.Location) uint64 {
+	name := "<unknown>"
+	var file string
+	var line int
+	if loc != nil {
+		if len(loc.Func) > 0 {
+			name = loc.Func
+		}
+		file = loc.Source
+		line = loc.Line
+	}
+	key := fmt.Sprintf("%s\x00%s:%d", name, file, line)
+	id, ok := b.locations[key]
+	if !ok {
+		id = uint64(len(b.locations) + 1)
+		b.locations[key] = id
+
+		var lb protoBuffer
+		lb.uint64(1, b.function(name, file))
+		lb.int64(2, int64(line))
+
+		var locb protoBuffer
+		locb.uint64(1, id)
+		locb.message(4, &lb)
+		b.locData.message(4, &locb)
+	}
+	return id
+}
+
+// stack returns the pprof location IDs of the location loc and its
+// callers, leaf first.
+func (b *pprofBuilder) stack(loc *utils.Location) []uint64 {
+	var result []uint64
+	for {
+		result = append(result, b.location(loc))
+		if loc == nil || loc.Caller == nil {
+			return result
+		}
+		loc = loc.Caller
+	}
+}
+
+func (b *pprofBuilder) sample(stack []uint64, op circuit.Operation) {
+	key := fmt.Sprint(stack)
+	s, ok := b.samples[key]
+	if !ok {
+		s = &pprofSample{
+			stack: stack,
+		}
+		b.samples[key] = s
+		b.order = append(b.order, key)
+	}
+	s.values[0]++
+	switch op {
+	case circuit.XOR:
+		s.values[1]++
+	case circuit.XNOR:
+		s.values[2]++
+	case circuit.AND:
+		s.values[3]++
+	case circuit.OR:
+		s.values[4]++
+	case circuit.INV:
+		s.values[5]++
+	}
+}
+
+// protoBuffer implements a minimal protocol buffer encoder.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.data = append(b.data, byte(v)|0x80)
+		v >>= 7
+	}
+	b.data = append(b.data, byte(v))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint64(field int, v uint64) {
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var pb protoBuffer
+	for _, v := range values {
+		pb.varint(v)
+	}
+	b.bytes(field, pb.data)
+}
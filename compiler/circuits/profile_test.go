@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+func TestProfile(t *testing.T) {
+	bits := 8
+
+	inputs := makeWires(bits*2, false)
+	outputs := makeWires(bits, true)
+	c, err := NewCompiler(params, NewIO(bits*2, "in"), NewIO(bits, "out"),
+		inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	a := inputs[:bits]
+	b := inputs[bits:]
+
+	main := &utils.Location{
+		Point: utils.Point{
+			Source: "main.mpcl",
+			Line:   3,
+		},
+		Func: "main.main",
+	}
+	c.Loc = main
+	sum := MakeWires(bits)
+	err = NewAdder(c, a, b, sum)
+	if err != nil {
+		t.Fatalf("NewAdder: %s", err)
+	}
+
+	c.Loc = &utils.Location{
+		Point: utils.Point{
+			Source: "main.mpcl",
+			Line:   8,
+		},
+		Func:   "main.and",
+		Caller: main,
+	}
+	for i := 0; i < bits; i++ {
+		c.AddGate(NewBinary(circuit.AND, sum[i], b[i], outputs[i]))
+	}
+	c.Loc = nil
+
+	circ := c.Compile()
+	prof := c.Profile()
+
+	var stats [circuit.INV + 1]int
+	for _, e := range prof.Lines {
+		for op, count := range e.Stats {
+			stats[op] += count
+		}
+	}
+	for op, count := range stats {
+		if count != circ.Stats[circuit.Operation(op)] {
+			t.Errorf("%s: profile has %d gates, circuit has %d",
+				circuit.Operation(op), count,
+				circ.Stats[circuit.Operation(op)])
+		}
+	}
+
+	var adder, and *ProfileEntry
+	for _, e := range prof.Lines {
+		switch e.Loc.Line {
+		case 3:
+			adder = e
+		case 8:
+			and = e
+		}
+	}
+	if adder == nil || and == nil {
+		t.Fatalf("profile lines missing: %v", prof.Lines)
+	}
+	if adder.Func != "main.main" || and.Func != "main.and" {
+		t.Errorf("invalid functions: %s, %s", adder.Func, and.Func)
+	}
+	if and.Stats[circuit.AND] != bits || and.Depth != 1 {
+		t.Errorf("and: AND=%d, depth=%d", and.Stats[circuit.AND], and.Depth)
+	}
+	if adder.Depth != bits-1 {
+		t.Errorf("adder: depth=%d, expected %d", adder.Depth, bits-1)
+	}
+	if prof.Lines[0] != and {
+		t.Errorf("and is not the most expensive line: %v", prof.Lines[0])
+	}
+	if len(prof.Funcs) != 2 {
+		t.Errorf("got %d functions, expected 2", len(prof.Funcs))
+	}
+
+	var buf bytes.Buffer
+	err = prof.WritePprof(&buf)
+	if err != nil {
+		t.Fatalf("WritePprof: %s", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %s", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip: %s", err)
+	}
+	for _, s := range []string{"main.main", "main.and", "main.mpcl"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("pprof output does not contain %s", s)
+		}
+	}
+}
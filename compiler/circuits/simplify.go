@@ -0,0 +1,253 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"github.com/markkurossi/mpc/circuit"
+)
+
+// wireValue describes the value of a wire in terms of another wire.
+// The nil wire denotes a constant value which is specified by the
+// inverted flag.
+type wireValue struct {
+	w        *Wire
+	inverted bool
+}
+
+func (v wireValue) constant() bool {
+	return v.w == nil
+}
+
+func (v wireValue) not() wireValue {
+	return wireValue{
+		w:        v.w,
+		inverted: !v.inverted,
+	}
+}
+
+type simplifier struct {
+	c      *Compiler
+	values map[*Wire]wireValue
+	// inverters map wires to the wires holding their inverted values.
+	inverters map[*Wire]*Wire
+}
+
+// Simplify folds gates with constant or identical inputs. The gates
+// are simplified with the following rules, and the rules are applied
+// to the values derived from the folded gates:
+//
+//	x AND 0 = 0, x AND 1 = x, x AND x = x, x AND !x = 0
+//	x OR 0 = x,  x OR 1 = 1,  x OR x = x,  x OR !x = 1
+//	x XOR 0 = x, x XOR 1 = !x, x XOR x = 0, x XOR !x = 1
+//
+// The inversions !x are implemented as XOR gates with the constant
+// one wire and they are folded into the XOR and XNOR gates consuming
+// them. The function returns the number of removed gates.
+func (c *Compiler) Simplify() int {
+	s := &simplifier{
+		c:         c,
+		values:    make(map[*Wire]wireValue),
+		inverters: make(map[*Wire]*Wire),
+	}
+	if c.zeroWire != nil {
+		s.values[c.zeroWire] = wireValue{}
+	}
+	if c.oneWire != nil {
+		s.values[c.oneWire] = wireValue{
+			inverted: true,
+		}
+	}
+
+	var removed int
+
+	// The constant wires are created on demand so the gate list can
+	// grow during the iteration.
+	for i := 0; i < len(c.Gates); i++ {
+		g := c.Gates[i]
+		if g.Dead || g.O == c.zeroWire || g.O == c.oneWire {
+			continue
+		}
+		if s.simplify(g) {
+			removed++
+		}
+	}
+
+	c.removeDead(removed)
+
+	return removed
+}
+
+func (s *simplifier) value(w *Wire) wireValue {
+	v, ok := s.values[w]
+	if ok {
+		return v
+	}
+	if w == s.c.zeroWire {
+		return wireValue{}
+	}
+	if w == s.c.oneWire {
+		return wireValue{
+			inverted: true,
+		}
+	}
+	return wireValue{
+		w: w,
+	}
+}
+
+// wire returns a wire holding the value v or nil if the value is
+// not available in any wire.
+func (s *simplifier) wire(v wireValue) *Wire {
+	if v.constant() {
+		if v.inverted {
+			return s.c.OneWire()
+		}
+		return s.c.ZeroWire()
+	}
+	if v.inverted {
+		return s.inverters[v.w]
+	}
+	return v.w
+}
+
+// fold computes the value of the gate g's output wire. The function
+// returns false if the value can't be expressed with the values of
+// the input wires.
+func (s *simplifier) fold(g *Gate) (wireValue, bool) {
+	a := s.value(g.A)
+	if g.Op == circuit.INV {
+		return a.not(), true
+	}
+	b := s.value(g.B)
+
+	switch g.Op {
+	case circuit.XOR, circuit.XNOR:
+		var result wireValue
+		switch {
+		case a.constant():
+			result = wireValue{
+				w:        b.w,
+				inverted: a.inverted != b.inverted,
+			}
+		case b.constant():
+			result = wireValue{
+				w:        a.w,
+				inverted: a.inverted != b.inverted,
+			}
+		case a.w == b.w:
+			result = wireValue{
+				inverted: a.inverted != b.inverted,
+			}
+		default:
+			return result, false
+		}
+		if g.Op == circuit.XNOR {
+			result = result.not()
+		}
+		return result, true
+
+	case circuit.AND, circuit.OR:
+		// The absorbing element: 0 for AND, 1 for OR.
+		absorb := g.Op == circuit.OR
+		switch {
+		case a.constant():
+			if a.inverted == absorb {
+				return a, true
+			}
+			return b, true
+		case b.constant():
+			if b.inverted == absorb {
+				return b, true
+			}
+			return a, true
+		case a.w == b.w:
+			if a.inverted == b.inverted {
+				return a, true
+			}
+			return wireValue{
+				inverted: absorb,
+			}, true
+		}
+	}
+	return wireValue{}, false
+}
+
+// setInputs replaces the input wires of the gate g.
+func (s *simplifier) setInputs(g *Gate, op circuit.Operation, a, b *Wire) {
+	if g.A != a || g.B != b {
+		g.A.RemoveOutput(g)
+		g.B.RemoveOutput(g)
+		g.A = a
+		g.B = b
+		a.AddOutput(g)
+		b.AddOutput(g)
+	}
+	g.Op = op
+}
+
+func (s *simplifier) simplify(g *Gate) bool {
+	result, ok := s.fold(g)
+	if !ok {
+		s.stripInversions(g)
+		return false
+	}
+	o := g.O
+
+	var w *Wire
+	if result.constant() || !result.inverted {
+		w = s.wire(result)
+	} else {
+		w = s.inverters[result.w]
+	}
+	if w != nil && !w.Output && !o.Output {
+		// The value is available in another wire.
+		g.Dead = true
+		g.A.RemoveOutput(g)
+		g.B.RemoveOutput(g)
+		o.moveOutputs(w)
+		s.values[o] = result
+		return true
+	}
+
+	// Compute the value with an identity or an inverter gate.
+	if result.constant() {
+		s.setInputs(g, circuit.XOR, s.c.ZeroWire(), s.wire(result))
+	} else if result.inverted {
+		s.setInputs(g, circuit.XOR, result.w, s.c.OneWire())
+		if !o.Output {
+			s.inverters[result.w] = o
+		}
+	} else {
+		s.setInputs(g, circuit.XOR, result.w, s.c.ZeroWire())
+	}
+	if !o.Output {
+		s.values[o] = result
+	}
+	return false
+}
+
+// stripInversions replaces the inverted inputs of XOR and XNOR gates
+// with the inverters' input wires.
+func (s *simplifier) stripInversions(g *Gate) {
+	if g.Op != circuit.XOR && g.Op != circuit.XNOR {
+		return
+	}
+	a := s.value(g.A)
+	b := s.value(g.B)
+	if !a.inverted && !b.inverted {
+		return
+	}
+	op := g.Op
+	if a.inverted != b.inverted {
+		if op == circuit.XOR {
+			op = circuit.XNOR
+		} else {
+			op = circuit.XOR
+		}
+	}
+	s.setInputs(g, op, a.w, b.w)
+}
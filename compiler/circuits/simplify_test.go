@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+func TestSimplify(t *testing.T) {
+	inputs := makeWires(2, false)
+	outputs := makeWires(3, true)
+	c, err := NewCompiler(params, NewIO(2, "in"), NewIO(3, "out"),
+		inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	a := inputs[0]
+	b := inputs[1]
+
+	// x = a AND 0
+	x := NewWire()
+	c.AddGate(NewBinary(circuit.AND, a, c.ZeroWire(), x))
+
+	// y = !!a
+	notA := NewWire()
+	c.INV(a, notA)
+	y := NewWire()
+	c.INV(notA, y)
+
+	// z = y AND b
+	z := NewWire()
+	c.AddGate(NewBinary(circuit.AND, y, b, z))
+
+	// out0 = x OR z = a AND b
+	c.AddGate(NewBinary(circuit.OR, x, z, outputs[0]))
+
+	// out1 = !a XOR b = a XNOR b
+	c.AddGate(NewBinary(circuit.XOR, notA, b, outputs[1]))
+
+	// out2 = (a XOR a) OR (b AND b) = b
+	aa := NewWire()
+	c.AddGate(NewBinary(circuit.XOR, a, a, aa))
+	bb := NewWire()
+	c.AddGate(NewBinary(circuit.AND, b, b, bb))
+	c.AddGate(NewBinary(circuit.OR, aa, bb, outputs[2]))
+
+	removed := c.Simplify()
+	if removed == 0 {
+		t.Errorf("no gates simplified")
+	}
+	c.Prune()
+	circ := c.Compile()
+
+	if circ.Stats[circuit.AND] != 1 || circ.Stats[circuit.OR] != 0 {
+		t.Errorf("unexpected circuit: %s", circ)
+	}
+
+	for in := int64(0); in < 4; in++ {
+		av := in & 1
+		bv := (in >> 1) & 1
+		expected := av&bv | (1^av^bv)<<1 | bv<<2
+
+		result, err := circ.Compute([]*big.Int{big.NewInt(in)})
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		if result[0].Int64() != expected {
+			t.Errorf("a=%d, b=%d: got %b, expected %b",
+				av, bv, result[0].Int64(), expected)
+		}
+	}
+}
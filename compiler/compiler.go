@@ -7,15 +7,19 @@
 package compiler
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/ast"
+	"github.com/markkurossi/mpc/compiler/ssa"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/p2p"
 )
@@ -24,6 +28,7 @@ import (
 type Compiler struct {
 	params   *utils.Params
 	packages map[string]*ast.Package
+	modules  map[string]*Module
 }
 
 // NewCompiler creates a new compiler instance.
@@ -31,6 +36,7 @@ func NewCompiler(params *utils.Params) *Compiler {
 	return &Compiler{
 		params:   params,
 		packages: make(map[string]*ast.Package),
+		modules:  make(map[string]*Module),
 	}
 }
 
@@ -52,16 +58,41 @@ func (c *Compiler) CompileFile(file string) (*circuit.Circuit, ast.Annotations,
 	return c.compile(file, f)
 }
 
-func (c *Compiler) compile(source string, in io.Reader) (
-	*circuit.Circuit, ast.Annotations, error) {
+// CompileSSA compiles the input program into SSA form without
+// creating its circuit.
+func (c *Compiler) CompileSSA(data string) (*ssa.Program, ast.Annotations,
+	error) {
+	return c.compileSSA("{data}", strings.NewReader(data))
+}
 
-	logger := utils.NewLogger(os.Stdout)
+// CompileSSAFile compiles the input file into SSA form without
+// creating its circuit.
+func (c *Compiler) CompileSSAFile(file string) (*ssa.Program,
+	ast.Annotations, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return c.compileSSA(file, f)
+}
+
+func (c *Compiler) compileSSA(source string, in io.Reader) (
+	*ssa.Program, ast.Annotations, error) {
+
+	logger := c.newLogger()
 	pkg, err := c.parse(source, in, logger, ast.NewPackage("main"))
 	if err != nil {
 		return nil, nil, err
 	}
+	return pkg.Compile(c.packages, logger, c.params)
+}
+
+func (c *Compiler) compile(source string, in io.Reader) (
+	*circuit.Circuit, ast.Annotations, error) {
 
-	program, annotation, err := pkg.Compile(c.packages, logger, c.params)
+	program, annotation, err := c.compileSSA(source, in)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -91,7 +122,7 @@ func (c *Compiler) StreamFile(conn *p2p.Conn, file string,
 func (c *Compiler) stream(conn *p2p.Conn, source string, in io.Reader,
 	inputFlag []string) (circuit.IO, []*big.Int, error) {
 
-	logger := utils.NewLogger(os.Stdout)
+	logger := c.newLogger()
 	pkg, err := c.parse(source, in, logger, ast.NewPackage("main"))
 	if err != nil {
 		return nil, nil, err
@@ -120,21 +151,35 @@ func (c *Compiler) stream(conn *p2p.Conn, source string, in io.Reader,
 	return program.StreamCircuit(conn, c.params, input)
 }
 
+// newLogger creates a logger for a compilation.
+func (c *Compiler) newLogger() *utils.Logger {
+	logger := utils.NewLogger(os.Stdout)
+	logger.SetJSON(c.params.DiagnosticsJSON)
+	return logger
+}
+
 func (c *Compiler) parse(source string, in io.Reader, logger *utils.Logger,
 	pkg *ast.Package) (*ast.Package, error) {
 
-	parser := NewParser(source, c, logger, in)
-	pkg, err := parser.Parse(pkg)
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	logger.AddSource(source, data)
+
+	parser := NewParser(source, c, logger, bytes.NewReader(data))
+	pkg, err = parser.Parse(pkg)
 	if err != nil {
 		return nil, err
 	}
-	c.packages[pkg.Name] = pkg
+	c.packages[pkg.ID] = pkg
 
 	for alias, name := range pkg.Imports {
-		_, err := c.parsePkg(alias, name)
+		imported, err := c.parsePkg(alias, name, path.Dir(source), logger)
 		if err != nil {
 			return nil, err
 		}
+		pkg.ImportIDs[alias] = imported.ID
 	}
 
 	return pkg, nil
@@ -158,20 +203,15 @@ var packagePaths = []packagePath{
 	},
 }
 
-func (c *Compiler) parsePkg(alias, name string) (*ast.Package, error) {
-	pkg, ok := c.packages[alias]
-	if ok {
-		return pkg, nil
-	}
-	pkg = ast.NewPackage(alias)
-
-	if c.params.Verbose {
-		fmt.Printf("looking for package %s (%s)\n", alias, name)
-	}
+// searchPath returns the package search path. The search path
+// contains the utils.Params.PkgPath directories, the directories of
+// the MPCLPATH environment variable, the default package
+// directories, and the embedded standard library.
+func (c *Compiler) searchPath() []string {
+	var result []string
+	result = append(result, c.params.PkgPath...)
+	result = append(result, filepath.SplitList(os.Getenv("MPCLPATH"))...)
 
-	var dir string
-	var df *os.File
-	var err error
 	for _, pkgPath := range packagePaths {
 		// Check path precondition.
 		if len(pkgPath.precond) > 0 {
@@ -180,24 +220,186 @@ func (c *Compiler) parsePkg(alias, name string) (*ast.Package, error) {
 				continue
 			}
 		}
-		dir = path.Join(os.Getenv(pkgPath.env), pkgPath.prefix, name)
-		df, err = os.Open(dir)
-		if err == nil {
-			defer df.Close()
+		result = append(result, path.Join(os.Getenv(pkgPath.env),
+			pkgPath.prefix))
+	}
+	return append(result, utils.StdlibRoot)
+}
+
+// findPkg finds the directory of the named package, imported from the
+// directory fromDir. Relative package names starting with "./" or
+// "../" are resolved from the importing directory. Other packages are
+// searched from the importing module, from the vendor directories
+// between the importing directory and its module root, and from the
+// package search path. The packages of the embedded standard library
+// are searched only from the package search path.
+func (c *Compiler) findPkg(name, fromDir string) (string, error) {
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		dir := path.Join(fromDir, name)
+		if !isDir(dir) {
+			return "", fmt.Errorf("package %s not found", name)
+		}
+		return dir, nil
+	}
+
+	if utils.IsStdlib(fromDir) {
+		for _, d := range c.searchPath() {
+			dir, err := c.lookupPkg(d, name)
+			if err != nil {
+				return "", err
+			}
+			if len(dir) > 0 {
+				return dir, nil
+			}
+		}
+		return "", fmt.Errorf("package %s not found", name)
+	}
+
+	mod, err := c.findModule(fromDir)
+	if err != nil {
+		return "", err
+	}
+	if mod != nil {
+		dir, ok := mod.PkgDir(name)
+		if ok {
+			if !isDir(dir) {
+				return "", fmt.Errorf("package %s not found in module %s",
+					name, mod.Path)
+			}
+			return dir, nil
+		}
+	}
+
+	var dirs []string
+	dir, err := filepath.Abs(fromDir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		dirs = append(dirs, path.Join(dir, "vendor"))
+		if mod != nil && dir == mod.Dir {
+			break
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
 			break
 		}
+		dir = parent
+	}
+	dirs = append(dirs, c.searchPath()...)
+
+	for _, d := range dirs {
+		dir, err := c.lookupPkg(d, name)
+		if err != nil {
+			return "", err
+		}
+		if len(dir) == 0 {
+			continue
+		}
+		if mod != nil {
+			err = c.checkRequire(mod, name, dir)
+			if err != nil {
+				return "", err
+			}
+		}
+		return dir, nil
+	}
+	return "", fmt.Errorf("package %s not found", name)
+}
+
+// lookupPkg looks up the named package from the directory dir. The
+// package can be in the directory of its name, or in a module whose
+// manifest is in the directory of the name's prefix.
+func (c *Compiler) lookupPkg(dir, name string) (string, error) {
+	pkgDir := path.Join(dir, name)
+	if isDir(pkgDir) {
+		return pkgDir, nil
+	}
+	parts := strings.Split(name, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		modDir := path.Join(dir, path.Join(parts[:i]...))
+		if !isFile(path.Join(modDir, ModuleFile)) {
+			continue
+		}
+		mod, err := c.findModule(modDir)
+		if err != nil {
+			return "", err
+		}
+		pkgDir, ok := mod.PkgDir(name)
+		if ok && isDir(pkgDir) {
+			return pkgDir, nil
+		}
+	}
+	return "", nil
+}
+
+// checkRequire checks that the package dir, found for the named
+// package, belongs to the module version that the module mod
+// requires.
+func (c *Compiler) checkRequire(mod *Module, name, dir string) error {
+	req, version, ok := mod.Require(name)
+	if !ok {
+		return nil
 	}
-	if df == nil {
-		return nil, fmt.Errorf("package %s not found", name)
+	dep, err := c.findModule(dir)
+	if err != nil {
+		return err
+	}
+	if dep == nil || dep.Path != req {
+		return fmt.Errorf("package %s: required module %s not found",
+			name, req)
+	}
+	if dep.Version != version {
+		return fmt.Errorf("package %s: module %s %s required, found %s",
+			name, req, version, dep.Version)
+	}
+	return nil
+}
+
+func isDir(name string) bool {
+	fi, err := utils.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+func isFile(name string) bool {
+	fi, err := utils.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (c *Compiler) parsePkg(alias, name, fromDir string,
+	logger *utils.Logger) (*ast.Package, error) {
+
+	if c.params.Verbose {
+		fmt.Printf("looking for package %s (%s)\n", alias, name)
+	}
+
+	dir, err := c.findPkg(name, fromDir)
+	if err != nil {
+		return nil, err
 	}
 
-	files, err := df.Readdirnames(-1)
+	// The packages are identified by their directories since the
+	// imports of different packages can have the same name or alias.
+	id := dir
+	if !utils.IsStdlib(dir) {
+		id, err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pkg, ok := c.packages[id]
+	if ok {
+		return pkg, nil
+	}
+	pkg = ast.NewPackage("")
+	pkg.ID = id
+	files, err := utils.ReadDirNames(dir)
 	if err != nil {
 		return nil, fmt.Errorf("package %s not found: %s", name, err)
 	}
 	var mpcls []string
 	for _, f := range files {
-		if strings.HasSuffix(f, ".mpcl") {
+		if strings.HasSuffix(f, ".mpcl") && !strings.HasSuffix(f, TestSuffix) {
 			mpcls = append(mpcls, f)
 		}
 	}
@@ -212,14 +414,14 @@ func (c *Compiler) parsePkg(alias, name string) (*ast.Package, error) {
 			fmt.Printf(" - parsing %v\n", fp)
 		}
 
-		f, err := os.Open(fp)
+		f, err := utils.OpenFile(fp)
 		if err != nil {
 			fmt.Printf("pkg not found: %s\n", err)
 			return nil, fmt.Errorf("error reading package %s: %s", name, err)
 		}
 		defer f.Close()
 
-		pkg, err = c.parse(fp, f, utils.NewLogger(os.Stdout), pkg)
+		pkg, err = c.parse(fp, f, logger, pkg)
 		if err != nil {
 			return nil, err
 		}
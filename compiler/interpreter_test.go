@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var interpreterTests = []string{
+	`
+package main
+func main(a, b uint8) (uint8, uint8, uint16, uint8, uint8) {
+	return a + b, a - b, uint16(a) * uint16(b), a / b, a % b
+}
+`,
+	`
+package main
+func main(a int16, b uint4) (int16, int16, int16, uint16, uint16) {
+	return a << b, a >> b, a << 3, uint16(a) >> b, uint16(a) >> 9
+}
+`,
+	`
+package main
+func main(a int8, b int8) (bool, bool, bool, bool, bool, bool) {
+	return a < b, a <= b, a > b, a >= b, a == b, a != b
+}
+`,
+	`
+package main
+import (
+	"math/bits"
+	"encoding/binary"
+)
+func main(a uint32, b uint5) (uint32, uint32, uint32) {
+	return bits.RotateLeft(a, b), bits.RotateRight(a, 7),
+		binary.HammingDistance(a, uint32(b))
+}
+`,
+	`
+package main
+func main(a, b uint16) (uint16, uint8) {
+	var arr [4]uint8
+	arr[1] = uint8(a)
+	arr[3] = uint8(b)
+	if a > b {
+		arr[0] = uint8(a ^ b)
+	} else {
+		arr[2] = uint8(a &^ b | b)
+	}
+	return uint16(arr[0]) | uint16(arr[1])<<8, arr[2] + arr[3]
+}
+`,
+	`
+package main
+import (
+	"math"
+)
+func main(a, b uint64) (uint64, uint64) {
+	return math.MulUint64(a, b), math.AddUint64(a, b)
+}
+`,
+}
+
+func TestInterpreter(t *testing.T) {
+	for idx, src := range interpreterTests {
+		params := &utils.Params{
+			OptPruneGates:    true,
+			OptSimplifyGates: true,
+			OptDedupGates:    true,
+		}
+		program, _, err := NewCompiler(params).CompileSSA(src)
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+		circ, err := program.CompileCircuit(params)
+		if err != nil {
+			t.Fatalf("test %d: circuit compilation failed: %s", idx, err)
+		}
+		compareRandom(t, fmt.Sprintf("test %d", idx), program, circ)
+	}
+}
+
+// constEvalFunc is evaluated both in the circuit with the secret
+// arguments and at compile time with the constant arguments.
+const constEvalFunc = `
+func f(a int8, b uint8) (int8, int8, int8, int8, int8, bool, bool, bool,
+	bool, uint8) {
+	c := int8(b | 1)
+	return a / 3, a % 3, a / c, a >> 2, a >> (b & 7), a < 0, a <= c,
+		a > c, c >= a, b / 7
+}
+`
+
+func TestConstEval(t *testing.T) {
+	params := &utils.Params{}
+	secret, _, err := NewCompiler(params).Compile(`
+package main
+func main(a int8, b uint8) (int8, int8, int8, int8, int8, bool, bool, bool,
+	bool, uint8) {
+	return f(a, b)
+}
+` + constEvalFunc)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+
+	for _, a := range []int64{-128, -7, -1, 0, 5, 127} {
+		for _, b := range []int64{0, 3, 100, 200} {
+			circ, _, err := NewCompiler(params).Compile(fmt.Sprintf(`
+package main
+func main(a int8, b uint8) (int8, int8, int8, int8, int8, bool, bool, bool,
+	bool, uint8) {
+	return f(0%+d, %d)
+}
+`, a, b) + constEvalFunc)
+			if err != nil {
+				t.Fatalf("f(%d, %d): compile failed: %s", a, b, err)
+			}
+			expected, err := secret.Compute([]*big.Int{
+				big.NewInt(a & 0xff), big.NewInt(b),
+			})
+			if err != nil {
+				t.Fatalf("f(%d, %d): compute failed: %s", a, b, err)
+			}
+			results, err := circ.Compute([]*big.Int{
+				big.NewInt(0), big.NewInt(0),
+			})
+			if err != nil {
+				t.Fatalf("f(%d, %d): compute failed: %s", a, b, err)
+			}
+			for j := range expected {
+				if results[j].Cmp(expected[j]) != 0 {
+					t.Errorf("f(%d, %d): result %d: got %v, expected %v",
+						a, b, j, results[j], expected[j])
+				}
+			}
+		}
+	}
+}
+
+var binaryEvalTests = []struct {
+	Expr string
+	Type string
+}{
+	{`1 << 40 >> 38`, "uint32"},
+	{`(1 << 33) / (1 << 31)`, "uint32"},
+	{`(0 - 7) / 2 + 10`, "int32"},
+	{`(0 - 7) % 2`, "int32"},
+	{`0xff &^ 0x0f | 0x100`, "uint32"},
+	{`0 - 1 < 0`, "bool"},
+	{`1 << 32 > 1`, "bool"},
+	{`"abc" < "abd"`, "bool"},
+	{`true && 1 < 2`, "bool"},
+}
+
+func TestBinaryEval(t *testing.T) {
+	for idx, test := range binaryEvalTests {
+		// The constant is folded with Binary.Eval and the function
+		// body is evaluated with the compile-time interpreter.
+		var results [][]*big.Int
+		for _, src := range []string{
+			fmt.Sprintf(`
+package main
+const R = (%s)
+func main(a uint8) %s {
+	return R
+}
+`, test.Expr, test.Type),
+			fmt.Sprintf(`
+package main
+func main(a uint8) %s {
+	return f()
+}
+func f() %s {
+	return %s
+}
+`, test.Type, test.Type, test.Expr),
+		} {
+			circ, _, err := NewCompiler(&utils.Params{}).Compile(src)
+			if err != nil {
+				t.Fatalf("test %d: compile failed: %s", idx, err)
+			}
+			result, err := circ.Compute([]*big.Int{big.NewInt(0)})
+			if err != nil {
+				t.Fatalf("test %d: compute failed: %s", idx, err)
+			}
+			results = append(results, result)
+		}
+		if results[0][0].Cmp(results[1][0]) != 0 {
+			t.Errorf("test %d: %s: folded %v, interpreted %v",
+				idx, test.Expr, results[0][0], results[1][0])
+		}
+	}
+}
+
+func TestInterpreterTrace(t *testing.T) {
+	program, _, err := NewCompiler(&utils.Params{}).CompileSSA(`
+package main
+func main(a, b int32) int32 {
+	return a + b
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace bytes.Buffer
+	results, err := program.Run([]*big.Int{big.NewInt(40), big.NewInt(2)},
+		&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Int64() != 42 {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if !bytes.Contains(trace.Bytes(), []byte("iadd")) ||
+		!bytes.Contains(trace.Bytes(), []byte("2a/32")) {
+		t.Errorf("unexpected trace:\n%s", trace.String())
+	}
+}
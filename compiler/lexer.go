@@ -40,6 +40,11 @@ const (
 	TSymConst
 	TSymType
 	TSymFor
+	TSymSwitch
+	TSymCase
+	TSymDefault
+	TSymBreak
+	TSymContinue
 	TAssign
 	TDefAssign
 	TMult
@@ -81,58 +86,63 @@ const (
 )
 
 var tokenTypes = map[TokenType]string{
-	TIdentifier: "identifier",
-	TConstant:   "constant",
-	TSymbol:     "symbol",
-	TSymPackage: "package",
-	TSymImport:  "import",
-	TSymFunc:    "func",
-	TSymIf:      "if",
-	TSymElse:    "else",
-	TSymReturn:  "return",
-	TSymStruct:  "struct",
-	TSymVar:     "var",
-	TSymConst:   "const",
-	TSymType:    "type",
-	TSymFor:     "for",
-	TAssign:     "=",
-	TDefAssign:  ":=",
-	TMult:       "*",
-	TMultEq:     "*=",
-	TDiv:        "/",
-	TDivEq:      "/=",
-	TMod:        "%",
-	TLshift:     "<<",
-	TRshift:     ">>",
-	TPlus:       "+",
-	TPlusPlus:   "++",
-	TPlusEq:     "+=",
-	TMinus:      "-",
-	TMinusMinus: "--",
-	TMinusEq:    "-=",
-	TLParen:     "(",
-	TRParen:     ")",
-	TLBrace:     "{",
-	TRBrace:     "}",
-	TLBracket:   "[",
-	TRBracket:   "]",
-	TComma:      ",",
-	TSemicolon:  ";",
-	TColon:      ":",
-	TDot:        ".",
-	TLt:         "<",
-	TLe:         "<=",
-	TGt:         ">",
-	TGe:         ">=",
-	TEq:         "==",
-	TNeq:        "!=",
-	TAnd:        "&&",
-	TOr:         "||",
-	TNot:        "!",
-	TBitAnd:     "&",
-	TBitOr:      "|",
-	TBitXor:     "^",
-	TBitClear:   "&^",
+	TIdentifier:  "identifier",
+	TConstant:    "constant",
+	TSymbol:      "symbol",
+	TSymPackage:  "package",
+	TSymImport:   "import",
+	TSymFunc:     "func",
+	TSymIf:       "if",
+	TSymElse:     "else",
+	TSymReturn:   "return",
+	TSymStruct:   "struct",
+	TSymVar:      "var",
+	TSymConst:    "const",
+	TSymType:     "type",
+	TSymFor:      "for",
+	TSymSwitch:   "switch",
+	TSymCase:     "case",
+	TSymDefault:  "default",
+	TSymBreak:    "break",
+	TSymContinue: "continue",
+	TAssign:      "=",
+	TDefAssign:   ":=",
+	TMult:        "*",
+	TMultEq:      "*=",
+	TDiv:         "/",
+	TDivEq:       "/=",
+	TMod:         "%",
+	TLshift:      "<<",
+	TRshift:      ">>",
+	TPlus:        "+",
+	TPlusPlus:    "++",
+	TPlusEq:      "+=",
+	TMinus:       "-",
+	TMinusMinus:  "--",
+	TMinusEq:     "-=",
+	TLParen:      "(",
+	TRParen:      ")",
+	TLBrace:      "{",
+	TRBrace:      "}",
+	TLBracket:    "[",
+	TRBracket:    "]",
+	TComma:       ",",
+	TSemicolon:   ";",
+	TColon:       ":",
+	TDot:         ".",
+	TLt:          "<",
+	TLe:          "<=",
+	TGt:          ">",
+	TGe:          ">=",
+	TEq:          "==",
+	TNeq:         "!=",
+	TAnd:         "&&",
+	TOr:          "||",
+	TNot:         "!",
+	TBitAnd:      "&",
+	TBitOr:       "|",
+	TBitXor:      "^",
+	TBitClear:    "&^",
 }
 
 func (t TokenType) String() string {
@@ -175,17 +185,22 @@ func (t TokenType) BinaryType() ast.BinaryType {
 }
 
 var symbols = map[string]TokenType{
-	"import":  TSymImport,
-	"const":   TSymConst,
-	"type":    TSymType,
-	"for":     TSymFor,
-	"else":    TSymElse,
-	"func":    TSymFunc,
-	"if":      TSymIf,
-	"package": TSymPackage,
-	"return":  TSymReturn,
-	"struct":  TSymStruct,
-	"var":     TSymVar,
+	"import":   TSymImport,
+	"const":    TSymConst,
+	"type":     TSymType,
+	"for":      TSymFor,
+	"else":     TSymElse,
+	"func":     TSymFunc,
+	"if":       TSymIf,
+	"package":  TSymPackage,
+	"return":   TSymReturn,
+	"struct":   TSymStruct,
+	"var":      TSymVar,
+	"switch":   TSymSwitch,
+	"case":     TSymCase,
+	"default":  TSymDefault,
+	"break":    TSymBreak,
+	"continue": TSymContinue,
 }
 
 // Token specifies an input token.
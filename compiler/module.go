@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// ModuleFile is the name of the MPCL module manifest file.
+const ModuleFile = "mpcl.mod"
+
+// Module implements an MPCL module. The module manifest declares the
+// module path, its version, the root directory of the module's
+// packages, and the versions of the required modules:
+//
+//	module example.com/crypto
+//	version v1.2.0
+//	root pkg
+//	require example.com/math v0.3.1
+type Module struct {
+	Dir      string
+	Path     string
+	Version  string
+	Root     string
+	Requires map[string]string
+}
+
+// ParseModule parses the module manifest file.
+func ParseModule(file string) (*Module, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mod := &Module{
+		Dir:      path.Dir(file),
+		Requires: make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(f)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		idx := strings.Index(text, "//")
+		if idx >= 0 {
+			text = text[:idx]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "module", "version", "root":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: usage: %s %s", file, line,
+					fields[0], directiveArgs[fields[0]])
+			}
+			switch fields[0] {
+			case "module":
+				mod.Path = fields[1]
+			case "version":
+				mod.Version = fields[1]
+			case "root":
+				mod.Root = fields[1]
+			}
+
+		case "require":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%s:%d: usage: require module version",
+					file, line)
+			}
+			mod.Requires[fields[1]] = fields[2]
+
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown directive: %s",
+				file, line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(mod.Path) == 0 {
+		return nil, fmt.Errorf("%s: missing module path", file)
+	}
+	return mod, nil
+}
+
+// directiveArgs describe the arguments of the single argument
+// directives in usage messages.
+var directiveArgs = map[string]string{
+	"module":  "path",
+	"version": "version",
+	"root":    "dir",
+}
+
+// PkgDir returns the directory of the named package if the package
+// belongs to the module.
+func (mod *Module) PkgDir(name string) (string, bool) {
+	if name != mod.Path && !strings.HasPrefix(name, mod.Path+"/") {
+		return "", false
+	}
+	return path.Join(mod.Dir, mod.Root, strings.TrimPrefix(name, mod.Path)),
+		true
+}
+
+// Require returns the required module and its version for the named
+// package.
+func (mod *Module) Require(name string) (string, string, bool) {
+	for p, version := range mod.Requires {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return p, version, true
+		}
+	}
+	return "", "", false
+}
+
+// findModule finds the module containing the directory dir. The
+// function returns nil if the directory does not belong to any
+// module.
+func (c *Compiler) findModule(dir string) (*Module, error) {
+	if utils.IsStdlib(dir) {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		mod, ok := c.modules[dir]
+		if ok {
+			return mod, nil
+		}
+		file := path.Join(dir, ModuleFile)
+		_, err := os.Stat(file)
+		if err == nil {
+			mod, err = ParseModule(file)
+			if err != nil {
+				return nil, err
+			}
+			c.modules[dir] = mod
+			return mod, nil
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,341 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var moduleFiles = map[string]string{
+	"app/mpcl.mod": `
+module example.com/app
+root src
+require example.com/lib v1.0.0
+`,
+	"app/main.mpcl": `
+package main
+import (
+	"./util"
+	"example.com/app/bits"
+	"example.com/lib/sum"
+	"ext"
+)
+func main(a, b int32) int32 {
+	return ext.Dec(sum.Add(util.Double(a), bits.Low(b)))
+}
+`,
+	"app/util/util.mpcl": `
+package util
+func Double(a int32) int32 {
+	return a + a
+}
+`,
+	"app/src/bits/bits.mpcl": `
+package bits
+func Low(a int32) int32 {
+	return a & 0xff
+}
+`,
+	"app/vendor/example.com/lib/mpcl.mod": `
+module example.com/lib
+version v1.0.0
+root pkg
+`,
+	"app/vendor/example.com/lib/pkg/sum/sum.mpcl": `
+package sum
+func Add(a, b int32) int32 {
+	return a + b
+}
+`,
+	"ext/ext.mpcl": `
+package ext
+func Dec(a int32) int32 {
+	return a - 1
+}
+`,
+}
+
+func writeModuleFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "mpclmod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		file := path.Join(dir, name)
+		err = os.MkdirAll(path.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestModules(t *testing.T) {
+	dir := writeModuleFiles(t, moduleFiles)
+	defer os.RemoveAll(dir)
+
+	params := &utils.Params{
+		PkgPath: []string{dir},
+	}
+	_, _, err := NewCompiler(params).CompileFile(path.Join(dir,
+		"app/main.mpcl"))
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	files := make(map[string]string)
+	for k, v := range moduleFiles {
+		files[k] = v
+	}
+	files["app/vendor/example.com/lib/mpcl.mod"] = `
+module example.com/lib
+version v0.9.0
+root pkg
+`
+	dir := writeModuleFiles(t, files)
+	defer os.RemoveAll(dir)
+
+	params := &utils.Params{
+		PkgPath: []string{dir},
+	}
+	_, _, err := NewCompiler(params).CompileFile(path.Join(dir,
+		"app/main.mpcl"))
+	if err == nil {
+		t.Fatalf("compile succeeded with wrong module version")
+	}
+	if !strings.Contains(err.Error(), "v1.0.0 required, found v0.9.0") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestParseModule(t *testing.T) {
+	for _, test := range []struct {
+		manifest string
+		err      string
+	}{
+		{
+			manifest: "module example.com/bad\nreplace foo\n",
+			err:      "unknown directive",
+		},
+		{
+			manifest: "module\n",
+			err:      "usage: module path",
+		},
+		{
+			manifest: "module example.com/bad\nroot a b\n",
+			err:      "usage: root dir",
+		},
+	} {
+		dir := writeModuleFiles(t, map[string]string{
+			"bad/mpcl.mod": test.manifest,
+		})
+		_, err := ParseModule(path.Join(dir, "bad", ModuleFile))
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: unexpected error: %v", test.manifest, err)
+		}
+	}
+}
+
+func TestStdlib(t *testing.T) {
+	home, err := ioutil.TempDir("", "mpclhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	// Hide the on-disk standard library so that the packages are
+	// loaded from the embedded library.
+	oldHome := os.Getenv("HOME")
+	oldWorkflow, workflow := os.LookupEnv("GITHUB_WORKFLOW")
+	os.Setenv("HOME", home)
+	os.Unsetenv("GITHUB_WORKFLOW")
+	defer func() {
+		os.Setenv("HOME", oldHome)
+		if workflow {
+			os.Setenv("GITHUB_WORKFLOW", oldWorkflow)
+		}
+	}()
+
+	src := `
+package main
+import (
+	"math"
+)
+func main(a, b uint64) uint64 {
+	return math.AddUint64(a, b)
+}
+`
+	circ, _, err := NewCompiler(&utils.Params{}).Compile(src)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(40), big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Int64() != 42 {
+		t.Errorf("unexpected result: %v", results)
+	}
+
+	// On-disk packages override the embedded library.
+	dir := writeModuleFiles(t, map[string]string{
+		"math/math.mpcl": `
+package math
+func AddUint64(a, b uint64) uint64 {
+	return a - b
+}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	circ, _, err = NewCompiler(&utils.Params{
+		PkgPath: []string{dir},
+	}).Compile(src)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	results, err = circ.Compute([]*big.Int{big.NewInt(40), big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Int64() != 38 {
+		t.Errorf("unexpected result: %v", results)
+	}
+}
+
+var collisionFiles = map[string]string{
+	"app/main.mpcl": `
+package main
+import (
+	"./util"
+	"./other"
+	butil "./b/util"
+)
+func main(a, b int32) int32 {
+	var v util.Value
+	v.X = a
+	return v.Get() + other.Inc(b) + butil.Scale(a)
+}
+`,
+	"app/util/util.mpcl": `
+package util
+type Value struct {
+	X int32
+}
+func (v Value) Get() int32 {
+	return v.X
+}
+`,
+	"app/other/other.mpcl": `
+package other
+import (
+	"./util"
+)
+func Inc(a int32) int32 {
+	var v util.Value
+	v.X = a
+	return v.Get()
+}
+`,
+	"app/other/util/util.mpcl": `
+package util
+type Value struct {
+	X int32
+}
+func (v Value) Get() int32 {
+	return v.X + 1
+}
+`,
+	"app/b/util/util.mpcl": `
+package util
+func Scale(a int32) int32 {
+	return a * 100
+}
+`,
+}
+
+func TestPackageCollision(t *testing.T) {
+	dir := writeModuleFiles(t, collisionFiles)
+	defer os.RemoveAll(dir)
+
+	circ, _, err := NewCompiler(&utils.Params{}).CompileFile(path.Join(dir,
+		"app/main.mpcl"))
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(2), big.NewInt(5)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Int64() != 2+6+200 {
+		t.Errorf("unexpected result: %v", results)
+	}
+}
+
+func TestNativeMPCLC(t *testing.T) {
+	bristol := "8 24\n2 8 8\n1 8\n\n"
+	for i := 0; i < 8; i++ {
+		bristol += fmt.Sprintf("2 1 %d %d %d AND\n", i, 8+i, 16+i)
+	}
+	and, err := circuit.ParseBristol(strings.NewReader(bristol))
+	if err != nil {
+		t.Fatalf("ParseBristol: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := and.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	dir := writeModuleFiles(t, map[string]string{
+		"app/main.mpcl": `
+package main
+import (
+	"./nat"
+)
+func main(a, b uint8) uint8 {
+	return nat.And(a, b)
+}
+`,
+		"app/nat/nat.mpcl": `
+package nat
+func And(a, b uint8) uint8 {
+	return native("and.mpclc", a, b)
+}
+`,
+		"app/nat/and.mpclc": buf.String(),
+	})
+	defer os.RemoveAll(dir)
+
+	circ, _, err := NewCompiler(&utils.Params{}).CompileFile(path.Join(dir,
+		"app/main.mpcl"))
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(0x3c), big.NewInt(0x0f)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Int64() != 0x0c {
+		t.Errorf("unexpected result: %v", results)
+	}
+}
@@ -0,0 +1,200 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var optimizeTests = []string{
+	`
+package main
+func main(a, b uint32) (uint32, uint32) {
+	x := a + b
+	var y uint32
+	if x > 7 {
+		y = x * 3
+	} else {
+		y = x * 3
+	}
+	z := b + a
+	var c uint32 = 5
+	if c > 3 {
+		z = z ^ a
+	}
+	return y ^ (a + b), z
+}
+`,
+}
+
+func TestOptimize(t *testing.T) {
+	tests := append(optimizeTests, interpreterTests...)
+	for idx, src := range tests {
+		ref, _, err := NewCompiler(&utils.Params{}).CompileSSA(src)
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+		params := &utils.Params{}
+		params.SetOptLevel(2)
+		program, _, err := NewCompiler(params).CompileSSA(src)
+		if err != nil {
+			t.Fatalf("test %d: optimized compile failed: %s", idx, err)
+		}
+		if len(program.Steps) > len(ref.Steps) {
+			t.Errorf("test %d: optimized program has %d steps, expected <= %d",
+				idx, len(program.Steps), len(ref.Steps))
+		}
+		if idx < len(optimizeTests) && len(program.Steps) == len(ref.Steps) {
+			t.Errorf("test %d: program not optimized", idx)
+		}
+		circ, err := program.CompileCircuit(params)
+		if err != nil {
+			t.Fatalf("test %d: circuit compilation failed: %s", idx, err)
+		}
+		compareRandom(t, fmt.Sprintf("test %d", idx), ref, circ, program)
+	}
+}
+
+var optimizedCircuitTests = []struct {
+	name   string
+	src    string
+	ref    utils.Params
+	params utils.Params
+}{
+	{
+		name: "narrow widths",
+		src: `
+package main
+func main(a, b uint64) (uint64, uint64, bool) {
+	x := a & 0xff
+	y := b >> 48
+	return x*y + x, (a >> 40) % (y | 1), x < y
+}
+`,
+		params: utils.Params{
+			OptNarrowWidths: true,
+		},
+	},
+	{
+		name: "strength reduce",
+		src: `
+package main
+func main(a, b uint32) (uint32, uint32, uint32, uint32) {
+	x := a + b
+	return x * 1000, 3 * b, x / 7, a % 10
+}
+`,
+		params: utils.Params{
+			OptStrengthReduce: true,
+		},
+	},
+	{
+		name: "strength reduce cost",
+		src: `
+package main
+func main(a uint8, b int8) (uint8, uint8, uint8, uint8, uint8, int8, int8,
+	int8) {
+	return a / 128, a / 129, a * 128, a / 1, a % 3, b / 127, b % 2, b % 127
+}
+`,
+		ref: utils.Params{
+			OptSimplifyGates: true,
+			OptDedupGates:    true,
+			OptPruneGates:    true,
+		},
+		params: utils.Params{
+			OptSimplifyGates:  true,
+			OptDedupGates:     true,
+			OptPruneGates:     true,
+			OptStrengthReduce: true,
+		},
+	},
+}
+
+func TestOptimizedCircuits(t *testing.T) {
+	for _, test := range optimizedCircuitTests {
+		t.Run(test.name, func(t *testing.T) {
+			ref := test.ref
+			params := test.params
+			compareOptimized(t, test.src, &ref, &params)
+		})
+	}
+}
+
+// compareOptimized compiles the program src with the reference
+// params and with the optimization params. It checks that the
+// optimized circuit is cheaper and that it computes the same results
+// as the reference program.
+func compareOptimized(t *testing.T, src string, refParams,
+	params *utils.Params) {
+	ref, _, err := NewCompiler(refParams).CompileSSA(src)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	refCirc, err := ref.CompileCircuit(refParams)
+	if err != nil {
+		t.Fatalf("circuit compilation failed: %s", err)
+	}
+	program, _, err := NewCompiler(params).CompileSSA(src)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	circ, err := program.CompileCircuit(params)
+	if err != nil {
+		t.Fatalf("circuit compilation failed: %s", err)
+	}
+	if circ.Cost() >= refCirc.Cost() {
+		t.Errorf("optimized circuit cost %d, expected < %d",
+			circ.Cost(), refCirc.Cost())
+	}
+
+	compareRandom(t, "optimized", ref, circ)
+}
+
+// compareRandom runs the reference program ref with random inputs and
+// checks that the circuit circ and the programs compute the same
+// results.
+func compareRandom(t *testing.T, name string, ref *ssa.Program,
+	circ *circuit.Circuit, programs ...*ssa.Program) {
+
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 50; i++ {
+		inputs := ref.Inputs.Random(rnd)
+		expected, err := ref.Run(inputs, nil)
+		if err != nil {
+			t.Fatalf("%s: run failed: %s", name, err)
+		}
+		computed, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("%s: compute failed: %s", name, err)
+		}
+		for j := range expected {
+			if computed[j].Cmp(expected[j]) != 0 {
+				t.Errorf("%s: inputs %v: circuit result %d: got %v, expected %v",
+					name, inputs, j, computed[j], expected[j])
+			}
+		}
+		for _, program := range programs {
+			results, err := program.Run(inputs, nil)
+			if err != nil {
+				t.Fatalf("%s: run failed: %s", name, err)
+			}
+			for j := range expected {
+				if results[j].Cmp(expected[j]) != 0 {
+					t.Errorf("%s: inputs %v: result %d: got %v, expected %v",
+						name, inputs, j, results[j], expected[j])
+				}
+			}
+		}
+	}
+}
@@ -7,7 +7,6 @@
 package compiler
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -22,6 +21,10 @@ type Parser struct {
 	logger   *utils.Logger
 	lexer    *Lexer
 	pkg      *ast.Package
+
+	// noCompositeLit disables composite literals in control clauses
+	// where the opening brace starts the statement block.
+	noCompositeLit bool
 }
 
 // NewParser creates a new parser.
@@ -42,6 +45,10 @@ func (p *Parser) Parse(pkg *ast.Package) (*ast.Package, error) {
 	}
 	if pkg == nil {
 		p.pkg = ast.NewPackage(name)
+	} else if len(pkg.Name) == 0 {
+		// The first source file of an imported package.
+		pkg.Name = name
+		p.pkg = pkg
 	} else {
 		// This source file must be in the same package.
 		if name != pkg.Name {
@@ -98,55 +105,80 @@ func (p *Parser) Parse(pkg *ast.Package) (*ast.Package, error) {
 				alias = parts[len(parts)-1]
 			}
 
-			imports[alias] = str
+			imports[str] = alias
+
+			// The imports of the package's source files are merged.
+			prev, ok := p.pkg.Imports[alias]
+			if ok && prev != str {
+				return nil, p.errf(t.From,
+					"import %s redeclared as %s in package %s",
+					alias, str, p.pkg.Name)
+			}
+			p.pkg.Imports[alias] = str
+			if p.pkg.ImportLocs == nil {
+				p.pkg.ImportLocs = make(map[string]utils.Point)
+			}
+			if !ok {
+				p.pkg.ImportLocs[alias] = t.From
+			}
 		}
-		p.pkg.Imports = imports
 	} else {
 		p.lexer.Unget(token)
 	}
 
+	// Parse top-level declarations. After a syntax error, the parser
+	// skips to the next declaration to report all errors of the
+	// input.
+	var first error
 	for {
+		errors := p.logger.Errors()
 		err = p.parseToplevel()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			if first == nil {
+				first = err
+			}
+			if p.logger.Errors() == errors {
+				p.logger.Errorf(p.lexer.point, "%s", err)
+			}
+			if p.logger.TooManyErrors() || !p.skipToplevel() {
+				break
+			}
 		}
 	}
+	if first != nil {
+		return nil, first
+	}
 
 	return p.pkg, nil
 }
 
-func (p *Parser) errf(loc utils.Point, format string, a ...interface{}) error {
-	msg := fmt.Sprintf(format, a...)
-
-	p.lexer.FlushEOL()
-
-	line, ok := p.lexer.history[loc.Line]
-	if ok {
-		var indicator []rune
-		for i := 0; i < loc.Col; i++ {
-			var r rune
-			if line[i] == '\t' {
-				r = '\t'
-			} else {
-				r = ' '
+// skipToplevel skips input until the start of the next top-level
+// declaration. It returns false if the input ends before that.
+func (p *Parser) skipToplevel() bool {
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return false
+		}
+		switch t.Type {
+		case TSymFunc, TSymType, TSymConst, TSymVar:
+			if t.From.Col == 0 {
+				p.lexer.Unget(t)
+				return true
 			}
-			indicator = append(indicator, r)
 		}
-		indicator = append(indicator, '^')
-		p.logger.Errorf(loc, "%s\n%s\n%s\n",
-			msg, string(line), string(indicator))
-
-		return errors.New(msg)
 	}
-	p.logger.Errorf(loc, "%s", msg)
-	return errors.New(msg)
+}
+
+func (p *Parser) errf(loc utils.Point, format string, a ...interface{}) error {
+	return p.logger.Errorf(loc, format, a...)
 }
 
 func (p *Parser) errUnexpected(offending *Token, expected TokenType) error {
-	return p.errf(offending.From, "unexpected token '%s': expected '%s'",
-		offending, expected)
+	return p.logger.ErrorRangef(offending.From, offending.To,
+		"unexpected token '%s': expected '%s'", offending, expected)
 }
 
 func (p *Parser) needToken(tt TokenType) (*Token, error) {
@@ -200,6 +232,21 @@ func (p *Parser) parseToplevel() error {
 		if err != nil {
 			return err
 		}
+		if f.Receiver != nil {
+			typeName := f.Receiver.Type.Name.Name
+			methods, ok := p.pkg.Methods[typeName]
+			if !ok {
+				methods = make(map[string]*ast.Func)
+				p.pkg.Methods[typeName] = methods
+			}
+			_, ok = methods[f.Name]
+			if ok {
+				return p.errf(f.Loc, "method %s.%s already declared",
+					typeName, f.Name)
+			}
+			methods[f.Name] = f
+			return nil
+		}
 		_, ok := p.pkg.Functions[f.Name]
 		if ok {
 			return p.errf(f.Loc, "function %s already defined", f.Name)
@@ -360,11 +407,46 @@ func (p *Parser) parseTypeDecl() error {
 }
 
 func (p *Parser) parseFunc(annotations ast.Annotations) (*ast.Func, error) {
+	// Receiver.
+	var receiver *ast.Variable
+
+	t, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == TLParen {
+		receiver, err = p.parseReceiver()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.lexer.Unget(t)
+	}
+
 	name, err := p.needToken(TIdentifier)
 	if err != nil {
 		return nil, err
 	}
 
+	// Type parameters.
+	var typeParams []*ast.Variable
+
+	t, err = p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == TLBracket {
+		if receiver != nil {
+			return nil, p.errf(t.From, "methods cannot have type parameters")
+		}
+		typeParams, err = p.parseTypeParams()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.lexer.Unget(t)
+	}
+
 	_, err = p.needToken(TLParen)
 	if err != nil {
 		return nil, err
@@ -374,7 +456,7 @@ func (p *Parser) parseFunc(annotations ast.Annotations) (*ast.Func, error) {
 
 	var arguments []*ast.Variable
 
-	t, err := p.lexer.Get()
+	t, err = p.lexer.Get()
 	if err != nil {
 		return nil, err
 	}
@@ -488,8 +570,100 @@ func (p *Parser) parseFunc(annotations ast.Annotations) (*ast.Func, error) {
 		return nil, err
 	}
 
-	return ast.NewFunc(name.From, name.StrVal, arguments, returnValues, body,
-		annotations), nil
+	f := ast.NewFunc(name.From, name.StrVal, arguments, returnValues, body,
+		annotations)
+	f.Receiver = receiver
+	f.TypeParams = typeParams
+
+	return f, nil
+}
+
+// TypeParameters = "[" TypeParamList [ "," ] "]" .
+// TypeParamList  = TypeParamDecl { "," TypeParamDecl } .
+// TypeParamDecl  = IdentifierList TypeConstraint .
+
+func (p *Parser) parseTypeParams() ([]*ast.Variable, error) {
+	var params []*ast.Variable
+	var pending []*ast.Variable
+
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == TRBracket && len(params) > 0 && len(pending) == 0 {
+			break
+		}
+		if t.Type != TIdentifier {
+			return nil, p.errUnexpected(t, TIdentifier)
+		}
+		for _, param := range append(params, pending...) {
+			if param.Name == t.StrVal {
+				return nil, p.errf(t.From, "%s redeclared", t.StrVal)
+			}
+		}
+		pending = append(pending, &ast.Variable{
+			Loc:  t.From,
+			Name: t.StrVal,
+		})
+
+		t, err = p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == TComma {
+			continue
+		}
+		p.lexer.Unget(t)
+
+		// Constraint applies to all pending parameters.
+		constraint, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		for _, param := range pending {
+			param.Type = constraint
+		}
+		params = append(params, pending...)
+		pending = nil
+
+		t, err = p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == TRBracket {
+			break
+		}
+		if t.Type != TComma {
+			return nil, p.errUnexpected(t, TComma)
+		}
+	}
+	return params, nil
+}
+
+// Receiver = "(" identifier TypeName ")" .
+
+func (p *Parser) parseReceiver() (*ast.Variable, error) {
+	t, err := p.needToken(TIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	typeInfo, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if typeInfo.Type != ast.TypeName || len(typeInfo.Name.Package) > 0 {
+		return nil, p.errf(t.From, "invalid receiver type %s", typeInfo)
+	}
+	_, err = p.needToken(TRParen)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Variable{
+		Loc:  t.From,
+		Name: t.StrVal,
+		Type: typeInfo,
+	}, nil
 }
 
 func (p *Parser) parseBlock() (ast.List, error) {
@@ -513,6 +687,87 @@ func (p *Parser) parseBlock() (ast.List, error) {
 	return result, nil
 }
 
+func (p *Parser) parseSwitch(tStmt *Token) (ast.AST, error) {
+	result := &ast.Switch{
+		Loc: tStmt.From,
+	}
+	t, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != TLBrace {
+		p.lexer.Unget(t)
+		result.Expr, err = p.parseControlExpr()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.needToken(TLBrace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var hasDefault bool
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		var c *ast.Case
+		switch t.Type {
+		case TRBrace:
+			return result, nil
+
+		case TSymCase:
+			exprs, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			c = &ast.Case{
+				Loc:   t.From,
+				Exprs: exprs,
+			}
+
+		case TSymDefault:
+			if hasDefault {
+				return nil, p.errf(t.From, "multiple defaults in switch")
+			}
+			hasDefault = true
+			c = &ast.Case{
+				Loc:     t.From,
+				Default: true,
+			}
+
+		default:
+			return nil, p.errUnexpected(t, TSymCase)
+		}
+		_, err = p.needToken(TColon)
+		if err != nil {
+			return nil, err
+		}
+
+		// Case body continues until the next clause or the end of
+		// the switch.
+		for {
+			t, err := p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			p.lexer.Unget(t)
+			if t.Type == TSymCase || t.Type == TSymDefault ||
+				t.Type == TRBrace {
+				break
+			}
+			stmt, err := p.parseStatement()
+			if err != nil {
+				return nil, err
+			}
+			c.Body = append(c.Body, stmt)
+		}
+		result.Cases = append(result.Cases, c)
+	}
+}
+
 func (p *Parser) parseStatement() (ast.AST, error) {
 	tStmt, err := p.lexer.Get()
 	if err != nil {
@@ -564,7 +819,7 @@ func (p *Parser) parseStatement() (ast.AST, error) {
 		}, nil
 
 	case TSymIf:
-		expr, err := p.parseExpr()
+		expr, err := p.parseControlExpr()
 		if err != nil {
 			return nil, err
 		}
@@ -595,6 +850,7 @@ func (p *Parser) parseStatement() (ast.AST, error) {
 			p.lexer.Unget(t)
 		}
 		return &ast.If{
+			Loc:   tStmt.From,
 			Expr:  expr,
 			True:  b1,
 			False: b2,
@@ -630,6 +886,8 @@ func (p *Parser) parseStatement() (ast.AST, error) {
 		}, nil
 
 	case TSymFor:
+		noCompositeLit := p.noCompositeLit
+		p.noCompositeLit = true
 		init, err := p.parseStatement()
 		if err != nil {
 			return nil, err
@@ -650,6 +908,7 @@ func (p *Parser) parseStatement() (ast.AST, error) {
 		if err != nil {
 			return nil, err
 		}
+		p.noCompositeLit = noCompositeLit
 		_, err = p.needToken(TLBrace)
 		if err != nil {
 			return nil, err
@@ -666,6 +925,19 @@ func (p *Parser) parseStatement() (ast.AST, error) {
 			Body: body,
 		}, nil
 
+	case TSymSwitch:
+		return p.parseSwitch(tStmt)
+
+	case TSymBreak:
+		return &ast.Break{
+			Loc: tStmt.From,
+		}, nil
+
+	case TSymContinue:
+		return &ast.Continue{
+			Loc: tStmt.From,
+		}, nil
+
 	default:
 		p.lexer.Unget(tStmt)
 		lvalues, err := p.parseExprList()
@@ -773,6 +1045,29 @@ func (p *Parser) parseExprList() ([]ast.AST, error) {
 	return list, nil
 }
 
+// parseControlExpr parses the expression of a control clause. The
+// composite literals are not allowed in control clauses since the
+// opening brace of the literal would be ambiguous with the opening
+// brace of the statement block.
+func (p *Parser) parseControlExpr() (ast.AST, error) {
+	noCompositeLit := p.noCompositeLit
+	p.noCompositeLit = true
+	expr, err := p.parseExpr()
+	p.noCompositeLit = noCompositeLit
+	return expr, err
+}
+
+// parseNestedExpr parses an expression which is enclosed in
+// parentheses, brackets, or braces. Composite literals are always
+// allowed in nested expressions.
+func (p *Parser) parseNestedExpr() (ast.AST, error) {
+	noCompositeLit := p.noCompositeLit
+	p.noCompositeLit = false
+	expr, err := p.parseExpr()
+	p.noCompositeLit = noCompositeLit
+	return expr, err
+}
+
 func (p *Parser) parseExpr() (ast.AST, error) {
 	// Precedence Operator
 	// -----------------------------
@@ -962,7 +1257,15 @@ func (p *Parser) parseExprPrimary() (ast.AST, error) {
 		switch t.Type {
 		case TDot:
 			// Selector.
-			return nil, fmt.Errorf("Selector not implemented yet")
+			id, err := p.needToken(TIdentifier)
+			if err != nil {
+				return nil, err
+			}
+			primary = &ast.Selector{
+				Loc:  primary.Location(),
+				Expr: primary,
+				Name: id.StrVal,
+			}
 
 		case TLBracket:
 			var expr1, expr2 ast.AST
@@ -973,14 +1276,25 @@ func (p *Parser) parseExprPrimary() (ast.AST, error) {
 			}
 			if n.Type != TColon {
 				p.lexer.Unget(n)
-				expr1, err = p.parseExpr()
+				expr1, err = p.parseNestedExpr()
 				if err != nil {
 					return nil, err
 				}
-				_, err = p.needToken(TColon)
+				n, err = p.lexer.Get()
 				if err != nil {
 					return nil, err
 				}
+				if n.Type == TRBracket {
+					primary = &ast.Index{
+						Loc:   primary.Location(),
+						Expr:  primary,
+						Index: expr1,
+					}
+					continue
+				}
+				if n.Type != TColon {
+					return nil, p.errUnexpected(n, TColon)
+				}
 			}
 			n, err = p.lexer.Get()
 			if err != nil {
@@ -988,7 +1302,7 @@ func (p *Parser) parseExprPrimary() (ast.AST, error) {
 			}
 			if n.Type != TRBracket {
 				p.lexer.Unget(n)
-				expr2, err = p.parseExpr()
+				expr2, err = p.parseNestedExpr()
 				if err != nil {
 					return nil, err
 				}
@@ -997,43 +1311,61 @@ func (p *Parser) parseExprPrimary() (ast.AST, error) {
 					return nil, err
 				}
 			}
-			return &ast.Slice{
+			primary = &ast.Slice{
 				Loc:  primary.Location(),
 				Expr: primary,
 				From: expr1,
 				To:   expr2,
-			}, nil
+			}
 
 		case TLParen:
 			// Arguments.
 			var arguments []ast.AST
-			for {
-				expr, err := p.parseExpr()
+			n, err := p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			if n.Type != TRParen {
+				p.lexer.Unget(n)
+			}
+			for n.Type != TRParen {
+				expr, err := p.parseNestedExpr()
 				if err != nil {
 					return nil, err
 				}
 				arguments = append(arguments, expr)
 
-				n, err := p.lexer.Get()
+				n, err = p.lexer.Get()
 				if err != nil {
 					return nil, err
 				}
-				if n.Type == TRParen {
-					break
-				} else if n.Type != TComma {
+				if n.Type != TRParen && n.Type != TComma {
 					return nil, p.errf(n.From, "unexpected token %s", n)
 				}
 			}
-			vr, ok := primary.(*ast.VariableRef)
-			if !ok {
+			switch fn := primary.(type) {
+			case *ast.VariableRef:
+				primary = &ast.Call{
+					Loc:   primary.Location(),
+					Name:  fn.Name,
+					Exprs: arguments,
+				}
+
+			case *ast.Selector:
+				// Method call.
+				primary = &ast.Call{
+					Loc:  primary.Location(),
+					Recv: fn.Expr,
+					Name: ast.Identifier{
+						Name: fn.Name,
+					},
+					Exprs: arguments,
+				}
+
+			default:
 				return nil, p.errf(primary.Location(),
 					"non-function %s used as function", primary)
 			}
-			return &ast.Call{
-				Loc:   primary.Location(),
-				Name:  vr.Name,
-				Exprs: arguments,
-			}, nil
 
 		default:
 			p.lexer.Unget(t)
@@ -1042,7 +1374,8 @@ func (p *Parser) parseExprPrimary() (ast.AST, error) {
 	}
 }
 
-// Operand     = Literal | OperandName | "(" Expression ")" .
+// Operand     = Literal | OperandName | Conversion | "(" Expression ")" .
+// Conversion  = ArrayType "(" Expression ")" .
 // Literal     = BasicLit | CompositeLit | FunctionLit .
 // BasicLit    = int_lit | float_lit | imaginary_lit | rune_lit | string_lit .
 // OperandName = identifier | QualifiedIdent .
@@ -1066,31 +1399,41 @@ func (p *Parser) parseOperand() (ast.AST, error) {
 		if err != nil {
 			return nil, err
 		}
+		var name ast.Identifier
 		if n.Type == TDot {
 			id, err := p.needToken(TIdentifier)
 			if err != nil {
 				return nil, err
 			}
 			// QualifiedIdent.
-			return &ast.VariableRef{
-				Loc: t.From,
-				Name: ast.Identifier{
-					Package: t.StrVal,
-					Name:    id.StrVal,
-				},
-			}, nil
+			name = ast.Identifier{
+				Package: t.StrVal,
+				Name:    id.StrVal,
+			}
+		} else {
+			// Identifier in current package.
+			p.lexer.Unget(n)
+			name = ast.Identifier{
+				Name: t.StrVal,
+			}
+		}
+		if !p.noCompositeLit {
+			n, err = p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			if n.Type == TLBrace {
+				return p.parseCompositeLit(t.From, name)
+			}
+			p.lexer.Unget(n)
 		}
-		// Identifier in current package.
-		p.lexer.Unget(n)
 		return &ast.VariableRef{
-			Loc: t.From,
-			Name: ast.Identifier{
-				Name: t.StrVal,
-			},
+			Loc:  t.From,
+			Name: name,
 		}, nil
 
 	case TLParen: // '(' Expression ')'
-		expr, err := p.parseExpr()
+		expr, err := p.parseNestedExpr()
 		if err != nil {
 			return nil, err
 		}
@@ -1100,6 +1443,30 @@ func (p *Parser) parseOperand() (ast.AST, error) {
 		}
 		return expr, nil
 
+	case TLBracket: // Conversion
+		p.lexer.Unget(t)
+		typeInfo, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.needToken(TLParen)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := p.parseNestedExpr()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.needToken(TRParen)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Conversion{
+			Loc:  t.From,
+			Type: typeInfo,
+			Expr: expr,
+		}, nil
+
 	default:
 		p.lexer.Unget(t)
 		return nil, p.errf(t.From,
@@ -1107,6 +1474,72 @@ func (p *Parser) parseOperand() (ast.AST, error) {
 	}
 }
 
+// CompositeLit  = LiteralType LiteralValue .
+// LiteralValue  = "{" [ ElementList [ "," ] ] "}" .
+// ElementList   = KeyedElement { "," KeyedElement } .
+// KeyedElement  = [ Key ":" ] Element .
+// Key           = FieldName .
+// Element       = Expression .
+
+func (p *Parser) parseCompositeLit(loc utils.Point, name ast.Identifier) (
+	ast.AST, error) {
+
+	result := &ast.CompositeLit{
+		Loc: loc,
+		Type: &ast.TypeInfo{
+			Type: ast.TypeName,
+			Name: name,
+		},
+	}
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == TRBrace {
+			return result, nil
+		}
+		p.lexer.Unget(t)
+
+		var key string
+		element, err := p.parseNestedExpr()
+		if err != nil {
+			return nil, err
+		}
+		t, err = p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == TColon {
+			ref, ok := element.(*ast.VariableRef)
+			if !ok || len(ref.Name.Package) > 0 {
+				return nil, p.errf(element.Location(),
+					"invalid field name %s in struct literal", element)
+			}
+			key = ref.Name.Name
+			element, err = p.parseNestedExpr()
+			if err != nil {
+				return nil, err
+			}
+			t, err = p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Value = append(result.Value, ast.KeyedElement{
+			Key:     key,
+			Element: element,
+		})
+		switch t.Type {
+		case TComma:
+		case TRBrace:
+			return result, nil
+		default:
+			return nil, p.errUnexpected(t, TRBrace)
+		}
+	}
+}
+
 // Type      = TypeName | TypeLit | "(" Type ")" .
 // TypeName  = identifier | QualifiedIdent .
 // TypeLit   = ArrayType | StructType | SliceType .
@@ -9,6 +9,7 @@ package compiler
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -127,3 +128,46 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+var parserErrorTests = []struct {
+	src    string
+	errors int
+}{
+	{
+		src: `
+package main
+func f(a int32 int32) {}
+func g(a int32) {
+  return a +
+}
+func main() {}
+`,
+		errors: 2,
+	},
+	{
+		src: `
+package main
+func main(a int32) int32 {
+  return a
+}
+func f(a int32 int32) {}
+`,
+		errors: 1,
+	},
+}
+
+func TestParserErrors(t *testing.T) {
+	for idx, test := range parserErrorTests {
+		logger := utils.NewLogger(ioutil.Discard)
+		parser := NewParser(fmt.Sprintf("{test %d}", idx), nil, logger,
+			bytes.NewReader([]byte(test.src)))
+		_, err := parser.Parse(nil)
+		if err == nil {
+			t.Fatalf("Parse test %d succeeded", idx)
+		}
+		if logger.Errors() != test.errors {
+			t.Errorf("Parse test %d: got %d errors, expected %d",
+				idx, logger.Errors(), test.errors)
+		}
+	}
+}
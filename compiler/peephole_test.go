@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var peepholeRuleFiles = map[string]string{
+	"sound.rules": `
+# (x & y) & y = x & y
+rule band-band
+	band V1 V2 V3
+	band V3 V2 V4
+=>
+	band V1 V2 V4
+`,
+	"literal.rules": `
+rule mult-two
+	umult V1 $2 V2
+=>
+	lshift V1 $1 V2
+`,
+	"unsound.rules": `
+rule band-bor
+	band V1 V2 V3
+=>
+	bor V1 V2 V3
+`,
+}
+
+var peepholeTests = []struct {
+	source string
+	bands  int
+}{
+	{
+		source: `
+package main
+func main(a, b uint32) uint32 {
+	return (a & b) & b
+}
+`,
+		bands: 1,
+	},
+	{
+		// The intermediate result is live after the pattern.
+		source: `
+package main
+func main(a, b uint32) (uint32, uint32) {
+	x := a & b
+	return x & b, x
+}
+`,
+		bands: 2,
+	},
+}
+
+func TestPeepholeRules(t *testing.T) {
+	dir := writeModuleFiles(t, peepholeRuleFiles)
+	defer os.RemoveAll(dir)
+
+	for idx, test := range peepholeTests {
+		params := &utils.Params{
+			PeepholeRules:       []string{path.Join(dir, "sound.rules")},
+			VerifyPeepholeRules: true,
+		}
+		program, _, err := NewCompiler(params).CompileSSA(test.source)
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+		var bands int
+		for _, step := range program.Steps {
+			if step.Instr.Op == ssa.Band {
+				bands++
+			}
+		}
+		if bands != test.bands {
+			t.Errorf("test %d: got %d band instructions, expected %d",
+				idx, bands, test.bands)
+		}
+		ref, _, err := NewCompiler(&utils.Params{}).CompileSSA(test.source)
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+		inputs := []*big.Int{big.NewInt(0x5a5a), big.NewInt(0x0ff0)}
+		expected, err := ref.Run(inputs, nil)
+		if err != nil {
+			t.Fatalf("test %d: run failed: %s", idx, err)
+		}
+		results, err := program.Run(inputs, nil)
+		if err != nil {
+			t.Fatalf("test %d: run failed: %s", idx, err)
+		}
+		for j := range expected {
+			if results[j].Cmp(expected[j]) != 0 {
+				t.Errorf("test %d: result %d: got %v, expected %v",
+					idx, j, results[j], expected[j])
+			}
+		}
+	}
+
+	params := &utils.Params{
+		PeepholeRules:       []string{path.Join(dir, "unsound.rules")},
+		VerifyPeepholeRules: true,
+	}
+	_, _, err := NewCompiler(params).CompileSSA(peepholeTests[0].source)
+	if err == nil || !strings.Contains(err.Error(), "rule band-bor") {
+		t.Errorf("unsound rule not detected: %v", err)
+	}
+}
+
+func TestPeepholeLiterals(t *testing.T) {
+	dir := writeModuleFiles(t, peepholeRuleFiles)
+	defer os.RemoveAll(dir)
+
+	params := &utils.Params{
+		PeepholeRules:       []string{path.Join(dir, "literal.rules")},
+		VerifyPeepholeRules: true,
+	}
+	program, _, err := NewCompiler(params).CompileSSA(`
+package main
+func main(a, b uint32) uint32 {
+	return a*2 + b
+}
+`)
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	var lshifts int
+	for _, step := range program.Steps {
+		switch step.Instr.Op {
+		case ssa.Umult:
+			t.Errorf("rule not applied: %s", step.Instr)
+		case ssa.Lshift:
+			lshifts++
+		}
+	}
+	if lshifts != 1 {
+		t.Errorf("got %d lshift instructions, expected 1", lshifts)
+	}
+	circ, err := program.CompileCircuit(params)
+	if err != nil {
+		t.Fatalf("circuit compilation failed: %s", err)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(21), big.NewInt(3)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Int64() != 45 {
+		t.Errorf("unexpected result: %v", results)
+	}
+}
@@ -165,6 +165,11 @@ func (phi *Select) Equal(other BindingValue) bool {
 	if !ok {
 		return false
 	}
+	if phi == o {
+		// Bindings, not modified in branches, share their select
+		// values. This check avoids traversing the nested selects.
+		return true
+	}
 	if !phi.Cond.Equal(&o.Cond) {
 		return false
 	}
@@ -26,6 +26,7 @@ type Block struct {
 	Bindings   Bindings
 	Dead       bool
 	Processed  bool
+	gen        *Generator
 }
 
 func (b *Block) String() string {
@@ -69,6 +70,9 @@ func (b *Block) addFrom(o *Block) {
 
 // AddInstr adds an instruction to this basic block.
 func (b *Block) AddInstr(instr Instr) {
+	if instr.Loc == nil && b.gen != nil {
+		instr.Loc = b.gen.Loc
+	}
 	b.Instr = append(b.Instr, instr)
 }
 
@@ -78,12 +82,40 @@ func (b *Block) AddInstr(instr Instr) {
 // resolve the variable's value after this basic block.
 func (b *Block) ReturnBinding(name string, retBlock *Block, gen *Generator) (
 	v Variable, ok bool) {
+	return b.returnBinding(name, retBlock, gen, make(map[*Block]*Variable))
+}
+
+// returnBinding implements ReturnBinding. The branches of the block
+// join back to common successors so the resolved bindings are cached
+// in seen. Without the cache, the sequential branches would be
+// traversed an exponential number of times.
+func (b *Block) returnBinding(name string, retBlock *Block, gen *Generator,
+	seen map[*Block]*Variable) (v Variable, ok bool) {
+
+	cached, ok := seen[b]
+	if ok {
+		if cached == nil {
+			return v, false
+		}
+		return *cached, true
+	}
+	v, ok = b.resolveReturnBinding(name, retBlock, gen, seen)
+	if ok {
+		seen[b] = &v
+	} else {
+		seen[b] = nil
+	}
+	return v, ok
+}
+
+func (b *Block) resolveReturnBinding(name string, retBlock *Block,
+	gen *Generator, seen map[*Block]*Variable) (v Variable, ok bool) {
 
 	// XXX Check if the if-ssagen could omit branch in this case?
 	if b.Branch == nil || b.Next == b.Branch {
 		// Sequential block, return latest value
 		if b.Next != nil {
-			v, ok = b.Next.ReturnBinding(name, retBlock, gen)
+			v, ok = b.Next.returnBinding(name, retBlock, gen, seen)
 			if ok {
 				return v, true
 			}
@@ -95,11 +127,11 @@ func (b *Block) ReturnBinding(name string, retBlock *Block, gen *Generator) (
 		}
 		return bind.Value(retBlock, gen), true
 	}
-	vTrue, ok := b.Branch.ReturnBinding(name, retBlock, gen)
+	vTrue, ok := b.Branch.returnBinding(name, retBlock, gen, seen)
 	if !ok {
 		return v, false
 	}
-	vFalse, ok := b.Next.ReturnBinding(name, retBlock, gen)
+	vFalse, ok := b.Next.returnBinding(name, retBlock, gen, seen)
 	if !ok {
 		return v, false
 	}
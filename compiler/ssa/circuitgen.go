@@ -8,6 +8,8 @@ package ssa
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/circuits"
@@ -40,6 +42,18 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 	if params.Verbose {
 		fmt.Printf("Compiling circuit...\n")
 	}
+	if params.OptSimplifyGates {
+		simplified := cc.Simplify()
+		if params.Verbose {
+			fmt.Printf(" - Simplified %d gates\n", simplified)
+		}
+	}
+	if params.OptDedupGates {
+		deduped := cc.Dedup()
+		if params.Verbose {
+			fmt.Printf(" - Deduplicated %d gates\n", deduped)
+		}
+	}
 	if params.OptPruneGates {
 		pruned := cc.Prune()
 		if params.Verbose {
@@ -66,6 +80,17 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 	if params.CircDotOut != nil {
 		circ.Dot(params.CircDotOut)
 	}
+	if params.ProfOut != nil || params.PprofOut != nil {
+		prof := cc.Profile()
+		if params.ProfOut != nil {
+			prof.Print(params.ProfOut)
+		}
+		if params.PprofOut != nil {
+			if err := prof.WritePprof(params.PprofOut); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	return circ, nil
 }
@@ -73,8 +98,12 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 // Circuit creates the boolean circuits for the program steps.
 func (prog *Program) Circuit(cc *circuits.Compiler) error {
 
+	defer func() {
+		cc.Loc = nil
+	}()
 	for _, step := range prog.Steps {
 		instr := step.Instr
+		cc.Loc = instr.Loc
 		var wires [][]*circuits.Wire
 		for _, in := range instr.In {
 			w, err := prog.Wires(in.String(), in.Type.Bits)
@@ -109,6 +138,19 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 			if err != nil {
 				return err
 			}
+			if cc.Params.OptStrengthReduce {
+				idx, c, err := constMultiplier(cc, instr, wires, o)
+				if err != nil {
+					return err
+				}
+				if c != nil {
+					err = circuits.NewConstMultiplier(cc, wires[1-idx], c, o)
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
 			err = circuits.NewMultiplier(cc, cc.Params.CircMultArrayTreshold,
 				wires[0], wires[1], o)
 			if err != nil {
@@ -120,6 +162,19 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 			if err != nil {
 				return err
 			}
+			if cc.Params.OptStrengthReduce {
+				d, err := constDivider(cc, instr, wires, o, true)
+				if err != nil {
+					return err
+				}
+				if d != nil {
+					err = circuits.NewConstDivider(cc, wires[0], d, o, nil)
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
 
 			err = circuits.NewDivider(cc, wires[0], wires[1], o, nil)
 			if err != nil {
@@ -131,37 +186,52 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 			if err != nil {
 				return err
 			}
+			if cc.Params.OptStrengthReduce {
+				d, err := constDivider(cc, instr, wires, o, false)
+				if err != nil {
+					return err
+				}
+				if d != nil {
+					err = circuits.NewConstDivider(cc, wires[0], d, nil, o)
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
 
 			err = circuits.NewDivider(cc, wires[0], wires[1], nil, o)
 			if err != nil {
 				return err
 			}
 
-		case Slice:
-			if !instr.In[1].Const {
-				return fmt.Errorf("%s only constant index supported", instr.Op)
-			}
-			var from int
-			switch val := instr.In[1].ConstValue.(type) {
-			case int32:
-				from = int(val)
-			default:
-				return fmt.Errorf("%s unsupported index type %T", instr.Op, val)
+		case Lshift, Rshift, Srshift, Rotl, Rotr:
+			if instr.In[1].Const {
+				count, err := constCount(instr.In[1])
+				if err != nil {
+					return fmt.Errorf("%s %s", instr.Op, err)
+				}
+				o := constShift(cc, instr.Op, wires[0], instr.Out.Type.Bits,
+					count)
+				err = prog.SetWires(instr.Out.String(), o)
+				if err != nil {
+					return err
+				}
+				break
 			}
-
-			if !instr.In[2].Const {
-				return fmt.Errorf("%s only constant index supported", instr.Op)
+			o, err := prog.Wires(instr.Out.String(), instr.Out.Type.Bits)
+			if err != nil {
+				return err
 			}
-			var to int
-			switch val := instr.In[2].ConstValue.(type) {
-			case int32:
-				to = int(val)
-			default:
-				return fmt.Errorf("%s unsupported index type %T", instr.Op, val)
+			err = shifters[instr.Op](cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
 			}
-			if from >= to {
-				return fmt.Errorf("%s bounds out of range [%d:%d]",
-					instr.Op, from, to)
+
+		case Slice:
+			from, to, err := constBounds(instr.Op, instr.In[1], instr.In[2])
+			if err != nil {
+				return err
 			}
 			o := make([]*circuits.Wire, instr.Out.Type.Bits)
 
@@ -174,7 +244,33 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 				}
 				o[bit-from] = w
 			}
-			err := prog.SetWires(instr.Out.String(), o)
+			err = prog.SetWires(instr.Out.String(), o)
+			if err != nil {
+				return err
+			}
+
+		case Amov:
+			from, to, err := constBounds(instr.Op, instr.In[2], instr.In[3])
+			if err != nil {
+				return err
+			}
+			o := make([]*circuits.Wire, instr.Out.Type.Bits)
+			for bit := 0; bit < len(o); bit++ {
+				var w *circuits.Wire
+				if bit >= from && bit < to {
+					if bit-from < len(wires[0]) {
+						w = wires[0][bit-from]
+					} else {
+						w = cc.ZeroWire()
+					}
+				} else if bit < len(wires[1]) {
+					w = wires[1][bit]
+				} else {
+					w = cc.ZeroWire()
+				}
+				o[bit] = w
+			}
+			err = prog.SetWires(instr.Out.String(), o)
 			if err != nil {
 				return err
 			}
@@ -461,3 +557,162 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 
 	return nil
 }
+
+var shifters = map[Operand]NewBinary{
+	Lshift:  circuits.NewLeftShifter,
+	Rshift:  circuits.NewRightShifter,
+	Srshift: circuits.NewArithRightShifter,
+	Rotl:    circuits.NewRotateLeft,
+	Rotr:    circuits.NewRotateRight,
+}
+
+// constMultiplier returns the index and the value of the constant
+// operand of the multiplication instruction if the multiplication is
+// cheaper to compute with the constant multiplier. The function
+// returns nil constant if neither of the operands is constant or if
+// the generic multiplier is cheaper.
+func constMultiplier(cc *circuits.Compiler, instr Instr,
+	in [][]*circuits.Wire, out []*circuits.Wire) (int, *big.Int, error) {
+
+	for idx := 1; idx >= 0; idx-- {
+		c, ok := constInt(instr.In[idx])
+		if !ok {
+			continue
+		}
+		cheaper, err := cc.ConstMultiplierCheaper(len(in[1-idx]),
+			len(in[idx]), len(out), c)
+		if err != nil || !cheaper {
+			return 0, nil, err
+		}
+		return idx, c, nil
+	}
+	return 0, nil, nil
+}
+
+// constDivider returns the positive constant divisor of the division
+// or modulo instruction if the operation is cheaper to compute with
+// the constant divider. The function returns nil divisor if the
+// divisor is not a positive constant or if the generic divider is
+// cheaper.
+func constDivider(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
+	out []*circuits.Wire, quotient bool) (*big.Int, error) {
+
+	d, ok := constInt(instr.In[1])
+	if !ok || d.Sign() <= 0 {
+		return nil, nil
+	}
+	cheaper, err := cc.ConstDividerCheaper(len(in[0]), len(in[1]), len(out),
+		d, quotient)
+	if err != nil || !cheaper {
+		return nil, err
+	}
+	return d, nil
+}
+
+// constInt returns the value of the constant v as it is represented
+// in the constant's wires.
+func constInt(v Variable) (*big.Int, bool) {
+	if !v.Const || v.TypeRef {
+		return nil, false
+	}
+	val, err := lookup(nil, v)
+	if err != nil {
+		return nil, false
+	}
+	return val.v, true
+}
+
+// constCount returns the value of the constant shift count v. Counts
+// that do not fit into int are clamped to math.MaxInt32 since they
+// shift all bits out of any value.
+func constCount(v Variable) (int, error) {
+	switch val := v.ConstValue.(type) {
+	case int32:
+		if val < 0 {
+			return 0, fmt.Errorf("negative shift count %d", val)
+		}
+		return int(val), nil
+	case uint64:
+		if val > math.MaxInt32 {
+			return math.MaxInt32, nil
+		}
+		return int(val), nil
+	case *big.Int:
+		if val.Sign() < 0 {
+			return 0, fmt.Errorf("negative shift count %s", val)
+		}
+		if !val.IsInt64() || val.Int64() > math.MaxInt32 {
+			return math.MaxInt32, nil
+		}
+		return int(val.Int64()), nil
+	default:
+		return 0, fmt.Errorf("unsupported shift count type %T", val)
+	}
+}
+
+// constBounds returns the constant slice bounds from and to.
+func constBounds(op Operand, from, to Variable) (int, int, error) {
+	var bounds [2]int
+	for idx, v := range []Variable{from, to} {
+		if !v.Const {
+			return 0, 0, fmt.Errorf("%s only constant index supported", op)
+		}
+		switch val := v.ConstValue.(type) {
+		case int32:
+			bounds[idx] = int(val)
+		default:
+			return 0, 0, fmt.Errorf("%s unsupported index type %T", op, val)
+		}
+	}
+	if bounds[0] >= bounds[1] {
+		return 0, 0, fmt.Errorf("%s bounds out of range [%d:%d]",
+			op, bounds[0], bounds[1])
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// constShift returns the result wires for shifting or rotating the
+// wires w by the constant count. The operation does not create any
+// gates.
+func constShift(cc *circuits.Compiler, op Operand, w []*circuits.Wire,
+	bits, count int) []*circuits.Wire {
+
+	x := make([]*circuits.Wire, bits)
+	for i := 0; i < bits; i++ {
+		if i < len(w) {
+			x[i] = w[i]
+		} else if op == Srshift && len(w) > 0 {
+			x[i] = w[len(w)-1]
+		} else {
+			x[i] = cc.ZeroWire()
+		}
+	}
+
+	switch op {
+	case Lshift:
+		if count > bits {
+			count = bits
+		}
+		return cc.ShiftLeft(x, bits, count)
+
+	case Rshift:
+		return cc.ShiftRight(x, bits, count, cc.ZeroWire())
+
+	case Srshift:
+		return cc.ShiftRight(x, bits, count, x[bits-1])
+
+	case Rotl, Rotr:
+		result := make([]*circuits.Wire, bits)
+		count %= bits
+		if op == Rotr {
+			count = (bits - count) % bits
+		}
+		for i := 0; i < bits; i++ {
+			result[(i+count)%bits] = x[i]
+		}
+		return result
+
+	default:
+		panic(fmt.Sprintf("constShift: invalid operand %s", op))
+	}
+}
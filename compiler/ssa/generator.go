@@ -19,7 +19,11 @@ const (
 
 // Generator implements code generator.
 type Generator struct {
-	Params    *utils.Params
+	Params *utils.Params
+	// Loc is the source location of the code being generated. The
+	// location is recorded into all instructions added to the blocks
+	// of this generator.
+	Loc       *utils.Location
 	versions  map[string]Variable
 	blockID   int
 	constants map[string]ConstantInst
@@ -135,7 +139,8 @@ func fmtKey(name string, scope int) string {
 // Block creates a new basic block.
 func (gen *Generator) Block() *Block {
 	block := &Block{
-		ID: fmt.Sprintf("l%d", gen.blockID),
+		ID:  fmt.Sprintf("l%d", gen.blockID),
+		gen: gen,
 	}
 	gen.blockID++
 
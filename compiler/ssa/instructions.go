@@ -14,6 +14,7 @@ import (
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/circuits"
 	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
 )
 
 // Operand specifies SSA assembly operand
@@ -44,7 +45,11 @@ const (
 	Fmod
 	Lshift
 	Rshift
+	Srshift
+	Rotl
+	Rotr
 	Slice
+	Amov
 	Ilt
 	Ult
 	Flt
@@ -93,7 +98,11 @@ var operands = map[Operand]string{
 	Fmod:    "fmod",
 	Lshift:  "lshift",
 	Rshift:  "rshift",
+	Srshift: "srshift",
+	Rotl:    "rotl",
+	Rotr:    "rotr",
 	Slice:   "slice",
+	Amov:    "amov",
 	Ilt:     "ilt",
 	Ult:     "ult",
 	Flt:     "flt",
@@ -146,6 +155,7 @@ type Instr struct {
 	Builtin circuits.Builtin
 	GC      string
 	Ret     []Variable
+	Loc     *utils.Location
 }
 
 // NewAddInstr creates a new addition instruction based on the type t.
@@ -260,10 +270,39 @@ func NewLshiftInstr(l, r, o Variable) Instr {
 	}
 }
 
-// NewRshiftInstr creates a new Rshift instruction.
-func NewRshiftInstr(l, r, o Variable) Instr {
+// NewRshiftInstr creates a new right shift instruction based on the
+// type t. Signed values are shifted arithmetically and unsigned
+// values logically.
+func NewRshiftInstr(t types.Info, l, r, o Variable) (Instr, error) {
+	var op Operand
+	switch t.Type {
+	case types.Int:
+		op = Srshift
+	case types.Uint, types.Undefined:
+		op = Rshift
+	default:
+		return Instr{}, fmt.Errorf("Invalid type %s for right shift", t)
+	}
+	return Instr{
+		Op:  op,
+		In:  []Variable{l, r},
+		Out: &o,
+	}, nil
+}
+
+// NewRotlInstr creates a new rotate left instruction.
+func NewRotlInstr(l, r, o Variable) Instr {
 	return Instr{
-		Op:  Rshift,
+		Op:  Rotl,
+		In:  []Variable{l, r},
+		Out: &o,
+	}
+}
+
+// NewRotrInstr creates a new rotate right instruction.
+func NewRotrInstr(l, r, o Variable) Instr {
+	return Instr{
+		Op:  Rotr,
 		In:  []Variable{l, r},
 		Out: &o,
 	}
@@ -278,6 +317,17 @@ func NewSliceInstr(v, from, to, o Variable) Instr {
 	}
 }
 
+// NewAmovInstr creates a new Amov instruction. The instruction
+// assigns the value v into the bits [from:to] of arr. The result o
+// contains the updated value and other bits from arr.
+func NewAmovInstr(v, arr, from, to, o Variable) Instr {
+	return Instr{
+		Op:  Amov,
+		In:  []Variable{v, arr, from, to},
+		Out: &o,
+	}
+}
+
 // NewLtInstr creates a new less-than instruction based on the type t.
 func NewLtInstr(t types.Info, l, r, o Variable) (Instr, error) {
 	var op Operand
@@ -618,6 +668,9 @@ func (v *Variable) Bit(bit int) bool {
 		}
 		return bytes[idx]&(1<<mod) != 0
 
+	case CompoundValue:
+		return val.Value.Bit(bit) != 0
+
 	default:
 		panic(fmt.Sprintf("Variable.Bit called for non const %v (%T)", v, val))
 	}
@@ -644,6 +697,14 @@ func (v Variable) TypeCompatible(o Variable) bool {
 	return v.Type.Equal(o.Type)
 }
 
+// CompoundValue implements constant values of struct and array
+// types. The value holds the bits of the constant in the same layout
+// as the wires of the type.
+type CompoundValue struct {
+	Type  types.Info
+	Value *big.Int
+}
+
 // Constant creates a constant variable for the argument value.
 func Constant(value interface{}) (Variable, error) {
 	v := Variable{
@@ -737,6 +798,11 @@ func Constant(value interface{}) (Variable, error) {
 		v.Type = val
 		v.TypeRef = true
 
+	case CompoundValue:
+		v.Name = fmt.Sprintf("$%s{0x%s}", val.Type, val.Value.Text(16))
+		v.Type = val.Type
+		v.Type.MinBits = val.Type.Bits
+
 	default:
 		return v, fmt.Errorf("Constant: %v (%T) not implemented yet", val, val)
 	}
@@ -0,0 +1,467 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/circuits"
+)
+
+// value implements an interpreter value. The value holds the bits of
+// a variable as an unsigned integer so that the signed values are in
+// two's complement form.
+type value struct {
+	bits int
+	v    *big.Int
+}
+
+func (v value) String() string {
+	return fmt.Sprintf("%s/%d", v.v.Text(16), v.bits)
+}
+
+// bit returns the value of the bit i of the value. The bits beyond
+// the value's size are zero.
+func (v value) bit(i int) uint {
+	if i >= v.bits {
+		return 0
+	}
+	return v.v.Bit(i)
+}
+
+// extend returns the value extended or truncated to the size
+// bits. The value is extended with the bit fill.
+func (v value) extend(bits int, fill uint) *big.Int {
+	r := new(big.Int).Set(v.v)
+	if fill != 0 && bits > v.bits {
+		ones := mask(bits)
+		ones.Xor(ones, mask(v.bits))
+		r.Or(r, ones)
+	}
+	return r.And(r, mask(bits))
+}
+
+func mask(bits int) *big.Int {
+	m := big.NewInt(1)
+	m.Lsh(m, uint(bits))
+	return m.Sub(m, big.NewInt(1))
+}
+
+func newValue(bits int, v *big.Int) value {
+	return value{
+		bits: bits,
+		v:    v.And(v, mask(bits)),
+	}
+}
+
+// Run executes the program on plaintext values. The inputs are given
+// with the same convention as for circuit.Circuit.Compute: each
+// program input, or the fields of compound inputs, take one input
+// value. The function returns the program outputs. If the trace
+// writer is not nil, the function prints all executed instructions
+// with their input and output values to the writer.
+//
+// The interpreter follows exactly the semantics of the generated
+// circuits. The values are handled as bit vectors, the operands of
+// different sizes are zero-extended, and the results are truncated to
+// the size of the result variable. Since the interpreter does not
+// create any circuits, it can be used for debugging programs and as
+// a reference for the compiled circuits.
+func (prog *Program) Run(inputs []*big.Int, trace io.Writer) (
+	[]*big.Int, error) {
+
+	env := make(map[string]value)
+
+	// Inputs.
+	var count int
+	for _, arg := range prog.Inputs {
+		if len(arg.Compound) > 0 {
+			count += len(arg.Compound)
+		} else {
+			count++
+		}
+	}
+	if len(inputs) != count {
+		return nil, fmt.Errorf("invalid inputs: got %d, expected %d",
+			len(inputs), count)
+	}
+	var idx int
+	for i, arg := range prog.Inputs {
+		v := new(big.Int)
+		if len(arg.Compound) > 0 {
+			var offset int
+			for _, c := range arg.Compound {
+				f := new(big.Int).And(inputs[idx], mask(c.Size))
+				v.Or(v, f.Lsh(f, uint(offset)))
+				offset += c.Size
+				idx++
+			}
+		} else {
+			v.Set(inputs[idx])
+			idx++
+		}
+		name := arg.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("arg{%d}", i)
+		}
+		env[name] = newValue(arg.Size, v)
+	}
+
+	var result []value
+
+	for _, step := range prog.Steps {
+		instr := step.Instr
+
+		var in []value
+		for _, v := range instr.In {
+			val, err := lookup(env, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", instr, err)
+			}
+			in = append(in, val)
+		}
+		if trace != nil {
+			fmt.Fprintf(trace, "\t%s\n", instr)
+			for i, v := range instr.In {
+				fmt.Fprintf(trace, "\t\t%s : %s\n", v, in[i])
+			}
+		}
+		var bits int
+		if instr.Out != nil {
+			bits = instr.Out.Type.Bits
+		}
+		var out *big.Int
+
+		switch instr.Op {
+		case Ret:
+			result = in
+
+		case Circ:
+			var args []*big.Int
+			for i, io := range instr.Circ.Inputs {
+				args = append(args, in[i].extend(io.Size, 0))
+			}
+			outputs, err := instr.Circ.Compute(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", instr, err)
+			}
+			// Split circuit outputs into the return values.
+			all := new(big.Int)
+			var offset int
+			for i, io := range instr.Circ.Outputs {
+				all.Or(all, new(big.Int).Lsh(outputs[i], uint(offset)))
+				offset += io.Size
+			}
+			offset = 0
+			for _, r := range instr.Ret {
+				v := new(big.Int).Rsh(all, uint(offset))
+				env[r.String()] = newValue(r.Type.Bits, v)
+				offset += r.Type.Bits
+				if trace != nil {
+					fmt.Fprintf(trace, "\t\t%s = %s\n", r, env[r.String()])
+				}
+			}
+
+		case GC:
+			delete(env, instr.GC)
+
+		default:
+			var err error
+			out, err = prog.eval(instr, in, bits)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if instr.Out != nil && out != nil {
+			val := newValue(bits, out)
+			env[instr.Out.String()] = val
+			if trace != nil {
+				fmt.Fprintf(trace, "\t\t%s = %s\n", instr.Out, val)
+			}
+		}
+	}
+
+	// Split return values into outputs.
+	all := new(big.Int)
+	var offset int
+	for _, r := range result {
+		all.Or(all, new(big.Int).Lsh(r.v, uint(offset)))
+		offset += r.bits
+	}
+	var outputs []*big.Int
+	offset = 0
+	for _, io := range prog.Outputs {
+		v := new(big.Int).Rsh(all, uint(offset))
+		outputs = append(outputs, v.And(v, mask(io.Size)))
+		offset += io.Size
+	}
+	return outputs, nil
+}
+
+// eval evaluates the instruction instr for the input values in. The
+// argument bits specifies the size of the instruction's result.
+func (prog *Program) eval(instr Instr, in []value, bits int) (
+	*big.Int, error) {
+
+	var out *big.Int
+	var err error
+
+	switch instr.Op {
+	case Iadd, Uadd, Isub, Usub:
+		n := maxBits(in[0], in[1])
+		if bits < n {
+			return nil, fmt.Errorf("%s: invalid result size", instr)
+		}
+		if instr.Op == Iadd || instr.Op == Uadd {
+			out = new(big.Int).Add(in[0].v, in[1].v)
+		} else {
+			out = new(big.Int).Sub(in[0].v, in[1].v)
+		}
+		// The carry bit is stored only if the result has room
+		// for it.
+		if bits > n+1 {
+			out.And(out, mask(n+1))
+		}
+
+	case Imult, Umult:
+		out = new(big.Int).Mul(in[0].v, in[1].v)
+
+	case Idiv, Udiv, Imod, Umod:
+		n := maxBits(in[0], in[1])
+		q := new(big.Int)
+		r := new(big.Int)
+		if in[1].v.Sign() == 0 {
+			// The divider circuit sets all quotient bits and
+			// returns the dividend as the remainder.
+			q = mask(n)
+			r.Set(in[0].v)
+		} else {
+			q.QuoRem(in[0].v, in[1].v, r)
+		}
+		if instr.Op == Idiv || instr.Op == Udiv {
+			out = q
+		} else {
+			out = r
+		}
+
+	case Lshift, Rshift, Srshift, Rotl, Rotr:
+		out, err = shift(instr, in[0], in[1], bits)
+		if err != nil {
+			return nil, err
+		}
+
+	case Slice:
+		from, to, err := constBounds(instr.Op, instr.In[1], instr.In[2])
+		if err != nil {
+			return nil, err
+		}
+		out = new(big.Int).Rsh(in[0].v, uint(from))
+		out.And(out, mask(to-from))
+
+	case Amov:
+		from, to, err := constBounds(instr.Op, instr.In[2], instr.In[3])
+		if err != nil {
+			return nil, err
+		}
+		out = new(big.Int).AndNot(in[1].v, new(big.Int).Lsh(
+			mask(to-from), uint(from)))
+		v := new(big.Int).And(in[0].v, mask(to-from))
+		out.Or(out, v.Lsh(v, uint(from)))
+
+	case Ilt, Ult:
+		out = boolInt(in[0].v.Cmp(in[1].v) < 0)
+	case Ile, Ule:
+		out = boolInt(in[0].v.Cmp(in[1].v) <= 0)
+	case Igt, Ugt:
+		out = boolInt(in[0].v.Cmp(in[1].v) > 0)
+	case Ige, Uge:
+		out = boolInt(in[0].v.Cmp(in[1].v) >= 0)
+	case Eq:
+		out = boolInt(in[0].v.Cmp(in[1].v) == 0)
+	case Neq:
+		out = boolInt(in[0].v.Cmp(in[1].v) != 0)
+
+	case Bts, Btc:
+		index, ok := instr.In[1].ConstValue.(int32)
+		if !instr.In[1].Const || !ok {
+			return nil, fmt.Errorf("%s unsupported index %v",
+				instr.Op, instr.In[1])
+		}
+		set := in[0].bit(int(index)) != 0
+		if instr.Op == Bts {
+			out = boolInt(set)
+		} else {
+			out = boolInt(!set)
+		}
+
+	case And:
+		out = new(big.Int).And(in[0].v, in[1].v)
+	case Or:
+		out = new(big.Int).Or(in[0].v, in[1].v)
+	case Band:
+		out = new(big.Int).And(in[0].v, in[1].v)
+	case Bclr:
+		out = new(big.Int).AndNot(in[0].v, in[1].v)
+	case Bor:
+		out = new(big.Int).Or(in[0].v, in[1].v)
+	case Bxor:
+		out = new(big.Int).Xor(in[0].v, in[1].v)
+
+	case Mov:
+		out = new(big.Int).Set(in[0].v)
+
+	case Phi:
+		if in[0].bit(0) != 0 {
+			out = new(big.Int).Set(in[1].v)
+		} else {
+			out = new(big.Int).Set(in[2].v)
+		}
+
+	case Builtin:
+		out, err = builtin(prog, instr, in[0], in[1], bits)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("Program.Run: %s not implemented yet",
+			instr.Op)
+	}
+
+	return out, nil
+}
+
+// lookup returns the value of the variable v. The constant values
+// have the minimum number of bits of their values.
+func lookup(env map[string]value, v Variable) (value, error) {
+	val, ok := env[v.String()]
+	if ok {
+		return val, nil
+	}
+	if !v.Const {
+		return value{}, fmt.Errorf("variable %s not defined", v)
+	}
+	bits := v.Type.MinBits
+	result := new(big.Int)
+	for bit := 0; bit < bits; bit++ {
+		if v.Bit(bit) {
+			result.SetBit(result, bit, 1)
+		}
+	}
+	return value{
+		bits: bits,
+		v:    result,
+	}, nil
+}
+
+func maxBits(a, b value) int {
+	if a.bits > b.bits {
+		return a.bits
+	}
+	return b.bits
+}
+
+func boolInt(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+// shift implements the shift and rotate instructions. The shifted
+// value is extended to the result size before the operation.
+func shift(instr Instr, x, s value, bits int) (*big.Int, error) {
+	var count int
+	if instr.In[1].Const {
+		var err error
+		count, err = constCount(instr.In[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", instr.Op, err)
+		}
+	} else if s.v.IsInt64() && s.v.Int64() < int64(bits) {
+		count = int(s.v.Int64())
+	} else {
+		count = bits
+	}
+
+	var fill uint
+	if instr.Op == Srshift && x.bits > 0 {
+		fill = x.v.Bit(x.bits - 1)
+	}
+	v := x.extend(bits, fill)
+
+	switch instr.Op {
+	case Lshift:
+		if count > bits {
+			count = bits
+		}
+		return v.Lsh(v, uint(count)), nil
+
+	case Rshift, Srshift:
+		if count > bits {
+			count = bits
+		}
+		r := new(big.Int).Rsh(v, uint(count))
+		if fill != 0 {
+			ones := mask(bits)
+			ones.Xor(ones, mask(bits-count))
+			r.Or(r, ones)
+		}
+		return r, nil
+
+	default:
+		if !instr.In[1].Const {
+			count = int(new(big.Int).Mod(s.v, big.NewInt(int64(bits))).Int64())
+		}
+		count %= bits
+		if instr.Op == Rotr {
+			count = (bits - count) % bits
+		}
+		r := new(big.Int).Lsh(v, uint(count))
+		return r.Or(r, v.Rsh(v, uint(bits-count))), nil
+	}
+}
+
+// builtin evaluates the builtin instruction by compiling it into a
+// circuit and computing the circuit.
+func builtin(prog *Program, instr Instr, a, b value, bits int) (
+	*big.Int, error) {
+
+	aw := circuits.MakeWires(a.bits)
+	bw := circuits.MakeWires(b.bits)
+	cc, err := circuits.NewCompiler(prog.Params,
+		circuit.IO{
+			circuit.IOArg{Size: a.bits},
+			circuit.IOArg{Size: b.bits},
+		},
+		circuit.IO{
+			circuit.IOArg{Size: bits},
+		}, append(aw, bw...), nil)
+	if err != nil {
+		return nil, err
+	}
+	o := circuits.MakeWires(bits)
+	err = instr.Builtin(cc, aw, bw, o)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range o {
+		ow := circuits.NewWire()
+		cc.ID(w, ow)
+		ow.Output = true
+		cc.OutputWires = append(cc.OutputWires, ow)
+	}
+	result, err := cc.Compile().Compute([]*big.Int{a.v, b.v})
+	if err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
@@ -0,0 +1,391 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// maxOptimizeRounds limits the number of rounds the optimization
+// passes are run.
+const maxOptimizeRounds = 8
+
+// Optimize runs the SSA optimization passes enabled in the program
+// parameters. The passes operate on the program steps which are in
+// the topological order of their basic blocks. Since the circuits
+// evaluate all branches of the program, each instruction dominates
+// all instructions following it, and the passes can treat the steps
+// as one straight-line block. The passes are run until they do not
+// find anything more to optimize. Finally, the instructions are
+// narrowed to the known widths of their operands.
+func (prog *Program) Optimize() {
+	params := prog.Params
+	if !params.OptConstProp && !params.OptCopyProp && !params.OptCSE &&
+		!params.OptDCE && !params.OptNarrowWidths {
+		return
+	}
+	if params.Verbose {
+		fmt.Printf("Optimizing SSA...\n")
+	}
+
+	var folded, copies, cse, dead int
+	for round := 0; round < maxOptimizeRounds; round++ {
+		var changed int
+		if params.OptConstProp {
+			n := prog.constProp()
+			folded += n
+			changed += n
+		}
+		if params.OptCopyProp {
+			n := prog.copyProp()
+			copies += n
+			changed += n
+		}
+		if params.OptCSE {
+			n := prog.cse()
+			cse += n
+			changed += n
+		}
+		if params.OptDCE {
+			n := prog.dce()
+			dead += n
+			changed += n
+		}
+		if changed == 0 {
+			break
+		}
+	}
+	var narrowed int
+	if params.OptNarrowWidths {
+		narrowed = prog.narrowWidths()
+	}
+	prog.liveness()
+
+	if params.Verbose {
+		if params.OptConstProp {
+			fmt.Printf(" - Folded %d instructions\n", folded)
+		}
+		if params.OptCopyProp {
+			fmt.Printf(" - Propagated %d copies\n", copies)
+		}
+		if params.OptCSE {
+			fmt.Printf(" - Eliminated %d common subexpressions\n", cse)
+		}
+		if params.OptDCE {
+			fmt.Printf(" - Removed %d dead instructions\n", dead)
+		}
+		if params.OptNarrowWidths {
+			fmt.Printf(" - Narrowed %d instructions\n", narrowed)
+		}
+	}
+}
+
+// definitions counts the number of definitions of the program
+// variables. The passes rewrite only variables that are defined
+// exactly once.
+func (prog *Program) definitions() map[string]int {
+	defs := make(map[string]int)
+	for _, step := range prog.Steps {
+		if step.Instr.Out != nil {
+			defs[step.Instr.Out.String()]++
+		}
+		for _, r := range step.Instr.Ret {
+			defs[r.String()]++
+		}
+	}
+	return defs
+}
+
+// rename replaces the instruction's input variables with their
+// bindings in names. The function returns the number of replaced
+// inputs.
+func rename(instr *Instr, names map[string]Variable) int {
+	var in []Variable
+	var count int
+	for idx, v := range instr.In {
+		if v.Const {
+			continue
+		}
+		n, ok := names[v.String()]
+		if !ok {
+			continue
+		}
+		if in == nil {
+			in = make([]Variable, len(instr.In))
+			copy(in, instr.In)
+		}
+		in[idx] = n
+		count++
+	}
+	if in != nil {
+		instr.In = in
+	}
+	return count
+}
+
+// pure tests if the instruction computes its output from its inputs
+// without any other effects.
+func (instr Instr) pure() bool {
+	switch instr.Op {
+	case Ret, Circ, Builtin, GC:
+		return false
+	default:
+		return instr.Out != nil
+	}
+}
+
+// constValue returns the constant value of the variable v. The
+// values of the non-constant variables are looked up from the values
+// map.
+func constValue(values map[string]value, v Variable) (value, bool) {
+	if v.TypeRef {
+		return value{}, false
+	}
+	if v.Const {
+		val, err := lookup(nil, v)
+		return val, err == nil
+	}
+	val, ok := values[v.String()]
+	return val, ok
+}
+
+// setMov replaces the instruction with a move from the variable v.
+func setMov(instr *Instr, v Variable) {
+	*instr = Instr{
+		Op:  Mov,
+		In:  []Variable{v},
+		Out: instr.Out,
+		Loc: instr.Loc,
+	}
+}
+
+// addConstant adds a reference to the constant c.
+func (prog *Program) addConstant(c Variable) {
+	inst, ok := prog.Constants[c.Name]
+	if !ok {
+		inst = ConstantInst{
+			Const: c,
+		}
+	}
+	inst.Count++
+	prog.Constants[c.Name] = inst
+}
+
+// constant creates a constant variable for the non-negative value v
+// and adds a reference to it.
+func (prog *Program) constant(v *big.Int) (Variable, error) {
+	var c Variable
+	var err error
+	if v.IsUint64() {
+		c, err = Constant(v.Uint64())
+	} else {
+		c, err = Constant(new(big.Int).Set(v))
+	}
+	if err != nil {
+		return c, err
+	}
+	prog.addConstant(c)
+	return c, nil
+}
+
+// constProp propagates constant values through the program and folds
+// the instructions having constant inputs into moves of constant
+// values. The phi instructions with a constant condition or with
+// identical values are replaced with moves of the selected
+// value. The function returns the number of folded instructions.
+func (prog *Program) constProp() int {
+	defs := prog.definitions()
+	values := make(map[string]value)
+	var folded int
+
+	for i := range prog.Steps {
+		instr := &prog.Steps[i].Instr
+		if !instr.pure() || defs[instr.Out.String()] != 1 {
+			continue
+		}
+		if instr.Op == Phi {
+			if cond, ok := constValue(values, instr.In[0]); ok {
+				if cond.bit(0) != 0 {
+					setMov(instr, instr.In[1])
+				} else {
+					setMov(instr, instr.In[2])
+				}
+				folded++
+			} else if instr.In[1].String() == instr.In[2].String() {
+				setMov(instr, instr.In[1])
+				folded++
+			}
+		}
+
+		var in []value
+		for _, v := range instr.In {
+			val, ok := constValue(values, v)
+			if !ok {
+				break
+			}
+			in = append(in, val)
+		}
+		if len(in) != len(instr.In) {
+			continue
+		}
+		bits := instr.Out.Type.Bits
+		out, err := prog.eval(*instr, in, bits)
+		if err != nil {
+			continue
+		}
+		val := newValue(bits, out)
+		values[instr.Out.String()] = val
+
+		if instr.Op == Mov && instr.In[0].Const {
+			// Already a constant value.
+			continue
+		}
+		c, err := prog.constant(val.v)
+		if err != nil {
+			continue
+		}
+		setMov(instr, c)
+		folded++
+	}
+	return folded
+}
+
+// copyProp replaces the uses of the move instructions' outputs with
+// the moved variables. Since the moves zero-extend and truncate their
+// values, only the moves between variables of the same size are
+// propagated. The moves are left to the dead instruction
+// elimination. The function returns the number of replaced uses.
+func (prog *Program) copyProp() int {
+	defs := prog.definitions()
+	names := make(map[string]Variable)
+	var count int
+
+	for i := range prog.Steps {
+		instr := &prog.Steps[i].Instr
+		count += rename(instr, names)
+		if instr.Op != Mov {
+			continue
+		}
+		from := instr.In[0]
+		if from.Const || from.TypeRef ||
+			from.Type.Bits != instr.Out.Type.Bits ||
+			defs[from.String()] > 1 || defs[instr.Out.String()] != 1 {
+			continue
+		}
+		names[instr.Out.String()] = from
+	}
+	return count
+}
+
+// commutative tests if the operands of the operation can be swapped.
+func (op Operand) commutative() bool {
+	switch op {
+	case Iadd, Uadd, Imult, Umult, Band, Bor, Bxor, Eq, Neq, And, Or:
+		return true
+	default:
+		return false
+	}
+}
+
+// exprKey returns the value numbering key of the instruction.
+func exprKey(instr Instr) string {
+	in := make([]string, len(instr.In))
+	for idx, v := range instr.In {
+		in[idx] = v.String()
+	}
+	if instr.Op.commutative() {
+		sort.Strings(in)
+	}
+	return fmt.Sprintf("%s %s %d", instr.Op, strings.Join(in, " "),
+		instr.Out.Type.Bits)
+}
+
+// cse eliminates the common subexpressions with value numbering. The
+// instructions computing the same operation for the same inputs are
+// replaced with moves from the first instruction's output. The
+// function returns the number of eliminated instructions.
+func (prog *Program) cse() int {
+	defs := prog.definitions()
+	names := make(map[string]Variable)
+	exprs := make(map[string]Variable)
+	var count int
+
+	for i := range prog.Steps {
+		instr := &prog.Steps[i].Instr
+		rename(instr, names)
+		if !instr.pure() || instr.Op == Mov ||
+			defs[instr.Out.String()] != 1 {
+			continue
+		}
+		key := exprKey(*instr)
+		v, ok := exprs[key]
+		if !ok {
+			exprs[key] = *instr.Out
+			continue
+		}
+		names[instr.Out.String()] = v
+		setMov(instr, v)
+		count++
+	}
+	return count
+}
+
+// dce removes the instructions whose results are not used. The
+// function returns the number of removed instructions.
+func (prog *Program) dce() int {
+	used := NewSet()
+	live := make([]bool, len(prog.Steps))
+	var count int
+
+	for i := len(prog.Steps) - 1; i >= 0; i-- {
+		instr := prog.Steps[i].Instr
+		switch instr.Op {
+		case Circ:
+			for _, r := range instr.Ret {
+				if used.Contains(r.String()) {
+					live[i] = true
+				}
+			}
+		default:
+			live[i] = instr.Out == nil || used.Contains(instr.Out.String())
+		}
+		if !live[i] {
+			count++
+			continue
+		}
+		for _, in := range instr.In {
+			if !in.Const {
+				used.Add(in.String())
+			}
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+
+	steps := prog.Steps[:0]
+	var label string
+	for i, step := range prog.Steps {
+		if !live[i] {
+			if len(label) == 0 {
+				label = step.Label
+			}
+			continue
+		}
+		if len(step.Label) == 0 {
+			step.Label = label
+		}
+		label = ""
+		steps = append(steps, step)
+	}
+	prog.Steps = steps
+
+	return count
+}
@@ -7,12 +7,22 @@
 package ssa
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
 )
 
-// Rule defines a peephole optimization rule.
+// Rule defines a peephole optimization rule. The rule replaces the
+// instructions matching its pattern with the instructions of its
+// replacement.
 type Rule struct {
 	Name    string
 	Source  string
@@ -23,23 +33,184 @@ type Rule struct {
 // Template defines an instruction template.
 type Template struct {
 	Op  Operand
-	In  []string
-	Out string
+	In  []Arg
+	Out Arg
+}
+
+// Arg defines a template argument. The argument name specifies the
+// variables the argument matches:
+//
+//	V<n>  matches any variable
+//	C<n>  matches any constant
+//	$<v>  matches the constant with the value v
+//	_     matches any variable
+//
+// All arguments, except the wildcard _, are bound to the variables
+// they match and all occurrences of an argument must match the same
+// variable. The argument constraints further restrict the variables
+// the argument matches. In the replacement, the $<v> arguments that
+// the pattern does not bind create new constants with the value v.
+type Arg struct {
+	Name        string
+	Constraints []Constraint
+}
+
+func (a Arg) String() string {
+	result := a.Name
+	for _, c := range a.Constraints {
+		result += ":" + c.Name
+	}
+	return result
+}
+
+// Wildcard tests if the argument is the wildcard argument _.
+func (a Arg) Wildcard() bool {
+	return a.Name == "_"
+}
+
+// Constraint restricts the variables a template argument matches. The
+// constraint is a type name or a constant predicate.
+type Constraint struct {
+	Name  string
+	Match func(v Variable) bool
+}
+
+// predicate tests if the constraint is a constant predicate.
+func (c Constraint) predicate() bool {
+	_, ok := predicates[c.Name]
+	return ok
+}
+
+func constPredicate(pred func(c *big.Int) bool) func(v Variable) bool {
+	return func(v Variable) bool {
+		c, ok := constInt(v)
+		return ok && pred(c)
+	}
 }
 
-// Expand expands the template with given environment bindings.
+// predicates define the constant predicates of the template
+// arguments.
+var predicates = map[string]func(v Variable) bool{
+	"const": func(v Variable) bool {
+		return v.Const && !v.TypeRef
+	},
+	"index": func(v Variable) bool {
+		index, ok := v.ConstValue.(int32)
+		return v.Const && ok && index >= 0
+	},
+	"zero": constPredicate(func(c *big.Int) bool {
+		return c.Sign() == 0
+	}),
+	"one": constPredicate(func(c *big.Int) bool {
+		return c.Cmp(big.NewInt(1)) == 0
+	}),
+	"pow2": constPredicate(func(c *big.Int) bool {
+		return c.Sign() > 0 && c.TrailingZeroBits() == uint(c.BitLen()-1)
+	}),
+	"odd": constPredicate(func(c *big.Int) bool {
+		return c.Bit(0) == 1
+	}),
+	"even": constPredicate(func(c *big.Int) bool {
+		return c.Bit(0) == 0
+	}),
+}
+
+var reType = regexp.MustCompilePOSIX(`^([a-z]+)([0-9]*)$`)
+
+// typeConstraint parses the type name constraint. The type name
+// without size matches all sizes of the type.
+func typeConstraint(name string) (types.Info, bool) {
+	m := reType.FindStringSubmatch(name)
+	if m == nil {
+		return types.Info{}, false
+	}
+	t, ok := types.Types[m[1]]
+	if !ok {
+		return types.Info{}, false
+	}
+	info := types.Info{
+		Type: t,
+	}
+	if len(m[2]) > 0 {
+		bits, err := strconv.Atoi(m[2])
+		if err != nil || bits == 0 {
+			return types.Info{}, false
+		}
+		info.Bits = bits
+	}
+	return info, true
+}
+
+// parseArg parses the template argument and its constraints.
+func parseArg(s string) (Arg, error) {
+	parts := strings.Split(s, ":")
+	arg := Arg{
+		Name: parts[0],
+	}
+	if len(arg.Name) == 0 {
+		return arg, fmt.Errorf("invalid argument '%s'", s)
+	}
+	for _, name := range parts[1:] {
+		if pred, ok := predicates[name]; ok {
+			arg.Constraints = append(arg.Constraints, Constraint{
+				Name:  name,
+				Match: pred,
+			})
+			continue
+		}
+		info, ok := typeConstraint(name)
+		if !ok {
+			return arg, fmt.Errorf("unknown constraint '%s'", name)
+		}
+		arg.Constraints = append(arg.Constraints, Constraint{
+			Name: name,
+			Match: func(v Variable) bool {
+				return v.Type.Type == info.Type &&
+					(info.Bits == 0 || v.Type.Bits == info.Bits)
+			},
+		})
+	}
+	return arg, nil
+}
+
+// literal creates the constant variable for the literal argument.
+func literal(name string) (Variable, error) {
+	switch name {
+	case "$true":
+		return Constant(true)
+	case "$false":
+		return Constant(false)
+	}
+	val, ok := new(big.Int).SetString(name[1:], 0)
+	if !ok {
+		return Variable{}, fmt.Errorf("invalid literal %s", name)
+	}
+	if val.IsInt64() && val.Int64() >= 0 && val.Int64() <= 0x7fffffff {
+		return Constant(int32(val.Int64()))
+	}
+	return Constant(val)
+}
+
+// Expand expands the template with given environment bindings. The
+// unbound literal arguments expand to new constants.
 func (t Template) Expand(env map[string]Variable) (Instr, error) {
 	var in []Variable
 	var out Variable
 
 	for _, i := range t.In {
-		v, ok := env[i]
-		if !ok {
+		v, ok := env[i.Name]
+		if !ok && i.Name[0] == '$' {
+			var err error
+			v, err = literal(i.Name)
+			if err != nil {
+				return Instr{}, err
+			}
+		} else if !ok {
 			return Instr{}, fmt.Errorf("input variable %s not bound", i)
 		}
 		in = append(in, v)
 	}
-	out, ok := env[t.Out]
+	out, ok := env[t.Out.Name]
 	if !ok {
 		return Instr{}, fmt.Errorf("output variable %s not bound", t.Out)
 	}
@@ -51,8 +222,15 @@ func (t Template) Expand(env map[string]Variable) (Instr, error) {
 	}, nil
 }
 
-// Match tests if the rule matches the steps span.
+// Match tests if the rule matches the beginning of the steps. The
+// function returns the replacement steps or nil if the rule does not
+// match. The outputs of the matched instructions that the
+// replacement does not define must not be live after the matched
+// instructions.
 func (rule Rule) Match(steps []Step) []Step {
+	if len(steps) < len(rule.Pattern) {
+		return nil
+	}
 	env := make(map[string]Variable)
 
 	// Match all patterns
@@ -69,7 +247,7 @@ func (rule Rule) Match(steps []Step) []Step {
 				return nil
 			}
 		}
-		if step.Instr.Out == nil {
+		if step.Instr.Out == nil || !matchWidths(step.Instr) {
 			return nil
 		}
 		if !matchVar(env, p.Out, *step.Instr.Out) {
@@ -77,13 +255,31 @@ func (rule Rule) Match(steps []Step) []Step {
 		}
 	}
 
-	var result []Step
+	// Check that the removed outputs are dead.
+	defined := NewSet()
 	for _, r := range rule.Replace {
+		defined.Add(r.Out.Name)
+	}
+	if len(steps) > len(rule.Pattern) {
+		live := steps[len(rule.Pattern)].Live
+		for idx, p := range rule.Pattern {
+			if !p.Out.Wildcard() && defined.Contains(p.Out.Name) {
+				continue
+			}
+			if live.Contains(steps[idx].Instr.Out.String()) {
+				return nil
+			}
+		}
+	}
+
+	var result []Step
+	for idx, r := range rule.Replace {
 		instr, err := r.Expand(env)
 		if err != nil {
 			fmt.Printf("template expansion failed: %s\n", err)
 			return nil
 		}
+		instr.Loc = steps[0].Instr.Loc
 
 		// Base liveness from the first replaced instruction.
 		live := steps[0].Live.Copy()
@@ -91,33 +287,64 @@ func (rule Rule) Match(steps []Step) []Step {
 			live.Add(instr.Out.String())
 		}
 
-		result = append(result, Step{
+		step := Step{
 			Instr: instr,
 			Live:  live,
-		})
+		}
+		if idx == 0 {
+			step.Label = steps[0].Label
+		}
+		result = append(result, step)
 	}
 
 	return result
 }
 
-func matchVar(env map[string]Variable, pattern string, v Variable) bool {
-	binding, ok := env[pattern]
+// matchWidths tests if the rules can match the instruction. The
+// arithmetic, bitwise, and shift instructions truncate their results
+// to the result size and the shifts truncate also the shifted value
+// before shifting it. The rule verification does not cover the
+// instructions whose result is narrower than their variable operands
+// so the rules do not match them.
+func matchWidths(instr Instr) bool {
+	switch instr.Op {
+	case Iadd, Uadd, Isub, Usub, Imult, Umult, Idiv, Udiv, Imod, Umod,
+		Lshift, Rshift, Srshift, Rotl, Rotr, Band, Bclr, Bor, Bxor:
+		for _, in := range instr.In {
+			if !in.Const && in.Type.Bits > instr.Out.Type.Bits {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchVar(env map[string]Variable, pattern Arg, v Variable) bool {
+	for _, c := range pattern.Constraints {
+		if !c.Match(v) {
+			return false
+		}
+	}
+	if pattern.Wildcard() {
+		return true
+	}
+	binding, ok := env[pattern.Name]
 	if ok {
 		// Pattern already bound, must be equal binding.
 		return v.Equal(&binding)
 	}
-	switch pattern[0] {
+	switch pattern.Name[0] {
 	case 'V':
 	case 'C':
 		if !v.Const {
 			return false
 		}
 	case '$':
-		if pattern != v.Name {
+		if pattern.Name != v.Name {
 			return false
 		}
 	}
-	env[pattern] = v
+	env[pattern.Name] = v
 
 	return true
 }
@@ -125,7 +352,7 @@ func matchVar(env map[string]Variable, pattern string, v Variable) bool {
 var rules = []*Rule{
 	{
 		Name: "Constant-shift-test => bts",
-		Source: `rshift V1 C1 V2
+		Source: `rshift V1 C1:index V2
                  band   V2 $1 V3
                  neq    V3 $0 V4
               =>
@@ -133,7 +360,7 @@ var rules = []*Rule{
 	},
 	{
 		Name: "Constant-shift-test => btc",
-		Source: `rshift V1 C1 V2
+		Source: `rshift V1 C1:index V2
                  band   V2 $1 V3
                  eq     V3 $0 V4
               =>
@@ -141,7 +368,7 @@ var rules = []*Rule{
 	},
 	{
 		Name: "Constant-shift-test => bts",
-		Source: `rshift V1 C1 V2
+		Source: `rshift V1 C1:index V2
                  band   V2 $1 V3
                  eq     V3 $1 V4
               =>
@@ -149,7 +376,7 @@ var rules = []*Rule{
 	},
 	{
 		Name: "Constant-shift-test => btc",
-		Source: `rshift V1 C1 V2
+		Source: `rshift V1 C1:index V2
                  band   V2 $1 V3
                  neq    V3 $1 V4
               =>
@@ -161,46 +388,227 @@ var reSpace = regexp.MustCompilePOSIX(`[[:space:]]+`)
 
 func init() {
 	for _, r := range rules {
-		var inReplace bool
-
+		var replace bool
 		for _, line := range strings.Split(r.Source, "\n") {
-			parts := reSpace.Split(strings.TrimSpace(line), -1)
-			if len(parts) == 1 && parts[0] == "=>" {
-				inReplace = true
+			err := r.parseLine(line, &replace)
+			if err != nil {
+				panic(fmt.Sprintf("rule %s: %s", r.Name, err))
+			}
+		}
+		err := r.check()
+		if err != nil {
+			panic(fmt.Sprintf("rule %s: %s", r.Name, err))
+		}
+	}
+}
+
+// parseLine parses the rule source line into the rule's pattern or
+// replacement. The replace argument tracks if the line belongs to the
+// replacement.
+func (rule *Rule) parseLine(line string, replace *bool) error {
+	parts := reSpace.Split(strings.TrimSpace(line), -1)
+	if len(parts) == 1 && parts[0] == "=>" {
+		if *replace {
+			return fmt.Errorf("unexpected '=>'")
+		}
+		*replace = true
+		return nil
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("unexpected pattern: %s", line)
+	}
+	var op Operand
+	var found bool
+
+	for k, v := range operands {
+		if v == parts[0] {
+			op = k
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown operand '%s'", parts[0])
+	}
+	tmpl := Template{
+		Op: op,
+	}
+	for idx, part := range parts[1:] {
+		arg, err := parseArg(part)
+		if err != nil {
+			return err
+		}
+		if idx+2 < len(parts) {
+			tmpl.In = append(tmpl.In, arg)
+		} else {
+			tmpl.Out = arg
+		}
+	}
+	if *replace {
+		rule.Replace = append(rule.Replace, tmpl)
+	} else {
+		rule.Pattern = append(rule.Pattern, tmpl)
+	}
+	return nil
+}
+
+// check verifies that the rule is well-formed. The replacement must
+// use only the literals and the arguments bound by the pattern or
+// defined by the earlier replacement instructions, and it must define
+// only the outputs of the pattern.
+func (rule *Rule) check() error {
+	if len(rule.Pattern) == 0 {
+		return fmt.Errorf("empty pattern")
+	}
+	if len(rule.Replace) == 0 {
+		return fmt.Errorf("empty replacement")
+	}
+	bound := NewSet()
+	outputs := NewSet()
+	for _, p := range rule.Pattern {
+		for _, in := range p.In {
+			bound.Add(in.Name)
+		}
+		bound.Add(p.Out.Name)
+		outputs.Add(p.Out.Name)
+	}
+	defined := NewSet()
+	for _, r := range rule.Replace {
+		for _, in := range append(r.In, r.Out) {
+			if in.Wildcard() {
+				return fmt.Errorf("wildcard in replacement")
+			}
+			if len(in.Constraints) > 0 {
+				return fmt.Errorf("constraints in replacement: %s", in)
+			}
+		}
+		for _, in := range r.In {
+			if in.Name[0] == '$' && !bound.Contains(in.Name) {
+				if _, err := literal(in.Name); err != nil {
+					return err
+				}
 				continue
 			}
-			if len(parts) < 3 {
-				panic(fmt.Sprintf("unexpected pattern: %s", line))
+			if !bound.Contains(in.Name) {
+				return fmt.Errorf("argument %s not bound", in.Name)
+			}
+			if outputs.Contains(in.Name) && !defined.Contains(in.Name) {
+				return fmt.Errorf("argument %s not defined", in.Name)
 			}
-			var op Operand
-			var found bool
+		}
+		if !outputs.Contains(r.Out.Name) {
+			return fmt.Errorf("output %s not defined by pattern", r.Out.Name)
+		}
+		if defined.Contains(r.Out.Name) {
+			return fmt.Errorf("output %s defined multiple times", r.Out.Name)
+		}
+		defined.Add(r.Out.Name)
+	}
+	return nil
+}
 
-			for k, v := range operands {
-				if v == parts[0] {
-					op = k
-					found = true
-					break
-				}
+// ParseRules parses the peephole rules from the input. The name
+// identifies the input in error messages. Each rule starts with a
+// line `rule <name>', followed by the pattern instructions, a line
+// `=>', and the replacement instructions. The lines starting with
+// `#' are comments.
+func ParseRules(name string, in io.Reader) ([]*Rule, error) {
+	var result []*Rule
+	var rule *Rule
+	var replace bool
+	var source []string
+	var ruleLine int
+
+	done := func() error {
+		if rule == nil {
+			return nil
+		}
+		rule.Source = strings.Join(source, "\n")
+		err := rule.check()
+		if err != nil {
+			return fmt.Errorf("%s:%d: rule %s: %s", name, ruleLine,
+				rule.Name, err)
+		}
+		result = append(result, rule)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	var lineno int
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "rule ") || line == "rule" {
+			if err := done(); err != nil {
+				return nil, err
 			}
-			if !found {
-				panic(fmt.Sprintf("unknown operand '%s'", parts[0]))
+			rule = &Rule{
+				Name: strings.TrimSpace(strings.TrimPrefix(line, "rule")),
 			}
-			tmpl := Template{
-				Op:  op,
-				In:  parts[1 : len(parts)-1],
-				Out: parts[len(parts)-1],
+			if len(rule.Name) == 0 {
+				return nil, fmt.Errorf("%s:%d: rule name missing",
+					name, lineno)
 			}
-			if inReplace {
-				r.Replace = append(r.Replace, tmpl)
-			} else {
-				r.Pattern = append(r.Pattern, tmpl)
+			replace = false
+			source = nil
+			ruleLine = lineno
+			continue
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("%s:%d: instruction outside rule",
+				name, lineno)
+		}
+		if err := rule.parseLine(line, &replace); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, lineno, err)
+		}
+		source = append(source, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := done(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LoadRules returns the built-in peephole rules and the rules loaded
+// from the rule files of the parameters. If the rule verification is
+// enabled, the function verifies the rules and returns an error if
+// any of them is unsound.
+func LoadRules(params *utils.Params) ([]*Rule, error) {
+	result := append([]*Rule(nil), rules...)
+	for _, file := range params.PeepholeRules {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := ParseRules(file, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, loaded...)
+	}
+	if params.VerifyPeepholeRules {
+		for _, rule := range result {
+			if err := rule.Verify(verifyRounds); err != nil {
+				return nil, err
 			}
 		}
 	}
+	return result, nil
 }
 
 // Peephole runs the peephole optimizer for the program.
 func (prog *Program) Peephole() error {
+	rules, err := LoadRules(prog.Params)
+	if err != nil {
+		return err
+	}
 
 	prog.liveness()
 outer:
@@ -209,10 +617,20 @@ outer:
 			if len(rule.Pattern) > len(prog.Steps)-i {
 				continue
 			}
-			match := rule.Match(prog.Steps[i : i+len(rule.Pattern)])
+			match := rule.Match(prog.Steps[i:])
 			if match == nil {
 				continue
 			}
+			for _, step := range match {
+				for _, in := range step.Instr.In {
+					if !in.Const || in.TypeRef {
+						continue
+					}
+					if _, ok := prog.Constants[in.Name]; !ok {
+						prog.addConstant(in)
+					}
+				}
+			}
 
 			var n []Step
 			n = append(n, prog.Steps[:i]...)
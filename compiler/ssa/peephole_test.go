@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/types"
+)
+
+func TestVerifyRules(t *testing.T) {
+	for _, rule := range rules {
+		if err := rule.Verify(verifyRounds); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+var ruleTests = []struct {
+	source string
+	sound  bool
+}{
+	{
+		source: `
+# Adding zero.
+rule add-zero
+	uadd V1 C1:zero V2
+=>
+	mov V1 V2
+`,
+		sound: true,
+	},
+	{
+		source: `
+rule and-zero
+	bor  V1 _ V2
+	band V2 $0 V3
+=>
+	band V1 $0 V3
+`,
+		sound: true,
+	},
+	{
+		source: `
+rule mult-one
+	umult V1:uint32 C1:one V2:uint32
+=>
+	mov V1 V2
+`,
+		sound: true,
+	},
+	{
+		source: `
+rule mult-two
+	umult V1 $2 V2
+=>
+	lshift V1 $1 V2
+`,
+		sound: true,
+	},
+	{
+		source: `
+rule and-odd
+	band V1 C1:odd V2
+=>
+	mov V1 V2
+`,
+		sound: false,
+	},
+	{
+		source: `
+rule narrow-mov
+	mov V1 V2:uint8
+=>
+	mov V1 V2
+	`,
+		sound: true,
+	},
+	{
+		source: `
+rule shift-test
+	rshift V1 C1 V2
+	band   V2 $1 V3
+	neq    V3 $0 V4
+=>
+	bts    V1 C1 V4
+`,
+		sound: false,
+	},
+	{
+		source: `
+# Sound only if all variables have the same width.
+rule add-sub
+	uadd V1 V2 V3
+	usub V3 V2 V4
+=>
+	mov V1 V4
+`,
+		sound: false,
+	},
+}
+
+func TestParseRules(t *testing.T) {
+	for idx, test := range ruleTests {
+		rules, err := ParseRules("test", strings.NewReader(test.source))
+		if err != nil {
+			t.Fatalf("test %d: ParseRules failed: %s", idx, err)
+		}
+		if len(rules) != 1 {
+			t.Fatalf("test %d: got %d rules, expected 1", idx, len(rules))
+		}
+		err = rules[0].Verify(verifyRounds)
+		if test.sound && err != nil {
+			t.Errorf("test %d: %s", idx, err)
+		}
+		if !test.sound && err == nil {
+			t.Errorf("test %d: unsound rule %s verified", idx, rules[0].Name)
+		}
+	}
+}
+
+func TestMatchNarrowShift(t *testing.T) {
+	uint64Type := types.Info{
+		Type: types.Uint,
+		Bits: 64,
+	}
+	boolType := types.Info{
+		Type: types.Bool,
+		Bits: 1,
+	}
+	count, _ := Constant(int32(2))
+	zero, _ := Constant(int32(0))
+	one, _ := Constant(int32(1))
+
+	for _, bits := range []int{64, 1} {
+		x := Variable{
+			Name: "x",
+			Type: uint64Type,
+		}
+		shifted := Variable{
+			Name: "s",
+			Type: types.Info{
+				Type: types.Uint,
+				Bits: bits,
+			},
+		}
+		masked := Variable{
+			Name: "m",
+			Type: shifted.Type,
+		}
+		result := Variable{
+			Name: "r",
+			Type: boolType,
+		}
+		rshift, err := NewRshiftInstr(uint64Type, x, count, shifted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		band, err := NewBandInstr(shifted, one, masked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		neq, err := NewNeqInstr(masked, zero, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps := []Step{
+			{Instr: rshift},
+			{Instr: band},
+			{Instr: neq},
+		}
+		matched := rules[0].Match(steps) != nil
+		if matched != (bits == 64) {
+			t.Errorf("%d-bit shift result: matched=%v", bits, matched)
+		}
+	}
+}
+
+var ruleErrorTests = []struct {
+	source string
+	err    string
+}{
+	{
+		source: "uadd V1 V2 V3\n",
+		err:    "test:1: instruction outside rule",
+	},
+	{
+		source: "rule a\n  uadd V1 V2 V3\n=>\n  mov V4 V3\n",
+		err:    "test:1: rule a: argument V4 not bound",
+	},
+	{
+		source: "rule a\n  uadd V1 V2 V3\n=>\n  uadd V1 $x V3\n",
+		err:    "test:1: rule a: invalid literal $x",
+	},
+	{
+		source: "rule a\n  uadd V1 V2:foo V3\n",
+		err:    "test:2: unknown constraint 'foo'",
+	},
+	{
+		source: "rule a\n  uadd V1 V2 V3\n  uadd V3 V1 V4\n=>\n  mov V3 V4\n",
+		err:    "test:1: rule a: argument V3 not defined",
+	},
+	{
+		source: "rule a\n  uadd V1 V2 V3\n=>\n  mov V1 _\n",
+		err:    "test:1: rule a: wildcard in replacement",
+	},
+	{
+		source: "rule a\n  foo V1 V2 V3\n",
+		err:    "test:2: unknown operand 'foo'",
+	},
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	for idx, test := range ruleErrorTests {
+		_, err := ParseRules("test", strings.NewReader(test.source))
+		if err == nil {
+			t.Errorf("test %d: ParseRules succeeded, expected %s", idx, test.err)
+		} else if err.Error() != test.err {
+			t.Errorf("test %d: got error '%s', expected '%s'", idx, err,
+				test.err)
+		}
+	}
+}
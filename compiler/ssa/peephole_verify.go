@@ -0,0 +1,281 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+
+	"github.com/markkurossi/mpc/compiler/types"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// verifyRounds specifies the number of random inputs the rule
+// verification uses.
+const verifyRounds = 1000
+
+// verifyWidths specify the variable widths the rule verification
+// uses for the variables without type constraints. The rules match
+// variables of any widths so each variable gets its width
+// independently in each round.
+var verifyWidths = []int{1, 8, 16, 32, 64}
+
+// verifyTypes specify the variable types the rule verification uses
+// for the variables without type constraints.
+var verifyTypes = []types.Type{types.Uint, types.Int}
+
+// Verify verifies the soundness of the rule. The function evaluates
+// the rule's pattern and replacement with the SSA interpreter for
+// random variable types, widths, and values, and checks that the
+// replacement computes the same values for its outputs as the
+// pattern. The rounds where the rules can't match the pattern
+// instructions or where they are not valid for the random widths are
+// skipped. The function returns an error
+// describing the first counterexample it finds.
+func (rule *Rule) Verify(rounds int) error {
+	rnd := rand.New(rand.NewSource(1))
+	prog := &Program{
+		Params: &utils.Params{},
+	}
+
+	// Name the wildcards so that they can be bound to variables.
+	var pattern []Template
+	var wildcards int
+	for _, p := range rule.Pattern {
+		t := Template{
+			Op: p.Op,
+		}
+		for _, arg := range append(append([]Arg(nil), p.In...), p.Out) {
+			if arg.Wildcard() {
+				arg.Name = fmt.Sprintf("_%d", wildcards)
+				wildcards++
+			}
+			t.In = append(t.In, arg)
+		}
+		t.Out = t.In[len(t.In)-1]
+		t.In = t.In[:len(t.In)-1]
+		pattern = append(pattern, t)
+	}
+
+	for round := 0; round < rounds; round++ {
+		env, inputs, err := verifyInputs(pattern, rnd)
+		if err != nil {
+			return fmt.Errorf("rule %s: %s", rule.Name, err)
+		}
+		if !verifyMatch(pattern, env) {
+			continue
+		}
+		expected := make(map[string]value)
+		result := make(map[string]value)
+		for k, v := range inputs {
+			expected[k] = v
+			result[k] = v
+		}
+		err = evalTemplates(prog, pattern, env, expected)
+		if err != nil {
+			// The matched instructions can't have these widths.
+			continue
+		}
+		err = evalTemplates(prog, rule.Replace, env, result)
+		if err != nil {
+			return fmt.Errorf("rule %s: replacement: %s", rule.Name, err)
+		}
+		for _, r := range rule.Replace {
+			key := env[r.Out.Name].String()
+			if result[key].v.Cmp(expected[key].v) != 0 {
+				var args []string
+				for _, p := range pattern {
+					for _, in := range p.In {
+						v := env[in.Name]
+						if val, ok := inputs[v.String()]; ok {
+							args = append(args, fmt.Sprintf("%s=%s",
+								in.Name, val.v))
+						} else if v.Const {
+							args = append(args, fmt.Sprintf("%s=%s",
+								in.Name, v.Name))
+						}
+					}
+				}
+				return fmt.Errorf("rule %s: %s: %s=%s, expected %s",
+					rule.Name, strings.Join(args, ","), r.Out.Name,
+					result[key].v, expected[key].v)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyInputs creates random bindings for the pattern arguments. The
+// function returns the bindings and the values of the non-constant
+// input variables.
+func verifyInputs(pattern []Template, rnd *rand.Rand) (
+	map[string]Variable, map[string]value, error) {
+
+	env := make(map[string]Variable)
+	inputs := make(map[string]value)
+	outputs := NewSet()
+	for _, p := range pattern {
+		outputs.Add(p.Out.Name)
+	}
+	for _, p := range pattern {
+		for _, arg := range append(append([]Arg(nil), p.In...), p.Out) {
+			name := arg.Name
+			if _, ok := env[name]; ok {
+				continue
+			}
+			t := types.Info{
+				Type: verifyTypes[rnd.Intn(len(verifyTypes))],
+				Bits: verifyWidths[rnd.Intn(len(verifyWidths))],
+			}
+			isConst := name[0] == 'C' && !outputs.Contains(name)
+			var pred []string
+			for _, c := range arg.Constraints {
+				if c.predicate() {
+					isConst = true
+					pred = append(pred, c.Name)
+					continue
+				}
+				info, _ := typeConstraint(c.Name)
+				t.Type = info.Type
+				if info.Bits > 0 {
+					t.Bits = info.Bits
+				} else if info.Type == types.Bool {
+					t.Bits = 1
+				}
+			}
+			var v Variable
+			if name[0] == '$' {
+				var err error
+				v, err = literal(name)
+				if err != nil {
+					return nil, nil, err
+				}
+			} else if isConst {
+				var err error
+				v, err = randomConst(rnd, t, pred)
+				if err != nil {
+					return nil, nil, err
+				}
+			} else {
+				v = Variable{
+					Name: name,
+					Type: t,
+				}
+				if !outputs.Contains(name) {
+					val := new(big.Int)
+					for i := 0; i < t.Bits; i++ {
+						val.SetBit(val, i, uint(rnd.Intn(2)))
+					}
+					inputs[v.String()] = newValue(t.Bits, val)
+				}
+			}
+			for _, c := range arg.Constraints {
+				if !c.Match(v) {
+					return nil, nil, fmt.Errorf(
+						"can't satisfy constraint %s of %s", c.Name, arg.Name)
+				}
+			}
+			env[name] = v
+		}
+	}
+	return env, inputs, nil
+}
+
+// verifyMatch tests if the rules can match the pattern instructions
+// with the variable bindings.
+func verifyMatch(pattern []Template, env map[string]Variable) bool {
+	for _, p := range pattern {
+		instr, err := p.Expand(env)
+		if err != nil || !matchWidths(instr) {
+			return false
+		}
+	}
+	return true
+}
+
+// randomConst creates a random constant of the type t satisfying
+// the constant predicates.
+func randomConst(rnd *rand.Rand, t types.Info, pred []string) (
+	Variable, error) {
+
+	val := new(big.Int)
+	if rnd.Intn(2) == 0 {
+		val.SetInt64(int64(rnd.Intn(2*t.Bits + 1)))
+	} else {
+		for i := 0; i < t.Bits; i++ {
+			val.SetBit(val, i, uint(rnd.Intn(2)))
+		}
+	}
+	var index bool
+	for _, p := range pred {
+		switch p {
+		case "index":
+			index = true
+			val.SetInt64(int64(rnd.Intn(t.Bits + 2)))
+		case "zero":
+			val.SetInt64(0)
+		case "one":
+			val.SetInt64(1)
+		case "pow2":
+			val.Lsh(big.NewInt(1), uint(rnd.Intn(t.Bits)))
+		case "odd":
+			val.SetBit(val, 0, 1)
+		case "even":
+			val.SetBit(val, 0, 0)
+		}
+	}
+	if index {
+		return Constant(int32(val.Int64()))
+	}
+	var v Variable
+	var err error
+	if val.IsUint64() {
+		v, err = Constant(val.Uint64())
+	} else {
+		v, err = Constant(val)
+	}
+	if err != nil {
+		return v, err
+	}
+	if t.Type == types.Bool {
+		return Constant(val.Sign() != 0)
+	}
+	if t.Bits >= v.Type.MinBits {
+		v.Type.Type = t.Type
+		v.Type.Bits = t.Bits
+	}
+	return v, nil
+}
+
+// evalTemplates evaluates the templates with the SSA interpreter.
+func evalTemplates(prog *Program, tmpls []Template, env map[string]Variable,
+	values map[string]value) error {
+
+	for _, t := range tmpls {
+		instr, err := t.Expand(env)
+		if err != nil {
+			return err
+		}
+		var in []value
+		for _, v := range instr.In {
+			val, err := lookup(values, v)
+			if err != nil {
+				return err
+			}
+			in = append(in, val)
+		}
+		bits := instr.Out.Type.Bits
+		out, err := prog.eval(instr, in, bits)
+		if err != nil {
+			return err
+		}
+		values[instr.Out.String()] = newValue(bits, out)
+	}
+	return nil
+}
@@ -190,16 +190,23 @@ func (prog *Program) liveness() {
 			}
 			live[in.String()] = true
 		}
+		var aliases []Variable
 		switch step.Instr.Op {
 		case Slice, Mov:
-			if !step.Instr.In[0].Const {
-				// Now `out' is an alias for `in[0]' and we must make
-				// `in] live in all steps where `out' is live.
-				for j := i + 1; j < len(prog.Steps); j++ {
-					s := &prog.Steps[j]
-					if s.Live.Contains(step.Instr.Out.String()) {
-						s.Live.Add(step.Instr.In[0].String())
-					}
+			aliases = step.Instr.In[:1]
+		case Amov:
+			aliases = step.Instr.In[:2]
+		}
+		for _, in := range aliases {
+			if in.Const {
+				continue
+			}
+			// Now `out' is an alias for `in' and we must make `in'
+			// live in all steps where `out' is live.
+			for j := i + 1; j < len(prog.Steps); j++ {
+				s := &prog.Steps[j]
+				if s.Live.Contains(step.Instr.Out.String()) {
+					s.Live.Add(in.String())
 				}
 			}
 		}
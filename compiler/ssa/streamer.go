@@ -239,34 +239,9 @@ func (prog *Program) StreamCircuit(conn *p2p.Conn, params *utils.Params,
 		switch instr.Op {
 
 		case Slice:
-			if !instr.In[1].Const {
-				return nil, nil,
-					fmt.Errorf("%s only constant index supported", instr.Op)
-			}
-			var from int
-			switch val := instr.In[1].ConstValue.(type) {
-			case int32:
-				from = int(val)
-			default:
-				return nil, nil,
-					fmt.Errorf("%s unsupported index type %T", instr.Op, val)
-			}
-
-			if !instr.In[2].Const {
-				return nil, nil,
-					fmt.Errorf("%s only constant index supported", instr.Op)
-			}
-			var to int
-			switch val := instr.In[2].ConstValue.(type) {
-			case int32:
-				to = int(val)
-			default:
-				return nil, nil,
-					fmt.Errorf("%s unsupported index type %T", instr.Op, val)
-			}
-			if from >= to {
-				return nil, nil, fmt.Errorf("%s bounds out of range [%d:%d]",
-					instr.Op, from, to)
+			from, to, err := constBounds(instr.Op, instr.In[1], instr.In[2])
+			if err != nil {
+				return nil, nil, err
 			}
 			for bit := from; bit < to; bit++ {
 				var id uint32
@@ -282,6 +257,29 @@ func (prog *Program) StreamCircuit(conn *p2p.Conn, params *utils.Params,
 				out[bit-from].ID = id
 			}
 
+		case Amov:
+			from, to, err := constBounds(instr.Op, instr.In[2], instr.In[3])
+			if err != nil {
+				return nil, nil, err
+			}
+			for bit := 0; bit < instr.Out.Type.Bits; bit++ {
+				var w *circuits.Wire
+				if bit >= from && bit < to {
+					if bit-from < len(wires[0]) {
+						w = wires[0][bit-from]
+					}
+				} else if bit < len(wires[1]) {
+					w = wires[1][bit]
+				}
+				if w == nil {
+					w, err = prog.ZeroWire(conn, streaming)
+					if err != nil {
+						return nil, nil, err
+					}
+				}
+				out[bit].ID = w.ID
+			}
+
 		case Mov:
 			for bit := 0; bit < instr.Out.Type.Bits; bit++ {
 				var id uint32
@@ -658,20 +656,91 @@ func newBinary(bin NewBinary) NewCircuit {
 
 func newMultiplier(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	out []*circuits.Wire) (bool, error) {
+	if cc.Params.OptStrengthReduce {
+		idx, c, err := constMultiplier(cc, instr, in, out)
+		if err != nil {
+			return false, err
+		}
+		if c != nil {
+			o := circuits.MakeWires(len(out))
+			err := circuits.NewConstMultiplier(cc, in[1-idx], c, o)
+			if err != nil {
+				return false, err
+			}
+			for i := 0; i < len(out); i++ {
+				cc.ID(o[i], out[i])
+			}
+			return false, nil
+		}
+	}
 	return true, circuits.NewMultiplier(cc, cc.Params.CircMultArrayTreshold,
 		in[0], in[1], out)
 }
 
 func newDivider(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	out []*circuits.Wire) (bool, error) {
+	if ok, err := newConstDivider(cc, instr, in, out, nil); ok || err != nil {
+		return false, err
+	}
 	return true, circuits.NewDivider(cc, in[0], in[1], out, nil)
 }
 
 func newModulo(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	out []*circuits.Wire) (bool, error) {
+	if ok, err := newConstDivider(cc, instr, in, nil, out); ok || err != nil {
+		return false, err
+	}
 	return true, circuits.NewDivider(cc, in[0], in[1], nil, out)
 }
 
+// newConstDivider creates the division circuit for a positive
+// constant divisor. The function returns false if the divisor is not
+// a positive constant, if the generic divider is cheaper, or if the
+// strength reduction is not enabled.
+func newConstDivider(cc *circuits.Compiler, instr Instr,
+	in [][]*circuits.Wire, q, r []*circuits.Wire) (bool, error) {
+	if !cc.Params.OptStrengthReduce {
+		return false, nil
+	}
+	out := q
+	if out == nil {
+		out = r
+	}
+	d, err := constDivider(cc, instr, in, out, q != nil)
+	if err != nil || d == nil {
+		return false, err
+	}
+	o := circuits.MakeWires(len(out))
+	if q != nil {
+		err = circuits.NewConstDivider(cc, in[0], d, o, nil)
+	} else {
+		err = circuits.NewConstDivider(cc, in[0], d, nil, o)
+	}
+	if err != nil {
+		return true, err
+	}
+	for i := 0; i < len(out); i++ {
+		cc.ID(o[i], out[i])
+	}
+	return true, nil
+}
+
+func newShifter(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
+	out []*circuits.Wire) (bool, error) {
+	if !instr.In[1].Const {
+		return true, shifters[instr.Op](cc, in[0], in[1], out)
+	}
+	count, err := constCount(instr.In[1])
+	if err != nil {
+		return false, fmt.Errorf("%s %s", instr.Op, err)
+	}
+	o := constShift(cc, instr.Op, in[0], len(out), count)
+	for i := 0; i < len(out); i++ {
+		cc.ID(o[i], out[i])
+	}
+	return false, nil
+}
+
 var circuitGenerators = map[Operand]NewCircuit{
 	Iadd:  newBinary(circuits.NewAdder),
 	Uadd:  newBinary(circuits.NewAdder),
@@ -683,22 +752,29 @@ var circuitGenerators = map[Operand]NewCircuit{
 	Udiv:  newDivider,
 	Imod:  newModulo,
 	Umod:  newModulo,
-	Ilt:   newBinary(circuits.NewLtComparator),
-	Ult:   newBinary(circuits.NewLtComparator),
-	Ile:   newBinary(circuits.NewLeComparator),
-	Ule:   newBinary(circuits.NewLeComparator),
-	Igt:   newBinary(circuits.NewGtComparator),
-	Ugt:   newBinary(circuits.NewGtComparator),
-	Ige:   newBinary(circuits.NewGeComparator),
-	Uge:   newBinary(circuits.NewGeComparator),
-	Eq:    newBinary(circuits.NewEqComparator),
-	Neq:   newBinary(circuits.NewNeqComparator),
-	And:   newBinary(circuits.NewLogicalAND),
-	Or:    newBinary(circuits.NewLogicalOR),
-	Band:  newBinary(circuits.NewBinaryAND),
-	Bclr:  newBinary(circuits.NewBinaryClear),
-	Bor:   newBinary(circuits.NewBinaryOR),
-	Bxor:  newBinary(circuits.NewBinaryXOR),
+
+	Lshift:  newShifter,
+	Rshift:  newShifter,
+	Srshift: newShifter,
+	Rotl:    newShifter,
+	Rotr:    newShifter,
+
+	Ilt:  newBinary(circuits.NewLtComparator),
+	Ult:  newBinary(circuits.NewLtComparator),
+	Ile:  newBinary(circuits.NewLeComparator),
+	Ule:  newBinary(circuits.NewLeComparator),
+	Igt:  newBinary(circuits.NewGtComparator),
+	Ugt:  newBinary(circuits.NewGtComparator),
+	Ige:  newBinary(circuits.NewGeComparator),
+	Uge:  newBinary(circuits.NewGeComparator),
+	Eq:   newBinary(circuits.NewEqComparator),
+	Neq:  newBinary(circuits.NewNeqComparator),
+	And:  newBinary(circuits.NewLogicalAND),
+	Or:   newBinary(circuits.NewLogicalOR),
+	Band: newBinary(circuits.NewBinaryAND),
+	Bclr: newBinary(circuits.NewBinaryClear),
+	Bor:  newBinary(circuits.NewBinaryOR),
+	Bxor: newBinary(circuits.NewBinaryXOR),
 
 	Builtin: func(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 		out []*circuits.Wire) (bool, error) {
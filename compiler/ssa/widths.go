@@ -0,0 +1,327 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/compiler/types"
+)
+
+// widths tracks the known widths of the program variables. The width
+// of a variable is the number of its low bits that can be non-zero;
+// all bits above the width are known to be zero.
+type widths map[string]int
+
+// width returns the known width of the variable v.
+func (w widths) width(v Variable) int {
+	if v.Const {
+		if v.TypeRef {
+			return v.Type.Bits
+		}
+		val, err := lookup(nil, v)
+		if err != nil {
+			return v.Type.Bits
+		}
+		return val.v.BitLen()
+	}
+	width, ok := w[v.String()]
+	if ok {
+		return width
+	}
+	return v.Type.Bits
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// infer computes the known width of the instruction's result. The
+// width is computed with the semantics of the program interpreter:
+// the operands are zero-extended and the results are truncated to
+// the size of the result variable.
+func (w widths) infer(instr Instr) int {
+	bits := instr.Out.Type.Bits
+
+	var wa, wb int
+	if len(instr.In) > 0 {
+		wa = min(w.width(instr.In[0]), bits)
+	}
+	if len(instr.In) > 1 {
+		wb = min(w.width(instr.In[1]), bits)
+	}
+
+	switch instr.Op {
+	case Iadd, Uadd:
+		return min(max(wa, wb)+1, bits)
+
+	case Imult, Umult:
+		return min(wa+wb, bits)
+
+	case Imod, Umod:
+		// The remainder is smaller than the divisor, or the dividend
+		// if the divisor is zero.
+		return max(wa, wb)
+
+	case Band:
+		return min(wa, wb)
+
+	case Bclr:
+		return wa
+
+	case Bor, Bxor:
+		return max(wa, wb)
+
+	case Lshift, Rshift, Srshift:
+		if !instr.In[1].Const {
+			if instr.Op == Rshift {
+				return wa
+			}
+			break
+		}
+		count, err := constCount(instr.In[1])
+		if err != nil {
+			break
+		}
+		if instr.Op == Lshift {
+			return min(wa+count, bits)
+		}
+		if instr.Op == Srshift &&
+			w.width(instr.In[0]) >= instr.In[0].Type.Bits {
+			// The sign bit can be set.
+			break
+		}
+		return max(wa-count, 0)
+
+	case Slice:
+		from, to, err := constBounds(instr.Op, instr.In[1], instr.In[2])
+		if err != nil {
+			break
+		}
+		return min(min(to-from, max(w.width(instr.In[0])-from, 0)), bits)
+
+	case Amov:
+		from, to, err := constBounds(instr.Op, instr.In[2], instr.In[3])
+		if err != nil {
+			break
+		}
+		return min(max(wb, from+min(wa, to-from)), bits)
+
+	case Ilt, Ult, Ile, Ule, Igt, Ugt, Ige, Uge, Eq, Neq, And, Or, Bts, Btc:
+		return min(1, bits)
+
+	case Mov:
+		return wa
+
+	case Phi:
+		return min(max(w.width(instr.In[1]), w.width(instr.In[2])), bits)
+	}
+	return bits
+}
+
+// narrower tests if the operation can be computed with narrower
+// operands and result.
+func (op Operand) narrower() bool {
+	switch op {
+	case Iadd, Uadd, Imult, Umult, Imod, Umod, Band,
+		Ilt, Ult, Ile, Ule, Igt, Ugt, Ige, Uge, Eq, Neq:
+		return true
+	default:
+		return false
+	}
+}
+
+// narrower computes the operand and result sizes for computing the
+// binary instruction with narrower operands. The function returns
+// false if the instruction can't be narrowed.
+func (w widths) narrower(instr Instr) (int, int, int, bool) {
+	if !instr.Op.narrower() || len(instr.In) != 2 {
+		return 0, 0, 0, false
+	}
+	bits := instr.Out.Type.Bits
+	wa := max(w.width(instr.In[0]), 1)
+	wb := max(w.width(instr.In[1]), 1)
+
+	var r int
+	switch instr.Op {
+	case Iadd, Uadd:
+		// The results are truncated to the result size so the high
+		// bits of the operands do not affect the result.
+		wa = min(wa, bits)
+		wb = min(wb, bits)
+		r = min(max(wa, wb)+1, bits)
+	case Imult, Umult:
+		wa = min(wa, bits)
+		wb = min(wb, bits)
+		r = min(wa+wb, bits)
+	case Imod, Umod:
+		r = min(max(wa, wb), bits)
+	case Band:
+		wa = min(min(wa, wb), bits)
+		wb = wa
+		r = wa
+	default:
+		// The comparison results are not narrowed.
+		r = bits
+	}
+	narrow := r < bits
+	for idx, width := range []int{wa, wb} {
+		in := instr.In[idx]
+		if in.Const {
+			if in.Type.MinBits > width {
+				narrow = true
+			}
+		} else if in.Type.Bits > width {
+			narrow = true
+		}
+	}
+	return wa, wb, r, narrow
+}
+
+// narrowWidths infers the known widths of the program variables and
+// computes the arithmetic operations, comparisons, and binary AND
+// operations with operands whose high bits are known to be zero with
+// narrower operands and results. The operands are narrowed with
+// slice instructions and the results are extended with mov
+// instructions which do not create any gates. The function returns
+// the number of narrowed instructions.
+func (prog *Program) narrowWidths() int {
+	w := make(widths)
+	var version int
+	for _, step := range prog.Steps {
+		vars := append([]Variable(nil), step.Instr.In...)
+		vars = append(vars, step.Instr.Ret...)
+		if step.Instr.Out != nil {
+			vars = append(vars, *step.Instr.Out)
+		}
+		for _, v := range vars {
+			if v.Name == anon && v.Version >= version {
+				version = v.Version + 1
+			}
+		}
+	}
+	temp := func(t types.Info, bits int) Variable {
+		if t.Type != types.Int {
+			t.Type = types.Uint
+		}
+		v := Variable{
+			Name:    anon,
+			Version: version,
+			Type: types.Info{
+				Type: t.Type,
+				Bits: bits,
+			},
+		}
+		version++
+		return v
+	}
+
+	// The narrowed variables, keyed by the variable and width.
+	narrowVars := make(map[string]Variable)
+	narrowKey := func(v Variable, width int) string {
+		return fmt.Sprintf("%s/%d", v, width)
+	}
+
+	var count int
+	steps := make([]Step, 0, len(prog.Steps))
+
+	for _, step := range prog.Steps {
+		instr := step.Instr
+		if instr.Out == nil {
+			steps = append(steps, step)
+			continue
+		}
+		w[instr.Out.String()] = w.infer(instr)
+
+		wa, wb, r, ok := w.narrower(instr)
+		if !ok {
+			steps = append(steps, step)
+			continue
+		}
+		var narrowed []Instr
+		var failed bool
+		in := make([]Variable, 2)
+		for idx, width := range []int{wa, wb} {
+			v := instr.In[idx]
+			if v.Const {
+				if v.Type.MinBits > width {
+					val, err := lookup(nil, v)
+					if err == nil {
+						v, err = prog.constant(new(big.Int).And(val.v,
+							mask(width)))
+					}
+					if err != nil {
+						failed = true
+						break
+					}
+				}
+			} else if v.Type.Bits > width {
+				key := narrowKey(v, width)
+				t, ok := narrowVars[key]
+				if !ok {
+					t = temp(v.Type, width)
+					from, _ := Constant(int32(0))
+					to, _ := Constant(int32(width))
+					prog.addConstant(from)
+					prog.addConstant(to)
+					narrowed = append(narrowed,
+						NewSliceInstr(v, from, to, t))
+					w[t.String()] = width
+					narrowVars[key] = t
+				}
+				v = t
+			}
+			in[idx] = v
+		}
+		if failed {
+			steps = append(steps, step)
+			continue
+		}
+		out := *instr.Out
+		if r < out.Type.Bits {
+			t := temp(out.Type, r)
+			w[t.String()] = min(w[out.String()], r)
+			narrowed = append(narrowed, Instr{
+				Op:  instr.Op,
+				In:  in,
+				Out: &t,
+			}, NewMovInstr(t, out))
+			narrowVars[narrowKey(out, r)] = t
+		} else {
+			narrowed = append(narrowed, Instr{
+				Op:  instr.Op,
+				In:  in,
+				Out: &out,
+			})
+		}
+		for idx, i := range narrowed {
+			i.Loc = instr.Loc
+			s := Step{
+				Instr: i,
+			}
+			if idx == 0 {
+				s.Label = step.Label
+			}
+			steps = append(steps, s)
+		}
+		count++
+	}
+	prog.Steps = steps
+
+	return count
+}
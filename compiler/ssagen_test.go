@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/markkurossi/mpc/compiler/utils"
@@ -292,3 +293,68 @@ func TestSSAGen(t *testing.T) {
 		}
 	}
 }
+
+func TestUndefinedReceiver(t *testing.T) {
+	_, _, err := NewCompiler(&utils.Params{}).Compile(`
+package main
+func (q Q) Foo() int32 {
+	return 1
+}
+func main(a int32) int32 {
+	return a
+}
+`)
+	if err == nil || !strings.Contains(err.Error(),
+		"undefined receiver type Q") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+var ssagenErrorTests = []struct {
+	code string
+	err  string
+}{
+	{
+		code: `
+package main
+func main(a, b int32) int32 {
+	if b > 0 {
+		return c
+	}
+	if a > 0 {
+		return 1
+	}
+	return a
+}
+`,
+		err: "undefined variable 'c'",
+	},
+	{
+		code: `
+package main
+func main(a, b int32) int32 {
+	for i := 0; i < 2; i++ {
+		a += x
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		err: "undefined variable 'x'",
+	},
+}
+
+func TestSSAGenErrors(t *testing.T) {
+	for idx, test := range ssagenErrorTests {
+		_, _, err := NewCompiler(&utils.Params{}).Compile(test.code)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test %d: Compile: unexpected error: %v", idx, err)
+		}
+		_, _, err = NewCompiler(&utils.Params{}).CompileSSA(test.code)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test %d: CompileSSA: unexpected error: %v", idx, err)
+		}
+	}
+}
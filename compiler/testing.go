@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"fmt"
+	"math/big"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/ast"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+// TestSuffix is the file name suffix of the MPCL unit test files.
+const TestSuffix = "_test.mpcl"
+
+// TestPrefix is the name prefix of the MPCL unit test functions. The
+// test functions have no arguments and they return a single bool
+// value which specifies if the test passed.
+const TestPrefix = "Test"
+
+// TestResult describes the result of an MPCL unit test.
+type TestResult struct {
+	Name    string
+	Loc     utils.Point
+	Pass    bool
+	Err     error
+	Elapsed time.Duration
+}
+
+func (r TestResult) String() string {
+	if r.Pass {
+		return fmt.Sprintf("--- PASS: %s (%s)", r.Name, r.Elapsed)
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("--- FAIL: %s (%s)\n    %s: %s",
+			r.Name, r.Elapsed, r.Loc, r.Err)
+	}
+	return fmt.Sprintf("--- FAIL: %s (%s)\n    %s: %s returned false",
+		r.Name, r.Elapsed, r.Loc, r.Name)
+}
+
+// RunTests runs the unit tests of the package in the directory
+// dir. The unit tests are defined in the package's TestSuffix files
+// and they are compiled together with the package's source files. Each
+// test function is compiled to a circuit and evaluated in plaintext
+// without any network communication.
+func (c *Compiler) RunTests(dir string) ([]TestResult, error) {
+	files, err := utils.ReadDirNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	var hasTests bool
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".mpcl") {
+			continue
+		}
+		if strings.HasSuffix(f, TestSuffix) {
+			hasTests = true
+		}
+		sources = append(sources, path.Join(dir, f))
+	}
+	if !hasTests {
+		return nil, nil
+	}
+
+	logger := c.newLogger()
+	pkg, err := c.parseFiles(sources, logger)
+	if err != nil {
+		return nil, err
+	}
+	var tests []*ast.Func
+	for name, f := range pkg.Functions {
+		if strings.HasPrefix(name, TestPrefix) &&
+			strings.HasSuffix(f.Loc.Source, TestSuffix) {
+			tests = append(tests, f)
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		a, b := tests[i].Loc, tests[j].Loc
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Line < b.Line
+	})
+
+	var results []TestResult
+	params := c.params
+	for _, test := range tests {
+		start := time.Now()
+		result := TestResult{
+			Name: test.Name,
+			Loc:  test.Loc,
+		}
+		// The compilation modifies the package so each test is
+		// compiled from a fresh parse.
+		result.Pass, result.Err = NewCompiler(params).runTest(sources,
+			test.Name)
+		result.Elapsed = time.Since(start)
+		results = append(results, result)
+
+		// Report the package warnings only once.
+		if params == c.params {
+			p := *c.params
+			p.Warnings = utils.Warnings{}
+			params = &p
+		}
+	}
+	return results, nil
+}
+
+func (c *Compiler) runTest(sources []string, name string) (bool, error) {
+	circ, err := c.compileTest(sources, name)
+	if err != nil {
+		return false, err
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(0)})
+	if err != nil {
+		return false, err
+	}
+	return results[0].Sign() != 0, nil
+}
+
+// compileTest compiles the named test function into a circuit.
+func (c *Compiler) compileTest(sources []string, name string) (
+	*circuit.Circuit, error) {
+
+	logger := c.newLogger()
+	pkg, err := c.parseFiles(sources, logger)
+	if err != nil {
+		return nil, err
+	}
+	f := pkg.Functions[name]
+	if len(f.Args) != 0 || len(f.Return) != 1 ||
+		f.Return[0].Type.String() != "bool" {
+		return nil, fmt.Errorf("test function must be func %s() bool", name)
+	}
+	// The test is compiled without call evaluation and optimizations
+	// so the tested functions are computed by the generated gates and
+	// not folded into constants at compile time.
+	params := *c.params
+	params.SetOptLevel(0)
+	params.NoCallEval = true
+
+	program, _, err := pkg.CompileFunc(c.packages, logger, &params, name)
+	if err != nil {
+		return nil, err
+	}
+	// The circuit compiler derives the constant wires from the input
+	// wires so the test program gets a dummy input.
+	program.Inputs = circuit.IO{
+		circuit.IOArg{
+			Name: "%test",
+			Type: "bool",
+			Size: 1,
+		},
+	}
+	program.InputWires, err = program.Wires("%test", 1)
+	if err != nil {
+		return nil, err
+	}
+	return program.CompileCircuit(&params)
+}
+
+// parseFiles parses the source files of a package.
+func (c *Compiler) parseFiles(files []string, logger *utils.Logger) (
+	*ast.Package, error) {
+
+	var pkg *ast.Package
+	for _, file := range files {
+		f, err := utils.OpenFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err = c.parse(file, f, logger, pkg)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+func TestRunTests(t *testing.T) {
+	for _, dir := range []string{
+		"../pkg/math",
+		"../pkg/math/bits",
+		"../pkg/encoding/binary",
+	} {
+		results, err := NewCompiler(&utils.Params{}).RunTests(dir)
+		if err != nil {
+			t.Fatalf("%s: %s", dir, err)
+		}
+		if len(results) == 0 {
+			t.Errorf("%s: no tests found", dir)
+		}
+		for _, r := range results {
+			if !r.Pass {
+				t.Errorf("%s: %s", dir, r)
+			}
+		}
+	}
+}
+
+func TestRunTestsFail(t *testing.T) {
+	dir := writeModuleFiles(t, map[string]string{
+		"calc/calc.mpcl": `
+package calc
+func Add(a, b int32) int32 {
+	return a + b
+}
+`,
+		"calc/calc_test.mpcl": `
+package calc
+func TestAdd() bool {
+	return Add(1, 2) == 3
+}
+func TestBroken() bool {
+	return Add(1, 2) == 4
+}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	results, err := NewCompiler(&utils.Params{}).RunTests(path.Join(dir,
+		"calc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if !results[0].Pass || results[0].Name != "TestAdd" {
+		t.Errorf("unexpected result: %s", results[0])
+	}
+	if results[1].Pass || results[1].Name != "TestBroken" {
+		t.Errorf("unexpected result: %s", results[1])
+	}
+	if !strings.Contains(results[1].String(), "calc_test.mpcl:6:") {
+		t.Errorf("missing test location: %s", results[1])
+	}
+}
+
+func TestRunTestsGates(t *testing.T) {
+	dir := writeModuleFiles(t, map[string]string{
+		"calc/calc.mpcl": `
+package calc
+func Add(a, b int32) int32 {
+	return a + b
+}
+`,
+		"calc/calc_test.mpcl": `
+package calc
+func TestAdd() bool {
+	return Add(1, 2) == 3
+}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	params := &utils.Params{}
+	params.SetOptLevel(1)
+	circ, err := NewCompiler(params).compileTest([]string{
+		path.Join(dir, "calc/calc.mpcl"),
+		path.Join(dir, "calc/calc_test.mpcl"),
+	}, "TestAdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tested function must be computed by the circuit and not
+	// by the compile-time evaluation.
+	if circ.NumGates == 0 {
+		t.Errorf("test circuit has no gates")
+	}
+}
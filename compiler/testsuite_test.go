@@ -47,7 +47,12 @@ loop:
 			continue
 		}
 		name := path.Join(testsuite, file)
-		circ, annotations, err := compiler.CompileFile(name)
+		program, annotations, err := compiler.CompileSSAFile(name)
+		if err != nil {
+			t.Errorf("failed to compiler '%s': %s", file, err)
+			continue
+		}
+		circ, err := program.CompileCircuit(compiler.params)
 		if err != nil {
 			t.Errorf("failed to compiler '%s': %s", file, err)
 			continue
@@ -138,7 +143,18 @@ loop:
 				}
 			}
 
-			_ = results
+			// The SSA interpreter must agree with the circuit.
+			ssaResults, err := program.Run(inputs, nil)
+			if err != nil {
+				t.Errorf("%s: run failed: %s", file, err)
+				continue loop
+			}
+			for idx, result := range ssaResults {
+				if result.Cmp(results[idx]) != 0 {
+					t.Errorf("%s: SSA result %d mismatch: got %v, expected %v",
+						file, idx, result.Text(base), results[idx].Text(base))
+				}
+			}
 		}
 	}
 }
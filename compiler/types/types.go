@@ -42,6 +42,7 @@ const (
 	Float
 	String
 	Struct
+	Array
 )
 
 // Types define MPCL types and their names.
@@ -53,6 +54,7 @@ var Types = map[string]Type{
 	"float":       Float,
 	"string":      String,
 	"struct":      Struct,
+	"array":       Array,
 }
 
 var shortTypes = map[Type]string{
@@ -63,6 +65,7 @@ var shortTypes = map[Type]string{
 	Float:     "f",
 	String:    "str",
 	Struct:    "struct",
+	Array:     "array",
 }
 
 // Info specifies information about a type.
@@ -72,6 +75,14 @@ type Info struct {
 	MinBits int
 	Struct  []StructField
 	Offset  int
+	// ElementType and ArraySize specify the element type and the
+	// number of elements of array types.
+	ElementType *Info
+	ArraySize   int
+	// Name and Package specify the name of a defined type. They are
+	// empty for unnamed types.
+	Name    string
+	Package string
 }
 
 // StructField defines a structure field name and type.
@@ -86,6 +97,9 @@ func (f StructField) String() string {
 }
 
 func (i Info) String() string {
+	if i.Type == Array && i.ElementType != nil {
+		return fmt.Sprintf("[%d]%s", i.ArraySize, *i.ElementType)
+	}
 	if i.Bits == 0 {
 		return i.Type.String()
 	}
@@ -107,7 +121,14 @@ func (i Info) Undefined() bool {
 
 // Equal tests if the argument type is equal to this type info.
 func (i Info) Equal(o Info) bool {
-	return i.Type == o.Type && i.Bits == o.Bits
+	if i.Type != o.Type || i.Bits != o.Bits {
+		return false
+	}
+	if i.Type == Array {
+		return i.ArraySize == o.ArraySize &&
+			i.ElementType.Equal(*o.ElementType)
+	}
+	return true
 }
 
 // CanAssignConst tests if the argument const type can be assigned to
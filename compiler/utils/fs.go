@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package utils
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/markkurossi/mpc/pkg"
+)
+
+// StdlibRoot is the virtual directory of the MPCL standard library,
+// embedded into the compiler. The files below the StdlibRoot
+// directory are read from the embedded standard library and all
+// other files are read from the operating system's file system.
+const StdlibRoot = "{stdlib}"
+
+// IsStdlib tests if the file name is in the embedded standard
+// library.
+func IsStdlib(name string) bool {
+	return name == StdlibRoot || strings.HasPrefix(name, StdlibRoot+"/")
+}
+
+func stdlibName(name string) string {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, StdlibRoot), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+// OpenFile opens the named file for reading.
+func OpenFile(name string) (io.ReadCloser, error) {
+	if IsStdlib(name) {
+		return pkg.FS.Open(stdlibName(name))
+	}
+	return os.Open(name)
+}
+
+// ReadFile reads the named file.
+func ReadFile(name string) ([]byte, error) {
+	if IsStdlib(name) {
+		return pkg.FS.ReadFile(stdlibName(name))
+	}
+	return os.ReadFile(name)
+}
+
+// ReadDirNames returns the names of the files of the named directory.
+func ReadDirNames(name string) ([]string, error) {
+	var entries []fs.DirEntry
+	var err error
+	if IsStdlib(name) {
+		entries, err = pkg.FS.ReadDir(stdlibName(name))
+	} else {
+		entries, err = os.ReadDir(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Name())
+	}
+	return result, nil
+}
+
+// Stat returns the file info of the named file.
+func Stat(name string) (fs.FileInfo, error) {
+	if IsStdlib(name) {
+		return fs.Stat(pkg.FS, stdlibName(name))
+	}
+	return os.Stat(name)
+}
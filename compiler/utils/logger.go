@@ -7,35 +7,132 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 )
 
-// Logger implements compiler logging facility.
+// MaxErrors specifies the number of errors after which the logger
+// stops reporting errors.
+const MaxErrors = 10
+
+// Severity specifies the severity of a diagnostic message.
+type Severity int
+
+// Diagnostic message severities.
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+var severities = map[Severity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityNote:    "note",
+}
+
+func (s Severity) String() string {
+	name, ok := severities[s]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{Severity %d}", s)
+}
+
+// Diagnostic implements a compiler diagnostic message. The message
+// applies to the source range [From:To]. If To is undefined, the
+// message applies to the From position.
+type Diagnostic struct {
+	Severity Severity
+	From     Point
+	To       Point
+	Message  string
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Severity string `json:"severity"`
+		Source   string `json:"source"`
+		Line     int    `json:"line,omitempty"`
+		Col      int    `json:"col"`
+		EndLine  int    `json:"endLine,omitempty"`
+		EndCol   int    `json:"endCol,omitempty"`
+		Message  string `json:"message"`
+	}{
+		Severity: d.Severity.String(),
+		Source:   d.From.Source,
+		Line:     d.From.Line,
+		Col:      d.From.Col,
+		Message:  d.Message,
+	}
+	if !d.To.Undefined() {
+		v.EndLine = d.To.Line
+		v.EndCol = d.To.Col
+	}
+	return json.Marshal(v)
+}
+
+// Logger implements compiler logging facility. The logger collects
+// all reported diagnostics and prints them either as text with the
+// offending source lines or as JSON objects, one per line.
 type Logger struct {
-	out io.Writer
+	out         io.Writer
+	json        bool
+	sources     map[string][]string
+	errors      int
+	Diagnostics []Diagnostic
 }
 
 // NewLogger creates a new logger outputting to the argument io.Writer.
 func NewLogger(out io.Writer) *Logger {
 	return &Logger{
-		out: out,
+		out:     out,
+		sources: make(map[string][]string),
 	}
 }
 
+// SetJSON sets the logger to output diagnostics as JSON objects.
+func (l *Logger) SetJSON(json bool) {
+	l.json = json
+}
+
+// AddSource adds the source code data of the source file name. The
+// logger uses the source code to show the offending source lines.
+func (l *Logger) AddSource(name string, data []byte) {
+	l.sources[name] = strings.Split(string(data), "\n")
+}
+
+// Errors returns the number of reported errors.
+func (l *Logger) Errors() int {
+	return l.errors
+}
+
+// TooManyErrors tests if the logger has reported the maximum number
+// of errors.
+func (l *Logger) TooManyErrors() bool {
+	return l.errors >= MaxErrors
+}
+
 // Errorf logs an error message.
 func (l *Logger) Errorf(loc Point, format string, a ...interface{}) error {
+	return l.ErrorRangef(loc, Point{}, format, a...)
+}
+
+// ErrorRangef logs an error message for the source range [from:to].
+func (l *Logger) ErrorRangef(from, to Point, format string,
+	a ...interface{}) error {
+
 	msg := fmt.Sprintf(format, a...)
-	if len(msg) > 0 && msg[len(msg)-1] != '\n' {
-		msg += "\n"
-	}
-	if loc.Undefined() {
-		fmt.Fprintf(l.out, "%s: %s", loc.Source, msg)
-	} else {
-		fmt.Fprintf(l.out, "%s: %s", loc, msg)
-	}
+	l.Report(Diagnostic{
+		Severity: SeverityError,
+		From:     from,
+		To:       to,
+		Message:  msg,
+	})
 
 	idx := strings.IndexRune(msg, '\n')
 	if idx > 0 {
@@ -46,13 +143,97 @@ func (l *Logger) Errorf(loc Point, format string, a ...interface{}) error {
 
 // Warningf logs a warning message.
 func (l *Logger) Warningf(loc Point, format string, a ...interface{}) {
-	msg := fmt.Sprintf(format, a...)
-	if len(msg) > 0 && msg[len(msg)-1] != '\n' {
-		msg += "\n"
+	l.Report(Diagnostic{
+		Severity: SeverityWarning,
+		From:     loc,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Notef logs a note message.
+func (l *Logger) Notef(loc Point, format string, a ...interface{}) {
+	l.Report(Diagnostic{
+		Severity: SeverityNote,
+		From:     loc,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Report reports the diagnostic message.
+func (l *Logger) Report(d Diagnostic) {
+	if d.Severity == SeverityError {
+		if l.errors >= MaxErrors {
+			return
+		}
+		l.errors++
 	}
-	if loc.Undefined() {
-		fmt.Fprintf(l.out, "%s: warning: %s", loc.Source, msg)
+	d.Message = strings.TrimRight(d.Message, "\n")
+	l.Diagnostics = append(l.Diagnostics, d)
+
+	if l.json {
+		data, err := json.Marshal(d)
+		if err == nil {
+			fmt.Fprintf(l.out, "%s\n", data)
+		}
 	} else {
-		fmt.Fprintf(l.out, "%s: warning: %s", loc, msg)
+		l.print(d)
+	}
+
+	if d.Severity == SeverityError && l.errors == MaxErrors {
+		l.Report(Diagnostic{
+			Severity: SeverityNote,
+			From: Point{
+				Source: d.From.Source,
+			},
+			Message: "too many errors",
+		})
+	}
+}
+
+func (l *Logger) print(d Diagnostic) {
+	if d.From.Undefined() {
+		fmt.Fprintf(l.out, "%s: %s: %s\n", d.From.Source, d.Severity,
+			d.Message)
+		return
+	}
+	fmt.Fprintf(l.out, "%s: %s: %s\n", d.From, d.Severity, d.Message)
+
+	line, ok := l.line(d.From)
+	if !ok {
+		return
+	}
+	var indicator []rune
+	for i, r := range []rune(line) {
+		if i >= d.From.Col {
+			break
+		}
+		if r == '\t' {
+			indicator = append(indicator, '\t')
+		} else {
+			indicator = append(indicator, ' ')
+		}
+	}
+	indicator = append(indicator, '^')
+	if d.To.Line == d.From.Line {
+		for i := d.From.Col + 1; i < d.To.Col; i++ {
+			indicator = append(indicator, '~')
+		}
+	}
+	fmt.Fprintf(l.out, "%s\n%s\n", line, string(indicator))
+}
+
+// line returns the source code line of the location loc.
+func (l *Logger) line(loc Point) (string, bool) {
+	lines, ok := l.sources[loc.Source]
+	if !ok {
+		data, err := ReadFile(loc.Source)
+		if err == nil {
+			l.AddSource(loc.Source, data)
+			lines = l.sources[loc.Source]
+		}
+	}
+	if loc.Line < 1 || loc.Line > len(lines) {
+		return "", false
 	}
+	return strings.TrimRight(lines[loc.Line-1], "\r"), true
 }
@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+const loggerSource = `package main
+
+func main(a int32) int32 {
+	return a + b
+}
+`
+
+func TestLoggerSnippet(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	logger.AddSource("a.mpcl", []byte(loggerSource))
+
+	from := Point{
+		Source: "a.mpcl",
+		Line:   4,
+		Col:    8,
+	}
+	to := from
+	to.Col = 13
+	logger.ErrorRangef(from, to, "invalid expression")
+
+	expected := "a.mpcl:4:8: error: invalid expression\n" +
+		"\treturn a + b\n" +
+		"\t       ^~~~~\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out.String(),
+			expected)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	logger.SetJSON(true)
+
+	logger.Warningf(Point{
+		Source: "a.mpcl",
+		Line:   2,
+		Col:    1,
+	}, "unused variable")
+
+	var d map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &d)
+	if err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+	if d["severity"] != "warning" || d["source"] != "a.mpcl" ||
+		d["line"] != 2.0 || d["col"] != 1.0 ||
+		d["message"] != "unused variable" {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+}
+
+func TestLoggerMaxErrors(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+
+	for i := 0; i < MaxErrors+5; i++ {
+		logger.Errorf(Point{Source: "a.mpcl"}, "error %d", i)
+	}
+	if logger.Errors() != MaxErrors {
+		t.Errorf("got %d errors, expected %d", logger.Errors(), MaxErrors)
+	}
+	if !logger.TooManyErrors() {
+		t.Errorf("TooManyErrors returned false")
+	}
+	last := logger.Diagnostics[len(logger.Diagnostics)-1]
+	if last.Severity != SeverityNote || last.Message != "too many errors" {
+		t.Errorf("unexpected last diagnostic: %v", last)
+	}
+}
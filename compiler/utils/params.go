@@ -7,23 +7,69 @@
 package utils
 
 import (
+	"fmt"
 	"io"
+	"sort"
+	"strings"
 )
 
 // Params specify compiler parameters.
 type Params struct {
-	Verbose   bool
-	SSAOut    io.WriteCloser
-	SSADotOut io.WriteCloser
+	Verbose         bool
+	DiagnosticsJSON bool
+	Warnings        Warnings
+	PkgPath         []string
+	SSAOut          io.WriteCloser
+	SSADotOut       io.WriteCloser
 
 	NoCircCompile bool
 	CircOut       io.WriteCloser
 	CircDotOut    io.WriteCloser
 	CircFormat    string
+	ProfOut       io.WriteCloser
+	PprofOut      io.WriteCloser
 
 	CircMultArrayTreshold int
+	CircLowDepth          bool
 
-	OptPruneGates bool
+	// NoCallEval disables the compile-time evaluation of function
+	// calls. The called functions are compiled into gates and their
+	// arguments are bound to circuit values.
+	NoCallEval bool
+
+	OptPruneGates    bool
+	OptSimplifyGates bool
+	OptDedupGates    bool
+
+	OptConstProp    bool
+	OptCopyProp     bool
+	OptCSE          bool
+	OptDCE          bool
+	OptNarrowWidths bool
+
+	OptStrengthReduce bool
+
+	PeepholeRules       []string
+	VerifyPeepholeRules bool
+}
+
+// SetOptLevel enables the optimization passes of the optimization
+// level. The level 0 disables all optimizations. The level 1 enables
+// the SSA constant propagation, copy propagation, dead instruction
+// elimination, and bit-width narrowing, the strength reduction of
+// constant multiplications and divisions, and the gate
+// simplification, deduplication, and pruning. The level 2 enables
+// also the SSA common subexpression elimination.
+func (p *Params) SetOptLevel(level int) {
+	p.OptConstProp = level > 0
+	p.OptCopyProp = level > 0
+	p.OptDCE = level > 0
+	p.OptNarrowWidths = level > 0
+	p.OptSimplifyGates = level > 0
+	p.OptDedupGates = level > 0
+	p.OptPruneGates = level > 0
+	p.OptStrengthReduce = level > 0
+	p.OptCSE = level > 1
 }
 
 // Close closes all open resources.
@@ -44,4 +90,94 @@ func (p *Params) Close() {
 		p.CircDotOut.Close()
 		p.CircDotOut = nil
 	}
+	if p.ProfOut != nil {
+		p.ProfOut.Close()
+		p.ProfOut = nil
+	}
+	if p.PprofOut != nil {
+		p.PprofOut.Close()
+		p.PprofOut = nil
+	}
+}
+
+// Warnings specify the enabled compiler warnings. The warnings
+// implement the flag.Value interface so they can be set with a
+// comma-separated list of warning names. The name "all" enables all
+// warnings, "none" disables all warnings, and the "no-" prefix
+// disables the named warning.
+type Warnings struct {
+	Unused       bool
+	UnusedImport bool
+	Shadow       bool
+	Truncate     bool
+	Compare      bool
+}
+
+// AllWarnings returns warnings with all warnings enabled.
+func AllWarnings() Warnings {
+	return Warnings{
+		Unused:       true,
+		UnusedImport: true,
+		Shadow:       true,
+		Truncate:     true,
+		Compare:      true,
+	}
+}
+
+func (w *Warnings) flags() map[string]*bool {
+	return map[string]*bool{
+		"unused":   &w.Unused,
+		"imports":  &w.UnusedImport,
+		"shadow":   &w.Shadow,
+		"truncate": &w.Truncate,
+		"compare":  &w.Compare,
+	}
+}
+
+func (w *Warnings) String() string {
+	var names []string
+	for name, enabled := range w.flags() {
+		if *enabled {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set sets the warnings from the comma-separated list of warning
+// names.
+func (w *Warnings) Set(value string) error {
+	flags := w.flags()
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		enable := true
+		if strings.HasPrefix(name, "no-") {
+			enable = false
+			name = name[3:]
+		}
+		switch name {
+		case "all":
+			for _, flag := range flags {
+				*flag = enable
+			}
+		case "none":
+			for _, flag := range flags {
+				*flag = false
+			}
+		default:
+			flag, ok := flags[name]
+			if !ok {
+				return fmt.Errorf("unknown warning: %s", name)
+			}
+			*flag = enable
+		}
+	}
+	return nil
 }
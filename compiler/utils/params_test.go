@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestWarningsSet(t *testing.T) {
+	var w Warnings
+	if w.String() != "none" {
+		t.Errorf("unexpected default warnings: %s", w.String())
+	}
+	err := w.Set("all,no-shadow")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	if w.String() != "compare,imports,truncate,unused" {
+		t.Errorf("unexpected warnings: %s", w.String())
+	}
+	err = w.Set("none,shadow")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	if w != (Warnings{Shadow: true}) {
+		t.Errorf("unexpected warnings: %s", w.String())
+	}
+	err = w.Set("unknown")
+	if err == nil {
+		t.Errorf("Set accepted unknown warning")
+	}
+}
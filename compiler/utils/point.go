@@ -25,3 +25,19 @@ func (p Point) String() string {
 func (p Point) Undefined() bool {
 	return p.Line == 0
 }
+
+// Location specifies a source position together with the function
+// containing it. The Caller chain records the call sites through
+// which an inlined function was reached.
+type Location struct {
+	Point
+	Func   string
+	Caller *Location
+}
+
+func (l *Location) String() string {
+	if l == nil {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d", l.Source, l.Line)
+}
@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler/ast"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+var warningsTests = []struct {
+	warnings string
+	src      string
+	expected []string
+}{
+	{
+		warnings: "unused",
+		src: `
+package main
+func main(a, b int32) int32 {
+	c := a
+	return a
+}
+`,
+		expected: []string{
+			"c declared and not used",
+			"argument b is unused",
+		},
+	},
+	{
+		warnings: "shadow",
+		src: `
+package main
+func main(a, b int32) int32 {
+	if a > b {
+		var a int32 = b
+		return a
+	}
+	return a
+}
+`,
+		expected: []string{
+			"declaration of a shadows declaration at {test 1}:3:10",
+		},
+	},
+	{
+		warnings: "truncate",
+		src: `
+package main
+func main(a int32) int8 {
+	var b int8 = a
+	return b
+}
+`,
+		expected: []string{
+			"implicit conversion from int32 to int8 truncates value",
+		},
+	},
+	{
+		warnings: "compare",
+		src: `
+package main
+func main(a uint8) (bool, bool) {
+	return a >= 0, 255 < a
+}
+`,
+		expected: []string{
+			"comparison a >= 0 is always true",
+			"comparison 255 < a is always false",
+		},
+	},
+	{
+		warnings: "compare",
+		src: `
+package main
+func main(a uint8, b int8) (bool, bool, bool) {
+	return a < 300, b != 200, a+1 == 0x1ff
+}
+`,
+		expected: []string{
+			"comparison a < 300 is always true",
+			"comparison b != 200 is always true",
+			"comparison a + 1 == 511 is always false",
+		},
+	},
+	{
+		warnings: "truncate",
+		src: `
+package main
+func main(a, b int32) int32 {
+	var x, y int8
+	x, y = a, b
+	return a
+}
+`,
+		expected: []string{
+			"implicit conversion from int32 to int8 truncates value",
+			"implicit conversion from int32 to int8 truncates value",
+		},
+	},
+	{
+		warnings: "shadow",
+		src: `
+package main
+func main(a, b int32) int32 {
+	x := a
+	for x := 0; x < 2; x++ {
+		b = b + 1
+	}
+	return b + x
+}
+`,
+		expected: []string{
+			"declaration of x shadows declaration at {test 6}:4:1",
+		},
+	},
+	{
+		warnings: "unused",
+		src: `
+package main
+func main(a uint8) uint {
+	wide := make(uint, size(a)*2)
+	var b wide = 1
+	return uint(b + wide(a))
+}
+`,
+	},
+	{
+		warnings: "all,no-unused",
+		src: `
+package main
+func main(a, b int32) int32 {
+	return a
+}
+`,
+	},
+}
+
+func TestWarnings(t *testing.T) {
+	for idx, test := range warningsTests {
+		params := &utils.Params{
+			NoCircCompile: true,
+		}
+		err := params.Warnings.Set(test.warnings)
+		if err != nil {
+			t.Fatalf("test %d: invalid warnings: %s", idx, err)
+		}
+		logger := utils.NewLogger(ioutil.Discard)
+		parser := NewParser(fmt.Sprintf("{test %d}", idx), nil, logger,
+			bytes.NewReader([]byte(test.src)))
+		pkg, err := parser.Parse(nil)
+		if err != nil {
+			t.Fatalf("test %d: parse failed: %s", idx, err)
+		}
+		_, _, err = pkg.Compile(map[string]*ast.Package{
+			"main": pkg,
+		}, logger, params)
+		if err != nil {
+			t.Fatalf("test %d: compile failed: %s", idx, err)
+		}
+
+		var warnings []string
+		for _, d := range logger.Diagnostics {
+			if d.Severity == utils.SeverityWarning {
+				warnings = append(warnings, d.Message)
+			}
+		}
+		if len(warnings) != len(test.expected) {
+			t.Fatalf("test %d: got warnings %q, expected %q",
+				idx, warnings, test.expected)
+		}
+		for i, w := range warnings {
+			if w != test.expected[i] {
+				t.Errorf("test %d: got warning %q, expected %q",
+					idx, w, test.expected[i])
+			}
+		}
+	}
+}
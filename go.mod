@@ -1,5 +1,5 @@
 module github.com/markkurossi/mpc
 
-go 1.14
+go 1.16
 
 require github.com/markkurossi/tabulate v0.0.0-20200630052913-7ac37e421b0c
@@ -0,0 +1,20 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+// Package pkg contains the MPCL standard library. The library sources
+// and native circuits are embedded into the compiler so that the
+// compiler can import the standard packages without access to the
+// source tree.
+package pkg
+
+import (
+	"embed"
+)
+
+// FS contains the MPCL standard library packages.
+//
+//go:embed crypto encoding math
+var FS embed.FS